@@ -2,8 +2,11 @@ package whispertool
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 )
 
@@ -47,6 +50,7 @@ func (a *ArchiveInfo) timesToPropagate(points []Point) []Timestamp {
 // ParseArchiveInfoList parses multiple retention definitions as you would find in the storage-schemas.conf
 // of a Carbon install. Note that this parses multiple retention definitions.
 // An example input is "10s:2h,1m:1d".
+// Spaces around each retention definition are ignored like carbon does.
 //
 // See: http://graphite.readthedocs.org/en/1.0/config-carbon.html#storage-schemas-conf
 func ParseArchiveInfoList(s string) (ArchiveInfoList, error) {
@@ -89,29 +93,79 @@ func ParseArchiveInfoList(s string) (ArchiveInfoList, error) {
 // An example input is "10s:2h".
 // If you would like to parse multiple retention definitions like "10s:2h,1m:1d", use
 // ParseRetentions instead.
+//
+// Like carbon, the precision and the retention can also be written as
+// integers without units. An integer precision means seconds per point and
+// an integer retention means the number of points, for example "60:1440" is
+// the same as "1m:1d". See ParseDuration for units accepted.
+//
+// Like carbon, the number of points of a retention with a unit is the
+// retention divided by the precision and rounded down, for example
+// "7s:1m" has 8 points.
 func ParseArchiveInfo(s string) (ArchiveInfo, error) {
+	s = strings.TrimSpace(s)
 	i := strings.IndexRune(s, ':')
 	if i == -1 || i+1 >= len(s) {
 		return ArchiveInfo{}, fmt.Errorf("invalid ArchiveInfo: %q", s)
 	}
 
-	step, err := ParseDuration(s[:i])
-	if err != nil {
-		return ArchiveInfo{}, fmt.Errorf("invalid ArchiveInfo: %q", s)
+	var step Duration
+	if isDigits(s[:i]) {
+		v, err := strconv.ParseInt(s[:i], 10, 32)
+		if err != nil {
+			return ArchiveInfo{}, fmt.Errorf("invalid ArchiveInfo: %q", s)
+		}
+		step = Duration(v)
+	} else {
+		var err error
+		step, err = ParseDuration(s[:i])
+		if err != nil {
+			return ArchiveInfo{}, fmt.Errorf("invalid ArchiveInfo: %q", s)
+		}
 	}
-	d, err := ParseDuration(s[i+1:])
-	if err != nil {
+	if step <= 0 {
 		return ArchiveInfo{}, fmt.Errorf("invalid ArchiveInfo: %q", s)
 	}
-	if step <= 0 || d <= 0 || d%step != 0 {
+
+	var numberOfPoints int64
+	if isDigits(s[i+1:]) {
+		var err error
+		numberOfPoints, err = strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return ArchiveInfo{}, fmt.Errorf("invalid ArchiveInfo: %q", s)
+		}
+		if int64(step)*numberOfPoints > math.MaxInt32 {
+			// overflow
+			return ArchiveInfo{}, fmt.Errorf("invalid ArchiveInfo: %q", s)
+		}
+	} else {
+		d, err := ParseDuration(s[i+1:])
+		if err != nil {
+			return ArchiveInfo{}, fmt.Errorf("invalid ArchiveInfo: %q", s)
+		}
+		numberOfPoints = int64(d / step)
+	}
+	if numberOfPoints <= 0 {
 		return ArchiveInfo{}, fmt.Errorf("invalid ArchiveInfo: %q", s)
 	}
 	return ArchiveInfo{
 		secondsPerPoint: step,
-		numberOfPoints:  uint32(d / step),
+		numberOfPoints:  uint32(numberOfPoints),
 	}, nil
 }
 
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 // String returns the spring representation of rr.
 func (aa ArchiveInfoList) String() string {
 	var b strings.Builder
@@ -206,6 +260,9 @@ func (a *ArchiveInfo) SecondsPerPoint() Duration { return a.secondsPerPoint }
 // NumberOfPoints returns the number of points in a.
 func (a *ArchiveInfo) NumberOfPoints() uint32 { return a.numberOfPoints }
 
+// Offset returns the offset in bytes of a in the whisper file.
+func (a *ArchiveInfo) Offset() uint32 { return a.offset }
+
 func (a ArchiveInfo) validate() error {
 	if a.secondsPerPoint <= 0 {
 		return errors.New("seconds per point must be positive")
@@ -228,6 +285,22 @@ func (a ArchiveInfo) String() string {
 		(a.secondsPerPoint * Duration(a.numberOfPoints)).String()
 }
 
+// MarshalJSON returns the JSON representation of a.
+// The secondsPerPoint is in seconds and the offset is in bytes.
+func (a ArchiveInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		SecondsPerPoint int32  `json:"secondsPerPoint"`
+		NumberOfPoints  uint32 `json:"numberOfPoints"`
+		Offset          uint32 `json:"offset"`
+		Retention       string `json:"retention"`
+	}{
+		SecondsPerPoint: int32(a.secondsPerPoint),
+		NumberOfPoints:  a.numberOfPoints,
+		Offset:          a.offset,
+		Retention:       a.String(),
+	})
+}
+
 func (a *ArchiveInfo) pointIndex(baseInterval, interval Timestamp) int {
 	// NOTE: We use interval.Sub(baseInterval) here instead of
 	// interval - baseInterval since the latter produces
@@ -18,6 +18,24 @@ func TestParseArchiveInfo(t *testing.T) {
 		{input: "1m:30m:20s", wantPrecision: 0, wantNrPts: 0, wantErr: true},
 		{input: "1f:30s", wantPrecision: 0, wantNrPts: 0, wantErr: true},
 		{input: "1m:30f", wantPrecision: 0, wantNrPts: 0, wantErr: true},
+
+		// integer precision in seconds and integer retention in points
+		{input: "60:1440", wantPrecision: Minute, wantNrPts: 1440, wantErr: false},
+		{input: "60s:1440", wantPrecision: Minute, wantNrPts: 1440, wantErr: false},
+		{input: "60:1d", wantPrecision: Minute, wantNrPts: 1440, wantErr: false},
+		{input: " 10:360 ", wantPrecision: 10 * Second, wantNrPts: 360, wantErr: false},
+		{input: "0:1440", wantPrecision: 0, wantNrPts: 0, wantErr: true},
+		{input: "60:0", wantPrecision: 0, wantNrPts: 0, wantErr: true},
+		{input: "60:35791395", wantPrecision: 0, wantNrPts: 0, wantErr: true},
+		{input: "-60:1440", wantPrecision: 0, wantNrPts: 0, wantErr: true},
+
+		// multi-letter units
+		{input: "1min:1day", wantPrecision: Minute, wantNrPts: 1440, wantErr: false},
+		{input: "10sec:6hours", wantPrecision: 10 * Second, wantNrPts: 2160, wantErr: false},
+		{input: "1hour:3mon", wantPrecision: Hour, wantNrPts: 2160, wantErr: false},
+		{input: "1day:5years", wantPrecision: Day, wantNrPts: 1825, wantErr: false},
+		{input: "7s:1m", wantPrecision: 7 * Second, wantNrPts: 8, wantErr: false},
+		{input: "1m:30s", wantPrecision: 0, wantNrPts: 0, wantErr: true},
 	}
 	for _, tc := range testCases {
 		r, err := ParseArchiveInfo(tc.input)
@@ -68,10 +86,36 @@ func TestParseArchiveInfoList(t *testing.T) {
 			},
 			wantErr: false,
 		},
-		{input: "3m:5m", want: nil, wantErr: true},
+		{
+			// Like carbon, 5m / 3m is rounded down to 1 point.
+			input: "3m:5m",
+			want: []ArchiveInfo{
+				NewArchiveInfo(3*Minute, 1),
+			},
+			wantErr: false,
+		},
 		{input: "1h:1m", want: nil, wantErr: true},
 		{input: "1m:30m:20s", want: nil, wantErr: true},
 		{input: "", want: nil, wantErr: true},
+		{
+			input: "10:2160, 60:10080,600:262974",
+			want: []ArchiveInfo{
+				NewArchiveInfo(10*Second, 2160),
+				NewArchiveInfo(Minute, 10080),
+				NewArchiveInfo(10*Minute, 262974),
+			},
+			wantErr: false,
+		},
+		{
+			input: "10sec:6hours,1min:7days,10min:5years",
+			want: []ArchiveInfo{
+				NewArchiveInfo(10*Second, 2160),
+				NewArchiveInfo(Minute, 10080),
+				NewArchiveInfo(10*Minute, 262800),
+			},
+			wantErr: false,
+		},
+		{input: "1m:1d,", want: nil, wantErr: true},
 	}
 	for _, tc := range testCases {
 		rr, err := ParseArchiveInfoList(tc.input)
@@ -89,6 +133,29 @@ func TestParseArchiveInfoList(t *testing.T) {
 	}
 }
 
+func TestArchiveInfoList_StringRoundTrip(t *testing.T) {
+	inputs := []string{
+		"60:1440",
+		"10:2160,60:10080,600:262974",
+		"10sec:6hours,1min:7days,10min:5years",
+		"1m:30h,1h:32d,1d:400d",
+		"1hour:3mon,1day:2years",
+	}
+	for _, input := range inputs {
+		rr, err := ParseArchiveInfoList(input)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", input, err)
+		}
+		rr2, err := ParseArchiveInfoList(rr.String())
+		if err != nil {
+			t.Fatalf("cannot parse %q which is String() of %q: %s", rr.String(), input, err)
+		}
+		if !rr.Equal(rr2) {
+			t.Errorf("round trip unmatch for input %q, got=%s, want=%s", input, rr2, rr)
+		}
+	}
+}
+
 func TestSortArchiveInfoList(t *testing.T) {
 	retentions := ArchiveInfoList{
 		{secondsPerPoint: 300, numberOfPoints: 12},
@@ -0,0 +1,251 @@
+package whispertool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CeresNodeMetadataFilename is the name of the metadata file in a Ceres node directory.
+const CeresNodeMetadataFilename = ".ceres-node"
+
+const ceresSliceExt = ".slice"
+
+// Default values used by Ceres when the metadata omits them.
+const (
+	ceresDefaultTimeStep          = 60
+	ceresDefaultAggregationMethod = Average
+	ceresDefaultXFilesFactor      = 0.5
+)
+
+// CeresNode is a node of a Graphite Ceres database, that is a directory
+// with a ".ceres-node" metadata file and "<startTime>@<timeStep>.slice"
+// files of big endian float64 values.
+type CeresNode struct {
+	dir               string
+	timeStep          Duration
+	aggregationMethod AggregationMethod
+	xFilesFactor      float32
+	archiveInfoList   ArchiveInfoList
+	slices            []ceresSlice
+}
+
+type ceresSlice struct {
+	filename  string
+	startTime Timestamp
+	timeStep  Duration
+	count     int
+}
+
+type ceresNodeMetadata struct {
+	TimeStep          *int64     `json:"timeStep"`
+	AggregationMethod *string    `json:"aggregationMethod"`
+	XFilesFactor      *float32   `json:"xFilesFactor"`
+	Retentions        [][2]int64 `json:"retentions"`
+}
+
+// IsCeresNode returns whether or not dir is a Ceres node directory.
+func IsCeresNode(dir string) bool {
+	fi, err := os.Stat(filepath.Join(dir, CeresNodeMetadataFilename))
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// OpenCeresNode reads the metadata and the list of slices of a Ceres node.
+func OpenCeresNode(dir string) (*CeresNode, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, CeresNodeMetadataFilename))
+	if err != nil {
+		return nil, err
+	}
+	var m ceresNodeMetadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid ceres node metadata: %s", err)
+	}
+
+	n := &CeresNode{
+		dir:               dir,
+		timeStep:          ceresDefaultTimeStep,
+		aggregationMethod: ceresDefaultAggregationMethod,
+		xFilesFactor:      ceresDefaultXFilesFactor,
+	}
+	if m.TimeStep != nil {
+		if *m.TimeStep <= 0 || *m.TimeStep > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid timeStep in ceres node metadata: %d", *m.TimeStep)
+		}
+		n.timeStep = Duration(*m.TimeStep)
+	}
+	if m.AggregationMethod != nil {
+		n.aggregationMethod, err = AggregationMethodString(*m.AggregationMethod)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aggregationMethod in ceres node metadata: %s", *m.AggregationMethod)
+		}
+	}
+	if m.XFilesFactor != nil {
+		if err := validateXFilesFactor(*m.XFilesFactor); err != nil {
+			return nil, err
+		}
+		n.xFilesFactor = *m.XFilesFactor
+	}
+	for _, r := range m.Retentions {
+		if r[0] <= 0 || r[0] > math.MaxInt32 || r[1] <= 0 || r[1] > math.MaxUint32 {
+			return nil, fmt.Errorf("invalid retentions in ceres node metadata: %v", m.Retentions)
+		}
+		n.archiveInfoList = append(n.archiveInfoList, NewArchiveInfo(Duration(r[0]), uint32(r[1])))
+	}
+
+	if err := n.readSlices(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *CeresNode) readSlices() error {
+	fis, err := ioutil.ReadDir(n.dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		name := fi.Name()
+		if !fi.Mode().IsRegular() || !strings.HasSuffix(name, ceresSliceExt) {
+			continue
+		}
+		s, err := parseCeresSliceFilename(name)
+		if err != nil {
+			return err
+		}
+		s.filename = filepath.Join(n.dir, name)
+		s.count = int(fi.Size() / float64Size)
+		n.slices = append(n.slices, s)
+	}
+	sort.Slice(n.slices, func(i, j int) bool { return n.slices[i].startTime < n.slices[j].startTime })
+	return nil
+}
+
+func parseCeresSliceFilename(name string) (ceresSlice, error) {
+	base := strings.TrimSuffix(name, ceresSliceExt)
+	i := strings.IndexByte(base, '@')
+	if i == -1 {
+		return ceresSlice{}, fmt.Errorf("invalid ceres slice filename: %s", name)
+	}
+	startTime, err1 := strconv.ParseUint(base[:i], 10, 32)
+	timeStep, err2 := strconv.ParseUint(base[i+1:], 10, 31)
+	if err1 != nil || err2 != nil || timeStep == 0 {
+		return ceresSlice{}, fmt.Errorf("invalid ceres slice filename: %s", name)
+	}
+	return ceresSlice{startTime: Timestamp(startTime), timeStep: Duration(timeStep)}, nil
+}
+
+// TimeStep returns the time step of the node.
+func (n *CeresNode) TimeStep() Duration { return n.timeStep }
+
+// AggregationMethod returns the aggregation method in the metadata of the node.
+func (n *CeresNode) AggregationMethod() AggregationMethod { return n.aggregationMethod }
+
+// XFilesFactor returns the xFilesFactor in the metadata of the node.
+func (n *CeresNode) XFilesFactor() float32 { return n.xFilesFactor }
+
+// ArchiveInfoList returns the retentions in the metadata of the node.
+// It returns nil if the metadata does not have retentions.
+func (n *CeresNode) ArchiveInfoList() ArchiveInfoList { return n.archiveInfoList }
+
+// Fetch fetches points of the node in range between `from` (exclusive)
+// and `until` (inclusive) with the time step of the node.
+// The range is aligned in the same way as Whisper.FetchFromArchive and
+// it is limited to the range of slices. It returns nil if no slices are
+// in the range. Values of slices with other time steps are put at the
+// points which their times fall in.
+func (n *CeresNode) Fetch(from, until Timestamp) (*TimeSeries, error) {
+	if from > until {
+		return nil, fmt.Errorf("invalid time interval: from time '%d' is after until time '%d'", from, until)
+	}
+	if len(n.slices) == 0 {
+		return nil, nil
+	}
+	step := n.timeStep
+	fromInterval := from - from%Timestamp(step) + Timestamp(step)
+	untilInterval := until - until%Timestamp(step) + Timestamp(step)
+	if fromInterval == untilInterval {
+		untilInterval = untilInterval.Add(step)
+	}
+
+	first := n.slices[0].startTime
+	first -= first % Timestamp(step)
+	if fromInterval < first {
+		fromInterval = first
+	}
+	var last Timestamp
+	for _, s := range n.slices {
+		if end := s.endTime(); end > last {
+			last = end
+		}
+	}
+	if rem := last % Timestamp(step); rem != 0 {
+		last += Timestamp(step) - rem
+	}
+	if untilInterval > last {
+		untilInterval = last
+	}
+	if fromInterval >= untilInterval {
+		return nil, nil
+	}
+
+	values := make([]Value, untilInterval.Sub(fromInterval)/step)
+	for i := range values {
+		values[i].SetNaN()
+	}
+	for _, s := range n.slices {
+		if err := s.readInto(values, fromInterval, untilInterval, step); err != nil {
+			return nil, err
+		}
+	}
+	return NewTimeSeries(fromInterval, untilInterval, step, values), nil
+}
+
+func (s *ceresSlice) endTime() Timestamp {
+	return s.startTime.Add(Duration(s.count) * s.timeStep)
+}
+
+// readInto reads values of the slice in [fromInterval, untilInterval)
+// into values. NaN values in the slice do not overwrite values.
+func (s *ceresSlice) readInto(values []Value, fromInterval, untilInterval Timestamp, step Duration) error {
+	if s.endTime() <= fromInterval || untilInterval <= s.startTime {
+		return nil
+	}
+	i0 := 0
+	if s.startTime < fromInterval {
+		i0 = int((fromInterval.Sub(s.startTime) + s.timeStep - 1) / s.timeStep)
+	}
+	i1 := int((untilInterval.Sub(s.startTime) + s.timeStep - 1) / s.timeStep)
+	if i1 > s.count {
+		i1 = s.count
+	}
+	if i0 >= i1 {
+		return nil
+	}
+
+	file, err := os.Open(s.filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := make([]byte, (i1-i0)*float64Size)
+	if _, err := file.ReadAt(buf, int64(i0)*float64Size); err != nil {
+		return err
+	}
+	for i := i0; i < i1; i++ {
+		v := Value(math.Float64frombits(binary.BigEndian.Uint64(buf[(i-i0)*float64Size:])))
+		if v.IsNaN() {
+			continue
+		}
+		t := s.startTime.Add(Duration(i) * s.timeStep)
+		values[t.Sub(fromInterval)/step] = v
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package whispertool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCeresNode_Fetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start, err := ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := `{"timeStep":60,"aggregationMethod":"sum","xFilesFactor":0,"retentions":[[60,1440]]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, CeresNodeMetadataFilename), []byte(metadata), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nan := math.NaN()
+	writeCeresSlice(t, dir, start, Minute, []float64{1, nan, 3})
+	writeCeresSlice(t, dir, start.Add(4*Minute), Minute, []float64{5, 6})
+	if !IsCeresNode(dir) {
+		t.Fatalf("should be a ceres node: %s", dir)
+	}
+
+	node, err := OpenCeresNode(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.TimeStep() != Minute || node.AggregationMethod() != Sum || node.XFilesFactor() != 0 ||
+		node.ArchiveInfoList().String() != "1m:1d" {
+		t.Errorf("metadata unmatch, timeStep=%s, aggMethod=%s, xFilesFactor=%g, retentions=%s",
+			node.TimeStep(), node.AggregationMethod(), node.XFilesFactor(), node.ArchiveInfoList())
+	}
+
+	testCases := []struct {
+		from, until Timestamp
+		want        string
+	}{
+		{
+			from:  start.Add(-Minute),
+			until: start.Add(5 * Minute),
+			want:  `{"fromTime":"2020-06-20T12:00:00Z","untilTime":"2020-06-20T12:06:00Z","step":60,"values":[1,null,3,null,5,6]}`,
+		},
+		{
+			from:  0,
+			until: start.Add(Hour),
+			want:  `{"fromTime":"2020-06-20T12:00:00Z","untilTime":"2020-06-20T12:06:00Z","step":60,"values":[1,null,3,null,5,6]}`,
+		},
+		{
+			from:  start.Add(Minute),
+			until: start.Add(3 * Minute),
+			want:  `{"fromTime":"2020-06-20T12:02:00Z","untilTime":"2020-06-20T12:04:00Z","step":60,"values":[3,null]}`,
+		},
+		{
+			from:  start.Add(6 * Minute),
+			until: start.Add(Hour),
+			want:  `null`,
+		},
+	}
+	for _, tc := range testCases {
+		ts, err := node.Fetch(tc.from, tc.until)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("fetch unmatch for from=%s, until=%s, got=%s, want=%s", tc.from, tc.until, got, tc.want)
+		}
+	}
+}
+
+func writeCeresSlice(t *testing.T, dir string, start Timestamp, step Duration, values []float64) {
+	t.Helper()
+	buf := make([]byte, len(values)*float64Size)
+	for i, v := range values {
+		binary.BigEndian.PutUint64(buf[i*float64Size:], math.Float64bits(v))
+	}
+	filename := filepath.Join(dir, fmt.Sprintf("%d@%d.slice", start, step))
+	if err := ioutil.WriteFile(filename, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,48 @@
+package whispertool
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the interface for getting the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// FixedClock is a Clock whose time changes only when Set or Sleep
+// is called. The zero value is a clock at the zero time.
+//
+// FixedClock is safe for concurrent use and provided for tests
+// which need a reproducible current time. Pass it to Create or Open
+// with WithClock.
+type FixedClock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+// NewFixedClock returns a new FixedClock whose current time is t.
+func NewFixedClock(t time.Time) *FixedClock {
+	return &FixedClock{now: t}
+}
+
+// Set sets the current time of c to t.
+func (c *FixedClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+// Sleep advances the current time of c by d without actually sleeping.
+func (c *FixedClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// Now returns the current time of c.
+func (c *FixedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
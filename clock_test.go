@@ -0,0 +1,58 @@
+package whispertool
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithClock(t *testing.T) {
+	archiveInfoList, err := ParseArchiveInfoList("1m:2h,1h:2d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := ioutil.TempFile("", "whispertool-test-*.wsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	t.Cleanup(func() {
+		os.Remove(file.Name())
+	})
+
+	clock := NewFixedClock(time.Date(2020, 6, 28, 9, 50, 30, 0, time.UTC))
+	db, err := Create(file.Name(), archiveInfoList, Sum, 0,
+		WithOpenFileFlag(os.O_RDWR), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := TimestampFromStdTime(clock.Now())
+	if err := db.Update(now, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateMany([]Point{{Time: now.Add(-Minute), Value: 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Advance the clock to make sure the clock is used instead of the real time.
+	clock.Sleep(time.Minute)
+	ts, err := db.Fetch(now.Add(-2*Minute), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ts.Values(), []Value{2, 1}; !(len(got) == len(want) && got[0] == want[0] && got[1] == want[1]) {
+		t.Errorf("values unmatch, got=%v, want=%v", got, want)
+	}
+	if got, want := ts.Step(), Minute; got != want {
+		t.Errorf("step unmatch, got=%s, want=%s", got, want)
+	}
+
+	clock.Set(time.Date(2020, 7, 28, 9, 50, 30, 0, time.UTC))
+	if err := db.Update(now, 1); err == nil {
+		t.Errorf("should get error for timestamp older than max retention of clock")
+	}
+}
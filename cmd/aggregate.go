@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/hnakamur/whispertool"
+)
+
+// AggregateCommand aggregates values of whisper files in each item
+// directory with AggregateOptions and shows the result.
+type AggregateCommand struct {
+	SrcBase     string
+	ItemPattern string
+	SrcPattern  string
+	From        whispertool.Timestamp
+	Until       whispertool.Timestamp
+	Now         whispertool.Timestamp
+	ArchiveID   int
+	TextOut     string
+	Format      string
+	TimeFormat  TimeFormat
+	ShowHeader  bool
+	ShowCount   bool
+
+	AggregateOptions
+}
+
+// SumCommand is an alias of AggregateCommand kept for the sum subcommand.
+// It sums values unless Func is set.
+type SumCommand = AggregateCommand
+
+func (c *AggregateCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.SrcBase, "src-base", "", "src base directory or URL of \"whispertool server\"")
+	fs.StringVar(&c.ItemPattern, "item", "", "item directory glob pattern relative to src base")
+	fs.StringVar(&c.SrcPattern, "src", "", "whisper file glob pattern relative to item directory (ex. *.wsp).")
+	c.AggregateOptions.setFlags(fs)
+	fs.IntVar(&c.ArchiveID, "archive", ArchiveIDAll, "archive ID (-1 is all).")
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of copying data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.BoolVar(&c.ShowHeader, "header", true, "whether or not to show header (metadata and reteions)")
+	fs.BoolVar(&c.ShowCount, "show-count", false, "whether or not to show the number of non-NaN input values for each point")
+
+	fs.Var(&timestampValue{t: &c.From}, "from", "range start time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Until}, "until", "range end time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
+	fs.Parse(args)
+
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
+	if c.ItemPattern == "" {
+		return newRequiredOptionError(fs, "item")
+	}
+	if c.SrcBase == "" {
+		return newRequiredOptionError(fs, "src-base")
+	}
+	if c.SrcPattern == "" {
+		return newRequiredOptionError(fs, "src")
+	}
+	if c.Until != 0 && c.From > c.Until {
+		return errFromIsAfterUntil
+	}
+	if err := c.AggregateOptions.validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *AggregateCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *AggregateCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
+	items, err := globItems(c.SrcBase, c.ItemPattern)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		var until whispertool.Timestamp
+		if c.Until == 0 {
+			until = now
+		} else {
+			until = c.Until
+		}
+
+		tow.writeContext(tow.timestampField("now", now), textOutField{"item", item})
+		r, err := aggregateWhisperFile(c.SrcBase, item, c.SrcPattern, c.AggregateOptions, c.ShowCount, c.ArchiveID, c.From, until, now)
+		if err != nil {
+			return err
+		}
+		r.writeFileErrors(tow)
+		if c.ShowCount {
+			err = printFileDataWithCounts(tow, r.header, r.tsList, r.countTsList, c.ShowHeader)
+		} else {
+			err = printFileData(tow, r.header, r.tsList.PointsList(), c.ShowHeader)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printFileDataWithCounts prints aggregated points with the number of
+// contributors for each point.
+func printFileDataWithCounts(w *textOutWriter, h *whispertool.Header, tsList, countTsList TimeSeriesList, showHeader bool) error {
+	if showHeader {
+		if err := w.writeHeader(h); err != nil {
+			return err
+		}
+	}
+	for i, ts := range tsList {
+		if ts == nil {
+			continue
+		}
+		counts := countTsList[i].Values()
+		for j, p := range ts.Points() {
+			err := w.writeData(textOutField{"archive", i}, w.timestampField("t", p.Time),
+				textOutField{"val", p.Value}, textOutField{"count", int(counts[j])})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// aggregateResult is the result of aggregating whisper files of an item.
+type aggregateResult struct {
+	header *whispertool.Header
+	tsList TimeSeriesList
+	// countTsList is the number of contributors at each point.
+	// It is nil unless requested.
+	countTsList TimeSeriesList
+	// fileErrors is errors of whisper files skipped in aggregation.
+	// It is always empty for remote src since the server logs them.
+	fileErrors []aggregateFileError
+}
+
+// aggregateFileError is an error of a whisper file skipped in aggregation.
+type aggregateFileError struct {
+	filename string
+	err      error
+}
+
+// writeFileErrors writes errors of whisper files skipped in aggregation to tow.
+func (r *aggregateResult) writeFileErrors(tow *textOutWriter) {
+	for _, fe := range r.fileErrors {
+		tow.writeLog(textOutField{"msg", "skipped file"}, textOutField{"file", fe.filename},
+			textOutField{"err", fe.err.Error()})
+	}
+}
+
+// aggregateWhisperFile aggregates values of whisper files matching srcPattern
+// in the item directory with opts. baseDirOrURL is a local base directory or
+// the URL of "whispertool server". The result also has the number of
+// contributors at each point if withCounts is true.
+func aggregateWhisperFile(baseDirOrURL, item, srcPattern string, opts AggregateOptions, withCounts bool, archiveID int, from, until, now whispertool.Timestamp) (*aggregateResult, error) {
+	if isBaseURL(baseDirOrURL) {
+		return aggregateWhisperFileRemote(baseDirOrURL, item, srcPattern, opts, withCounts, archiveID, from, until, now)
+	}
+	r, err := aggregateWhisperFileLocal(baseDirOrURL, item, srcPattern, opts, archiveID, from, until, now)
+	if err != nil {
+		return nil, err
+	}
+	if !withCounts {
+		r.countTsList = nil
+	}
+	return r, nil
+}
+
+// aggregateFileData is the content of a whisper file read for aggregation.
+type aggregateFileData struct {
+	filename string
+	header   *whispertool.Header
+	tsList   TimeSeriesList
+	err      error
+}
+
+// aggregateWhisperFileLocal reads whisper files with at most
+// opts.ReadWorkers goroutines and folds them into an aggregateAccumulator
+// in the order of filenames, so that the result does not depend on the
+// timing of reads. Files being read and files read but not yet folded are
+// limited to opts.ReadWorkers in total to bound memory usage.
+func aggregateWhisperFileLocal(baseDir, item, srcPattern string, opts AggregateOptions, archiveID int, from, until, now whispertool.Timestamp) (*aggregateResult, error) {
+	itemRelDir := itemToRelDir(item)
+	srcFullPattern := filepath.Join(baseDir, itemRelDir, srcPattern)
+	srcFilenames, err := filepath.Glob(srcFullPattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(srcFilenames) == 0 {
+		return nil, &os.PathError{
+			Op:   "glob",
+			Path: srcFullPattern,
+			Err:  os.ErrNotExist,
+		}
+	}
+
+	workers := opts.readWorkers()
+	pending := make(chan chan aggregateFileData, workers)
+	// sem is released when the file data is folded, not when it is read.
+	sem := make(chan struct{}, workers)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(pending)
+		for _, srcFilename := range srcFilenames {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			}
+			ch := make(chan aggregateFileData, 1)
+			select {
+			case pending <- ch:
+			case <-done:
+				<-sem
+				return
+			}
+			go func(filename string) {
+				h, tsList, err := readWhisperFileLocal(filename, archiveID, from, until, now)
+				ch <- aggregateFileData{filename: filename, header: h, tsList: tsList, err: err}
+			}(srcFilename)
+		}
+	}()
+
+	acc := newAggregateAccumulator(&opts)
+	r := &aggregateResult{}
+	for ch := range pending {
+		d := <-ch
+		<-sem
+		err := d.err
+		if err == nil {
+			if err = acc.add(d.header, d.tsList); err != nil {
+				err = fmt.Errorf("%s: %w", d.filename, err)
+			}
+		}
+		if err != nil {
+			if opts.AbortOnFileError {
+				return nil, err
+			}
+			r.fileErrors = append(r.fileErrors, aggregateFileError{filename: d.filename, err: err})
+		}
+	}
+	if acc.inputCount == 0 {
+		return nil, r.fileErrors[0].err
+	}
+
+	r.header = acc.header
+	r.tsList, r.countTsList = acc.result()
+	return r, nil
+}
+
+// aggregateWhisperFileRemote requests "whispertool server" to aggregate.
+// The plain sum without counts is requested to the /sum endpoint so that
+// servers of older versions without the /aggregate endpoint can be used for it.
+func aggregateWhisperFileRemote(srcURL, item, srcPattern string, opts AggregateOptions, withCounts bool, archiveID int, from, until, now whispertool.Timestamp) (*aggregateResult, error) {
+	q := url.Values{}
+	q.Set("item", item)
+	q.Set("pattern", srcPattern)
+	q.Set("retention", strconv.Itoa(archiveID))
+	q.Set("from", from.String())
+	q.Set("until", until.String())
+	q.Set("now", now.String())
+	endpoint := "sum"
+	if !opts.isPlainSum() || withCounts {
+		endpoint = "aggregate"
+		opts.appendQuery(q)
+		if withCounts {
+			q.Set("counts", "1")
+		}
+	}
+	reqURL := fmt.Sprintf("%s/%s?%s", srcURL, endpoint, q.Encode())
+
+	h, data, err := getHeaderFromRemote(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	r := &aggregateResult{header: h}
+	r.tsList, data, err = takeTimeSeriesList(data, len(h.ArchiveInfoList()))
+	if err != nil {
+		return nil, err
+	}
+	if withCounts {
+		r.countTsList, _, err = takeTimeSeriesList(data, len(h.ArchiveInfoList()))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/hnakamur/whispertool"
+)
+
+var errAggregateArchiveInfoListUnalike = errors.New("archive configurations are unalike to the first file. " +
+	"Resize the input before aggregating")
+var errAggregateTimeRangeUnalike = errors.New("timeseries time ranges and steps are unalike to the first file " +
+	"and cannot be aligned")
+
+// aggregateAccumulator folds time series lists of whisper files one by one
+// into running states of aggregation, so that whisper files of an item
+// need not be kept in memory at the same time. Only median and percentile
+// functions keep non-NaN values of all files.
+type aggregateAccumulator struct {
+	opts       *AggregateOptions
+	header     *whispertool.Header
+	inputCount int
+	archives   []archiveAccumulator
+}
+
+type archiveAccumulator struct {
+	// timeRange has the time range and the step of the archive without
+	// values. It is nil if the archive is not fetched.
+	timeRange *whispertool.TimeSeries
+	partials  []aggregatePartial
+	values    [][]whispertool.Value
+}
+
+func newAggregateAccumulator(opts *AggregateOptions) *aggregateAccumulator {
+	return &aggregateAccumulator{opts: opts}
+}
+
+// add folds the header and time series list of a whisper file.
+// If the time ranges differ from the previous files, archives are
+// narrowed to the intersection of them. It returns an error without
+// folding if they are unalike to the first file and cannot be aligned.
+func (a *aggregateAccumulator) add(h *whispertool.Header, tsList TimeSeriesList) error {
+	if a.header == nil {
+		a.header = h
+		a.archives = make([]archiveAccumulator, len(tsList))
+		for i, ts := range tsList {
+			if ts == nil {
+				continue
+			}
+			acc := &a.archives[i]
+			acc.timeRange = whispertool.NewTimeSeries(ts.FromTime(), ts.UntilTime(), ts.Step(), nil)
+			acc.partials = make([]aggregatePartial, len(ts.Values()))
+			if a.opts.Func.needsValues() {
+				acc.values = make([][]whispertool.Value, len(ts.Values()))
+			}
+		}
+	} else {
+		if !a.header.ArchiveInfoList().Equal(h.ArchiveInfoList()) {
+			return errAggregateArchiveInfoListUnalike
+		}
+		if len(tsList) != len(a.archives) {
+			return errAggregateTimeRangeUnalike
+		}
+		for i, ts := range tsList {
+			timeRange := a.archives[i].timeRange
+			if (ts == nil) != (timeRange == nil) {
+				return errAggregateTimeRangeUnalike
+			}
+			if ts != nil {
+				if _, _, ok := intersectTimeRange(ts, timeRange); !ok {
+					return errAggregateTimeRangeUnalike
+				}
+			}
+		}
+	}
+
+	for i, ts := range tsList {
+		if ts == nil {
+			continue
+		}
+		acc := &a.archives[i]
+		if !ts.EqualTimeRangeAndStep(acc.timeRange) {
+			from, until, _ := intersectTimeRange(ts, acc.timeRange)
+			acc.narrow(from, until)
+			ts = sliceTimeSeries(ts, from, until)
+		}
+		for j, v := range ts.Values() {
+			if v.IsNaN() {
+				continue
+			}
+			acc.partials[j].add(v)
+			if acc.values != nil {
+				acc.values[j] = append(acc.values[j], v)
+			}
+		}
+	}
+	a.inputCount++
+	return nil
+}
+
+// narrow narrows the time range of acc to from and until which must be
+// within the current time range and aligned to the step.
+func (acc *archiveAccumulator) narrow(from, until whispertool.Timestamp) {
+	r := acc.timeRange
+	start := int(from.Sub(r.FromTime()) / r.Step())
+	end := int(until.Sub(r.FromTime()) / r.Step())
+	acc.partials = acc.partials[start:end]
+	if acc.values != nil {
+		acc.values = acc.values[start:end]
+	}
+	acc.timeRange = whispertool.NewTimeSeries(from, until, r.Step(), nil)
+}
+
+// result returns the aggregated time series and the number of
+// contributors at each point.
+func (a *aggregateAccumulator) result() (TimeSeriesList, TimeSeriesList) {
+	aggTsList := make(TimeSeriesList, len(a.archives))
+	countTsList := make(TimeSeriesList, len(a.archives))
+	for i := range a.archives {
+		acc := &a.archives[i]
+		if acc.timeRange == nil {
+			continue
+		}
+		aggValues := make([]whispertool.Value, len(acc.partials))
+		countValues := make([]whispertool.Value, len(acc.partials))
+		for j := range acc.partials {
+			var values []whispertool.Value
+			if acc.values != nil {
+				values = acc.values[j]
+			}
+			aggValues[j] = a.resultAt(acc.partials[j], values)
+			countValues[j] = whispertool.Value(acc.partials[j].count)
+		}
+		r := acc.timeRange
+		aggTsList[i] = whispertool.NewTimeSeries(r.FromTime(), r.UntilTime(), r.Step(), aggValues)
+		countTsList[i] = whispertool.NewTimeSeries(r.FromTime(), r.UntilTime(), r.Step(), countValues)
+	}
+	return aggTsList, countTsList
+}
+
+// resultAt returns the aggregated value at a point with the contributor
+// thresholds and the NaN policy of options.
+func (a *aggregateAccumulator) resultAt(p aggregatePartial, values []whispertool.Value) whispertool.Value {
+	var nan whispertool.Value
+	nan.SetNaN()
+	contributors := p.count
+	if contributors < a.opts.MinContributors ||
+		float64(contributors) < a.opts.MinContributorRatio*float64(a.inputCount) {
+		return nan
+	}
+	switch a.opts.NaNPolicy {
+	case AggregateNaNZero:
+		for k := contributors; k < a.inputCount; k++ {
+			p.add(0)
+			if values != nil {
+				values = append(values, 0)
+			}
+		}
+	case AggregateNaNPropagate:
+		if contributors < a.inputCount {
+			return nan
+		}
+	}
+	return a.opts.Func.result(&p, values)
+}
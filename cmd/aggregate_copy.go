@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"path/filepath"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+	"golang.org/x/sync/errgroup"
+)
+
+// AggregateCopyCommand aggregates values of whisper files in each item
+// directory with AggregateOptions and copies the result to the dest whisper file.
+type AggregateCopyCommand struct {
+	SrcBase           string
+	DestBase          string
+	ItemPattern       string
+	SrcPattern        string
+	DestRelPath       string
+	AggregationMethod whispertool.AggregationMethod
+	XFilesFactor      float32
+	ArchiveInfoList   whispertool.ArchiveInfoList
+	From              whispertool.Timestamp
+	Until             whispertool.Timestamp
+	Now               whispertool.Timestamp
+	ArchiveID         int
+	TextOut           string
+	Format            string
+	TimeFormat        TimeFormat
+	Workers           int
+	UndoLog           UndoLogOptions
+
+	// CountDestRelPath is the whisper filename relative to item directory
+	// to copy the number of contributors for each point. Empty means no copy.
+	CountDestRelPath string
+
+	AggregateOptions
+
+	undoLog *undoLogWriter
+}
+
+// SumCopyCommand is an alias of AggregateCopyCommand kept for the sum-copy
+// subcommand. It sums values unless Func is set.
+type SumCopyCommand = AggregateCopyCommand
+
+func (c *AggregateCopyCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.SrcBase, "src-base", "", "src base directory or web app URL of \"whispertool server\"")
+	fs.StringVar(&c.ItemPattern, "item", "", "item directory glob pattern relative to src base")
+	fs.StringVar(&c.SrcPattern, "src", "", "whisper file glob pattern relative to item directory (ex. *.wsp).")
+	c.AggregateOptions.setFlags(fs)
+	fs.StringVar(&c.DestBase, "dest-base", "", "dest base directory")
+	fs.StringVar(&c.DestRelPath, "dest", "", "dest whisper relative filename to item directory (ex. dest.wsp).")
+	fs.StringVar(&c.CountDestRelPath, "count-dest", "", "whisper relative filename to item directory for copying the number of non-NaN input values for each point (ex. count.wsp). empty means no copy.")
+
+	fs.Var(&aggregationMethodValue{&c.AggregationMethod}, "agg-method", "aggregation method")
+	fs.Var(&xFilesFactorValue{&c.XFilesFactor}, "x-files-factor", "xFilesFactor")
+	fs.Var(&archiveInfoListValue{&c.ArchiveInfoList}, "retentions", "retentions definitions")
+
+	fs.Var(&timestampValue{t: &c.From}, "from", "range start time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Until}, "until", "range end time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
+
+	fs.IntVar(&c.ArchiveID, "archive", ArchiveIDAll, "archive ID (-1 is all).")
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of copying data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.IntVar(&c.Workers, "workers", 1, workersUsage)
+	c.UndoLog.setFlags(fs)
+
+	fs.Parse(args)
+
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
+	if c.ItemPattern == "" {
+		return newRequiredOptionError(fs, "item")
+	}
+	if c.SrcBase == "" {
+		return newRequiredOptionError(fs, "src-base")
+	}
+	if c.SrcPattern == "" {
+		return newRequiredOptionError(fs, "src")
+	}
+	if c.DestBase == "" {
+		return newRequiredOptionError(fs, "dest-base")
+	}
+	if isBaseURL(c.DestBase) {
+		return errors.New("dest-base must be local directory")
+	}
+	if c.DestRelPath == "" {
+		return newRequiredOptionError(fs, "dest")
+	}
+	if c.AggregationMethod == 0 {
+		return newRequiredOptionError(fs, "agg-method")
+	}
+	if c.ArchiveInfoList == nil {
+		return newRequiredOptionError(fs, "retentions")
+	}
+	if c.CountDestRelPath == c.DestRelPath {
+		return errors.New("count-dest must be different from dest")
+	}
+	if err := validateUndoLogFormat(c.UndoLog.Format); err != nil {
+		return err
+	}
+	return c.AggregateOptions.validate()
+}
+
+func (c *AggregateCopyCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *AggregateCopyCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
+	t0 := time.Now()
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now))
+	var totalItemCount int
+	defer func() {
+		t1 := time.Now()
+		tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+			textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalItemCount", totalItemCount})
+	}()
+
+	c.undoLog, err = openUndoLog(c.UndoLog)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err2 := c.undoLog.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	items, err := globItems(c.SrcBase, c.ItemPattern)
+	if err != nil {
+		return err
+	}
+	totalItemCount = len(items)
+	return runOrderedTasks(tow, len(items), c.Workers, func(i int, tow *textOutWriter) error {
+		return c.aggregateCopyItem(items[i], now, tow)
+	}, func(err error) error {
+		return err
+	})
+}
+
+func (c *AggregateCopyCommand) aggregateCopyItem(item string, now whispertool.Timestamp, tow *textOutWriter) error {
+	var until whispertool.Timestamp
+	if c.Until == 0 {
+		until = now
+	} else {
+		until = c.Until
+	}
+
+	tow.writeContext(tow.timestampField("now", now), textOutField{"item", item})
+	itemRelDir := itemToRelDir(item)
+
+	destHeaderForCreate, err := whispertool.NewHeader(c.AggregationMethod, c.XFilesFactor, c.ArchiveInfoList)
+	if err != nil {
+		return err
+	}
+	var destDB *whispertool.Whisper
+	defer func() {
+		if destDB != nil {
+			destDB.Close()
+		}
+	}()
+	var aggResult *aggregateResult
+	var destTsList TimeSeriesList
+	var eg errgroup.Group
+	eg.Go(func() error {
+		var err error
+		aggResult, err = aggregateWhisperFile(c.SrcBase, itemRelDir, c.SrcPattern,
+			c.AggregateOptions, c.CountDestRelPath != "", c.ArchiveID, c.From, until, now)
+		return err
+	})
+	eg.Go(func() error {
+		destFullPath := filepath.Join(c.DestBase, itemRelDir, c.DestRelPath)
+		var err error
+		destDB, err = openOrCreateCopyDestFile(destFullPath, destHeaderForCreate)
+		if err != nil {
+			return err
+		}
+		destTsList, err = fetchTimeSeriesList(destDB, c.ArchiveID, c.From, until, now)
+		return err
+	})
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	if !aggResult.header.ArchiveInfoList().Equal(destDB.Header().ArchiveInfoList()) {
+		return errors.New("archive info list unmatch between src and dest whisper files")
+	}
+	srcTsList, destTsList, ok := aggResult.tsList.alignTimeRanges(destTsList)
+	if !ok {
+		return errTimeRangeUnalike
+	}
+	aggResult.writeFileErrors(tow)
+	srcHeader := aggResult.header
+
+	if c.CountDestRelPath != "" {
+		countRelPath := filepath.Join(itemRelDir, c.CountDestRelPath)
+		if err := c.copyCounts(countRelPath, destHeaderForCreate, aggResult.countTsList, until, now); err != nil {
+			return err
+		}
+	}
+
+	srcPlDif, destPlDif := srcTsList.Diff(destTsList)
+	if srcPlDif.AllEmpty() && destPlDif.AllEmpty() {
+		return nil
+	}
+
+	if err := c.undoLog.write(filepath.Join(itemRelDir, c.DestRelPath), destPlDif); err != nil {
+		return err
+	}
+	if err := updateFileDataWithPointsList(destDB, srcPlDif, now); err != nil {
+		return err
+	}
+
+	if err := printFileData(tow, srcHeader, srcPlDif, true); err != nil {
+		return err
+	}
+
+	if err := destDB.Sync(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// copyCounts copies the number of contributors to the whisper file at
+// relPath to dest base which is created with h if it does not exist.
+func (c *AggregateCopyCommand) copyCounts(relPath string, h *whispertool.Header, countTsList TimeSeriesList, until, now whispertool.Timestamp) error {
+	db, err := openOrCreateCopyDestFile(filepath.Join(c.DestBase, relPath), h)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if !db.ArchiveInfoList().Equal(h.ArchiveInfoList()) {
+		return errors.New("archive info list unmatch between src and count whisper files")
+	}
+	tsList, err := fetchTimeSeriesList(db, c.ArchiveID, c.From, until, now)
+	if err != nil {
+		return err
+	}
+	countTsList, tsList, ok := countTsList.alignTimeRanges(tsList)
+	if !ok {
+		return errTimeRangeUnalike
+	}
+
+	countPlDif, prevPlDif := countTsList.Diff(tsList)
+	if countPlDif.AllEmpty() {
+		return nil
+	}
+	if err := c.undoLog.write(relPath, prevPlDif); err != nil {
+		return err
+	}
+	if err := updateFileDataWithPointsList(db, countPlDif, now); err != nil {
+		return err
+	}
+	return db.Sync()
+}
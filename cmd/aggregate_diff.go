@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+	"golang.org/x/sync/errgroup"
+)
+
+// AggregateDiffCommand aggregates values of whisper files in each item
+// directory with AggregateOptions and compares the result to the dest whisper file.
+type AggregateDiffCommand struct {
+	SrcBase     string
+	ItemPattern string
+	SrcPattern  string
+	DestBase    string
+	DestRelPath string
+	From        whispertool.Timestamp
+	Until       whispertool.Timestamp
+	Now         whispertool.Timestamp
+	ArchiveID   int
+	TextOut     string
+	Format      string
+	TimeFormat  TimeFormat
+	Workers     int
+	Tolerance   whispertool.Tolerance
+	Summary     bool
+	Report      string
+
+	AggregateOptions
+}
+
+// SumDiffCommand is an alias of AggregateDiffCommand kept for the sum-diff
+// subcommand. It sums values unless Func is set.
+type SumDiffCommand = AggregateDiffCommand
+
+func (c *AggregateDiffCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.SrcBase, "src-base", "", "src base directory or URL of \"whispertool server\"")
+	fs.StringVar(&c.ItemPattern, "item", "", "item directory glob pattern relative to src base")
+	fs.StringVar(&c.SrcPattern, "src", "", "whisper file glob pattern relative to item directory (ex. *.wsp).")
+	c.AggregateOptions.setFlags(fs)
+	fs.StringVar(&c.DestBase, "dest-base", "", "dest base directory or URL of \"whispertool server\"")
+	fs.StringVar(&c.DestRelPath, "dest", "", "dest whisper filename relative to item directory (ex. sum.wsp).")
+	fs.IntVar(&c.ArchiveID, "archive", ArchiveIDAll, "archive ID (-1 is all).")
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of diff. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.IntVar(&c.Workers, "workers", 1, workersUsage)
+	setToleranceFlags(fs, &c.Tolerance)
+	fs.BoolVar(&c.Summary, "summary", false, diffSummaryUsage)
+	fs.StringVar(&c.Report, "report", "", diffReportUsage)
+
+	fs.Var(&timestampValue{t: &c.From}, "from", "range start time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Until}, "until", "range end time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
+
+	fs.Parse(args)
+
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
+	if c.ItemPattern == "" {
+		return newRequiredOptionError(fs, "item")
+	}
+	if c.SrcBase == "" {
+		return newRequiredOptionError(fs, "src-base")
+	}
+	if c.SrcPattern == "" {
+		return newRequiredOptionError(fs, "src")
+	}
+	if c.DestBase == "" {
+		return newRequiredOptionError(fs, "dest-base")
+	}
+	if c.DestRelPath == "" {
+		return newRequiredOptionError(fs, "dest")
+	}
+	if err := validateTolerance(c.Tolerance); err != nil {
+		return err
+	}
+	return c.AggregateOptions.validate()
+}
+
+func (c *AggregateDiffCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *AggregateDiffCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
+	t0 := time.Now()
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now))
+	var totalItemCount int
+	diffFound := false
+	defer func() {
+		t1 := time.Now()
+		tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+			textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalItemCount", totalItemCount},
+			textOutField{"diffFound", diffFound})
+	}()
+
+	items, err := globItems(c.SrcBase, c.ItemPattern)
+	if err != nil {
+		return WrapFileNotExistError(Source, err)
+	}
+	totalItemCount = len(items)
+	itemReports := make([]*diffFileReport, len(items))
+	err = runOrderedTasks(tow, len(items), c.Workers, func(i int, tow *textOutWriter) error {
+		var err error
+		itemReports[i], err = c.aggregateDiffItem(items[i], now, tow)
+		return err
+	}, func(err error) error {
+		if errors.Is(err, ErrDiffFound) {
+			diffFound = true
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if c.Report != "" {
+		if err := writeDiffReport(c.Report, newDiffReport(now, itemReports)); err != nil {
+			return err
+		}
+	}
+	if diffFound {
+		return ErrDiffFound
+	}
+	return nil
+}
+
+// aggregateDiffItem returns ErrDiffFound and the report of the item
+// if the aggregated values and dest file are different.
+func (c *AggregateDiffCommand) aggregateDiffItem(item string, now whispertool.Timestamp, tow *textOutWriter) (*diffFileReport, error) {
+	var until whispertool.Timestamp
+	if c.Until == 0 {
+		until = now
+	} else {
+		until = c.Until
+	}
+
+	tow.writeContext(tow.timestampField("now", now), textOutField{"item", item})
+
+	var aggResult *aggregateResult
+	var destHeader *whispertool.Header
+	var destTsList TimeSeriesList
+	var g errgroup.Group
+	g.Go(func() error {
+		var err error
+		aggResult, err = aggregateWhisperFile(c.SrcBase, item, c.SrcPattern, c.AggregateOptions, false, c.ArchiveID, c.From, until, now)
+		return WrapFileNotExistError(Source, err)
+	})
+	g.Go(func() error {
+		var err error
+		destRelPath := filepath.Join(itemToRelDir(item), c.DestRelPath)
+		destHeader, destTsList, err = readWhisperFile(c.DestBase, destRelPath, c.ArchiveID, c.From, until, now)
+		return WrapFileNotExistError(Destination, err)
+	})
+	if err := g.Wait(); err != nil {
+		if err2 := AsFileNotExistError(err); err2 != nil {
+			tow.writeLog(textOutField{"err", err2.cause.Error()}, textOutField{"srcOrDest", err2.srcOrDest.String()})
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !aggResult.header.ArchiveInfoList().Equal(destHeader.ArchiveInfoList()) {
+		return nil, errors.New("retentions unmatch between src and dest whisper files")
+	}
+	aggTsList, destTsList, ok := aggResult.tsList.alignTimeRanges(destTsList)
+	if !ok {
+		return nil, errTimeRangeUnalike
+	}
+	aggResult.writeFileErrors(tow)
+	aggHeader := aggResult.header
+
+	aggPlDif, destPlDif := aggTsList.DiffWithTolerance(destTsList, c.Tolerance)
+	if aggPlDif.AllEmpty() && destPlDif.AllEmpty() {
+		return nil, nil
+	}
+
+	itemReport := &diffFileReport{Item: item, Archives: summarizeDiff(aggPlDif, destPlDif)}
+	if c.Summary {
+		if err := printDiffSummary(tow, itemReport.Archives); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := printDiff(tow, aggHeader, destHeader, aggPlDif, destPlDif); err != nil {
+			return nil, err
+		}
+	}
+
+	return itemReport, ErrDiffFound
+}
+
+func printPointsListAppend(textOut string, itemName string, h *whispertool.Header, ptsList PointsList) error {
+	if textOut == "" {
+		return nil
+	}
+
+	if textOut == "-" {
+		return printPointsListAppendTo(os.Stdout, itemName, h, ptsList)
+	}
+
+	file, err := os.OpenFile(textOut, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	err = printPointsListAppendTo(w, itemName, h, ptsList)
+	if err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func printPointsListAppendTo(w io.Writer, itemName string, h *whispertool.Header, ptsList PointsList) error {
+	if _, err := fmt.Fprintf(w, "item:%s\n", itemName); err != nil {
+		return err
+	}
+	for archiveID := range h.ArchiveInfoList() {
+		for _, pts := range ptsList {
+			for _, pt := range pts {
+				if _, err := fmt.Fprintf(w, "archive:%d\tt:%s\tvalue:%s\n", archiveID, pt.Time, pt.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func itemToRelDir(item string) string {
+	return strings.ReplaceAll(item, ".", string(filepath.Separator))
+}
+
+func relDirToItem(relDir string) string {
+	return strings.ReplaceAll(relDir, string(filepath.Separator), ".")
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hnakamur/whispertool"
+)
+
+const aggregateFuncUsage = `function to aggregate values of whisper files at each point. ` +
+	`one of "sum", "avg", "min", "max", "count", "median" or "pN" for N-th percentile (ex. p95, p99.9)`
+
+var errInvalidAggregateFunc = errors.New(`aggregate function must be one of "sum", "avg", "min", "max", "count", "median" or "pN" where 0 < N <= 100`)
+
+const (
+	aggregateFuncNameSum        = "sum"
+	aggregateFuncNameAvg        = "avg"
+	aggregateFuncNameMin        = "min"
+	aggregateFuncNameMax        = "max"
+	aggregateFuncNameCount      = "count"
+	aggregateFuncNameMedian     = "median"
+	aggregateFuncNamePercentile = "p"
+)
+
+// AggregateFunc is a function to aggregate values of whisper files at
+// the same time into one value. NaN values are ignored as absent values.
+// The zero value is the sum function.
+type AggregateFunc struct {
+	name string
+	// percentile is N of the N-th percentile function.
+	percentile float64
+}
+
+// ParseAggregateFunc parses the name of an aggregate function.
+func ParseAggregateFunc(s string) (AggregateFunc, error) {
+	switch s {
+	case aggregateFuncNameSum, aggregateFuncNameAvg, aggregateFuncNameMin,
+		aggregateFuncNameMax, aggregateFuncNameCount, aggregateFuncNameMedian:
+		return AggregateFunc{name: s}, nil
+	}
+	if !strings.HasPrefix(s, aggregateFuncNamePercentile) {
+		return AggregateFunc{}, errInvalidAggregateFunc
+	}
+	n, err := strconv.ParseFloat(s[len(aggregateFuncNamePercentile):], 64)
+	if err != nil || !(0 < n && n <= 100) {
+		return AggregateFunc{}, errInvalidAggregateFunc
+	}
+	return AggregateFunc{name: aggregateFuncNamePercentile, percentile: n}, nil
+}
+
+func (f AggregateFunc) String() string {
+	switch f.name {
+	case "":
+		return aggregateFuncNameSum
+	case aggregateFuncNamePercentile:
+		return aggregateFuncNamePercentile + strconv.FormatFloat(f.percentile, 'f', -1, 64)
+	default:
+		return f.name
+	}
+}
+
+// IsSum returns whether or not f is the sum function.
+func (f AggregateFunc) IsSum() bool {
+	return f.name == "" || f.name == aggregateFuncNameSum
+}
+
+// needsValues returns whether or not f needs all input values at a point
+// instead of an aggregatePartial.
+func (f AggregateFunc) needsValues() bool {
+	return f.name == aggregateFuncNameMedian || f.name == aggregateFuncNamePercentile
+}
+
+// result returns the aggregated value from p, or from values if
+// f.needsValues() is true. values must not contain NaN and may be
+// reordered. It returns NaN for no inputs except for the count function.
+func (f AggregateFunc) result(p *aggregatePartial, values []whispertool.Value) whispertool.Value {
+	if f.name == aggregateFuncNameCount {
+		return whispertool.Value(p.count)
+	}
+	if p.count == 0 {
+		var v whispertool.Value
+		v.SetNaN()
+		return v
+	}
+
+	switch f.name {
+	case aggregateFuncNameAvg:
+		return p.sum / whispertool.Value(p.count)
+	case aggregateFuncNameMin:
+		return p.min
+	case aggregateFuncNameMax:
+		return p.max
+	case aggregateFuncNameMedian:
+		sortValues(values)
+		n := len(values)
+		if n%2 == 1 {
+			return values[n/2]
+		}
+		return (values[n/2-1] + values[n/2]) / 2
+	case aggregateFuncNamePercentile:
+		sortValues(values)
+		return percentileOfSortedValues(values, f.percentile)
+	default:
+		return p.sum
+	}
+}
+
+// aggregatePartial is the running state of aggregation at a point
+// which is enough for functions except for median and percentile.
+type aggregatePartial struct {
+	count int
+	sum   whispertool.Value
+	min   whispertool.Value
+	max   whispertool.Value
+}
+
+func (p *aggregatePartial) add(v whispertool.Value) {
+	if p.count == 0 || v < p.min {
+		p.min = v
+	}
+	if p.count == 0 || v > p.max {
+		p.max = v
+	}
+	p.sum += v
+	p.count++
+}
+
+func sortValues(values []whispertool.Value) {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+}
+
+// percentileOfSortedValues returns the n-th percentile of sorted values
+// with the nearest rank method without interpolation, which is the same
+// as percentileOfSeries of Graphite.
+func percentileOfSortedValues(sorted []whispertool.Value, n float64) whispertool.Value {
+	rank := int(math.Ceil(n / 100 * float64(len(sorted)+1)))
+	if rank <= 0 {
+		return sorted[0]
+	}
+	if rank > len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[rank-1]
+}
+
+type aggregateFuncValue struct {
+	f *AggregateFunc
+}
+
+func (v aggregateFuncValue) String() string {
+	if v.f == nil {
+		return ""
+	}
+	return v.f.String()
+}
+
+func (v aggregateFuncValue) Set(s string) error {
+	f, err := ParseAggregateFunc(s)
+	if err != nil {
+		return err
+	}
+	*v.f = f
+	return nil
+}
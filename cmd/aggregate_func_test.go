@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestParseAggregateFunc(t *testing.T) {
+	testCases := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "sum", want: "sum"},
+		{input: "avg", want: "avg"},
+		{input: "median", want: "median"},
+		{input: "p95", want: "p95"},
+		{input: "p99.9", want: "p99.9"},
+		{input: "p100", want: "p100"},
+		{input: "p0", wantErr: true},
+		{input: "p101", wantErr: true},
+		{input: "p", wantErr: true},
+		{input: "average", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := ParseAggregateFunc(tc.input)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("should get error for input %q", tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for input %q: %s", tc.input, err)
+		} else if got.String() != tc.want {
+			t.Errorf("result unmatch for input %q, got=%s, want=%s", tc.input, got, tc.want)
+		}
+	}
+
+	var zero AggregateFunc
+	if !zero.IsSum() || zero.String() != "sum" {
+		t.Errorf("zero value must be sum, got=%s", zero)
+	}
+}
+
+func TestAggregateAccumulator(t *testing.T) {
+	nan := whispertool.Value(math.NaN())
+	fromTime, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	untilTime := fromTime.Add(4 * whispertool.Minute)
+	inputs := [][]whispertool.Value{
+		{1, 5, nan, nan},
+		{2, nan, nan, 7},
+		{3, 1, nan, 8},
+		{10, 2, nan, 9},
+	}
+	h, err := whispertool.NewHeader(whispertool.Sum, 0, whispertool.ArchiveInfoList{whispertool.NewArchiveInfo(whispertool.Minute, 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsListList := make([]TimeSeriesList, len(inputs))
+	for i, values := range inputs {
+		tsListList[i] = TimeSeriesList{whispertool.NewTimeSeries(fromTime, untilTime, whispertool.Minute, values)}
+	}
+
+	testCases := []struct {
+		fn   string
+		want string
+	}{
+		{fn: "sum", want: "[16,8,null,24]"},
+		{fn: "avg", want: "[4,2.6666666666666665,null,8]"},
+		{fn: "min", want: "[1,1,null,7]"},
+		{fn: "max", want: "[10,5,null,9]"},
+		{fn: "count", want: "[4,3,0,3]"},
+		{fn: "median", want: "[2.5,2,null,8]"},
+		{fn: "p50", want: "[3,2,null,8]"},
+		{fn: "p90", want: "[10,5,null,9]"},
+		{fn: "p10", want: "[1,1,null,7]"},
+	}
+	for _, tc := range testCases {
+		fn, err := ParseAggregateFunc(tc.fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		acc := newAggregateAccumulator(&AggregateOptions{Func: fn})
+		for _, tsList := range tsListList {
+			if err := acc.add(h, tsList); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tsList, _ := acc.result()
+		got, err := json.Marshal(tsList[0].Values())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("values unmatch for func %s, got=%s, want=%s", tc.fn, got, tc.want)
+		}
+		if !tsList[0].EqualTimeRangeAndStep(tsListList[0][0]) {
+			t.Errorf("time range unmatch for func %s", tc.fn)
+		}
+	}
+}
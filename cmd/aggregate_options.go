@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"net/url"
+	"strconv"
+)
+
+// AggregateNaNPolicy is how NaN input values are treated in aggregation.
+// The zero value is the same as AggregateNaNSkip.
+type AggregateNaNPolicy string
+
+const (
+	// AggregateNaNSkip ignores NaN input values as absent values.
+	AggregateNaNSkip AggregateNaNPolicy = "skip"
+	// AggregateNaNZero treats NaN input values as zero.
+	AggregateNaNZero AggregateNaNPolicy = "zero"
+	// AggregateNaNPropagate makes the aggregated value NaN if any of
+	// input values is NaN.
+	AggregateNaNPropagate AggregateNaNPolicy = "propagate"
+)
+
+const aggregateNaNPolicyUsage = `how NaN input values are treated. "skip" ignores them, ` +
+	`"zero" treats them as zero and "propagate" makes the aggregated value NaN`
+
+var errInvalidAggregateNaNPolicy = errors.New(`nan policy must be one of "skip", "zero" or "propagate"`)
+
+// ParseAggregateNaNPolicy parses s as AggregateNaNPolicy.
+func ParseAggregateNaNPolicy(s string) (AggregateNaNPolicy, error) {
+	switch p := AggregateNaNPolicy(s); p {
+	case AggregateNaNSkip, AggregateNaNZero, AggregateNaNPropagate:
+		return p, nil
+	default:
+		return "", errInvalidAggregateNaNPolicy
+	}
+}
+
+func (p AggregateNaNPolicy) String() string {
+	if p == "" {
+		return string(AggregateNaNSkip)
+	}
+	return string(p)
+}
+
+type aggregateNaNPolicyValue struct {
+	p *AggregateNaNPolicy
+}
+
+func (v aggregateNaNPolicyValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return v.p.String()
+}
+
+func (v aggregateNaNPolicyValue) Set(s string) error {
+	p, err := ParseAggregateNaNPolicy(s)
+	if err != nil {
+		return err
+	}
+	*v.p = p
+	return nil
+}
+
+// AggregateOptions is options to aggregate values of whisper files at
+// each point. Contributors of a point are the input files whose values
+// are not NaN at the point.
+type AggregateOptions struct {
+	Func AggregateFunc
+
+	// MinContributors is the minimum number of contributors.
+	// The aggregated value is NaN for points with fewer contributors.
+	MinContributors int
+
+	// MinContributorRatio is the minimum ratio of contributors to input
+	// files like xFilesFactor. The aggregated value is NaN for points
+	// with the lower ratio.
+	MinContributorRatio float64
+
+	NaNPolicy AggregateNaNPolicy
+
+	// ReadWorkers is the maximum number of whisper files of an item read
+	// concurrently. Zero or negative means defaultAggregateReadWorkers.
+	ReadWorkers int
+
+	// AbortOnFileError makes aggregation of an item fail when any of its
+	// whisper files cannot be read or is unalike to others. Otherwise such
+	// files are skipped and reported.
+	AbortOnFileError bool
+}
+
+// defaultAggregateReadWorkers is the default maximum number of whisper
+// files of an item read concurrently.
+const defaultAggregateReadWorkers = 16
+
+func (o *AggregateOptions) setFlags(fs *flag.FlagSet) {
+	fs.Var(&aggregateFuncValue{&o.Func}, "func", aggregateFuncUsage)
+	fs.IntVar(&o.MinContributors, "min-contributors", 0,
+		"minimum number of non-NaN input values for each point. the aggregated value is NaN for points with fewer ones.")
+	fs.Float64Var(&o.MinContributorRatio, "min-contributor-ratio", 0,
+		"minimum ratio of non-NaN input values to input files for each point (0.0 to 1.0) like xFilesFactor.")
+	fs.Var(&aggregateNaNPolicyValue{&o.NaNPolicy}, "nan-policy", aggregateNaNPolicyUsage)
+	fs.IntVar(&o.ReadWorkers, "read-workers", defaultAggregateReadWorkers,
+		"maximum number of whisper files of an item read concurrently. ignored for remote src.")
+	fs.BoolVar(&o.AbortOnFileError, "abort-on-file-error", false,
+		"fail an item when any of its whisper files cannot be read or is unalike to others, instead of skipping the files.")
+}
+
+func (o *AggregateOptions) readWorkers() int {
+	if o.ReadWorkers <= 0 {
+		return defaultAggregateReadWorkers
+	}
+	return o.ReadWorkers
+}
+
+func (o *AggregateOptions) validate() error {
+	if o.MinContributors < 0 {
+		return errors.New("min-contributors must not be negative")
+	}
+	if o.MinContributorRatio < 0 || 1 < o.MinContributorRatio {
+		return errors.New("min-contributor-ratio must be between 0.0 and 1.0")
+	}
+	return nil
+}
+
+// isPlainSum returns whether or not o is the sum without other options,
+// which is supported by the /sum endpoint of "whispertool server".
+func (o *AggregateOptions) isPlainSum() bool {
+	return o.Func.IsSum() && o.MinContributors == 0 && o.MinContributorRatio == 0 &&
+		o.NaNPolicy.String() == string(AggregateNaNSkip) && !o.AbortOnFileError
+}
+
+// appendQuery sets o except for ReadWorkers to query parameters of the
+// /aggregate endpoint.
+func (o *AggregateOptions) appendQuery(q url.Values) {
+	q.Set("func", o.Func.String())
+	if o.MinContributors != 0 {
+		q.Set("min-contributors", strconv.Itoa(o.MinContributors))
+	}
+	if o.MinContributorRatio != 0 {
+		q.Set("min-contributor-ratio", strconv.FormatFloat(o.MinContributorRatio, 'g', -1, 64))
+	}
+	q.Set("nan-policy", o.NaNPolicy.String())
+	if o.AbortOnFileError {
+		q.Set("abort-on-file-error", "1")
+	}
+}
+
+// parseAggregateOptionsQuery parses query parameters set by appendQuery.
+// Omitted parameters are the default values. ReadWorkers is not a query
+// parameter since it is up to the server.
+func parseAggregateOptionsQuery(q url.Values) (AggregateOptions, error) {
+	var o AggregateOptions
+	var err error
+	if s := q.Get("func"); s != "" {
+		if o.Func, err = ParseAggregateFunc(s); err != nil {
+			return o, err
+		}
+	}
+	if s := q.Get("min-contributors"); s != "" {
+		if o.MinContributors, err = strconv.Atoi(s); err != nil {
+			return o, errors.New("invalid min-contributors")
+		}
+	}
+	if s := q.Get("min-contributor-ratio"); s != "" {
+		if o.MinContributorRatio, err = strconv.ParseFloat(s, 64); err != nil {
+			return o, errors.New("invalid min-contributor-ratio")
+		}
+	}
+	if s := q.Get("nan-policy"); s != "" {
+		if o.NaNPolicy, err = ParseAggregateNaNPolicy(s); err != nil {
+			return o, err
+		}
+	}
+	o.AbortOnFileError = q.Get("abort-on-file-error") == "1"
+	return o, o.validate()
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestAggregateOptionsAggregate(t *testing.T) {
+	nan := whispertool.Value(math.NaN())
+	inputs := []whispertool.Value{1, nan, 3, nan}
+
+	testCases := []struct {
+		opts      AggregateOptions
+		want      string
+		wantCount int
+	}{
+		{opts: AggregateOptions{}, want: "4", wantCount: 2},
+		{opts: AggregateOptions{MinContributors: 2}, want: "4", wantCount: 2},
+		{opts: AggregateOptions{MinContributors: 3}, want: "NaN", wantCount: 2},
+		{opts: AggregateOptions{MinContributorRatio: 0.5}, want: "4", wantCount: 2},
+		{opts: AggregateOptions{MinContributorRatio: 0.75}, want: "NaN", wantCount: 2},
+		{opts: AggregateOptions{Func: AggregateFunc{name: aggregateFuncNameAvg}}, want: "2", wantCount: 2},
+		{opts: AggregateOptions{Func: AggregateFunc{name: aggregateFuncNameAvg}, NaNPolicy: AggregateNaNZero}, want: "1", wantCount: 2},
+		{opts: AggregateOptions{NaNPolicy: AggregateNaNPropagate}, want: "NaN", wantCount: 2},
+	}
+	for _, tc := range testCases {
+		got, gotCount := aggregateTestValues(t, tc.opts, inputs)
+		if got.String() != tc.want || gotCount != tc.wantCount {
+			t.Errorf("result unmatch for opts %+v, got=%s,%d, want=%s,%d", tc.opts, got, gotCount, tc.want, tc.wantCount)
+		}
+	}
+
+	got, _ := aggregateTestValues(t, AggregateOptions{NaNPolicy: AggregateNaNPropagate}, []whispertool.Value{1, 2})
+	if got != 3 {
+		t.Errorf("result unmatch for propagate without NaN, got=%s, want=3", got)
+	}
+}
+
+// aggregateTestValues aggregates inputs as values at a point of files.
+func aggregateTestValues(t *testing.T, opts AggregateOptions, inputs []whispertool.Value) (whispertool.Value, int) {
+	t.Helper()
+	h, err := whispertool.NewHeader(whispertool.Sum, 0, whispertool.ArchiveInfoList{whispertool.NewArchiveInfo(whispertool.Minute, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := newAggregateAccumulator(&opts)
+	for _, v := range inputs {
+		ts := whispertool.NewTimeSeries(60, 120, whispertool.Minute, []whispertool.Value{v})
+		if err := acc.add(h, TimeSeriesList{ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tsList, countTsList := acc.result()
+	return tsList[0].Values()[0], int(countTsList[0].Values()[0])
+}
+
+func TestAggregateWhisperFileRemote(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:3m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := whispertool.NewHeader(whispertool.Sum, 0, archiveInfoList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := [][]whispertool.Value{{1, 2, 3}, {4, 5}, {7}}
+	for i, values := range inputs {
+		db, err := createUpdateDestFile(filepath.Join(dir, "item", string(rune('a'+i))+".wsp"), h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var points whispertool.Points
+		for j, v := range values {
+			points = append(points, whispertool.Point{Time: now - whispertool.Timestamp(60*(len(values)-j-1)), Value: v})
+		}
+		if err := db.UpdatePointsForArchive(points, 0, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := &app{baseDir: dir}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sum", wrapHandler(a.handleAggregate))
+	mux.HandleFunc("/aggregate", wrapHandler(a.handleAggregate))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	testCases := []struct {
+		opts       AggregateOptions
+		withCounts bool
+		want       string
+		wantCounts string
+	}{
+		{opts: AggregateOptions{}, want: "[1,6,15]"},
+		{opts: AggregateOptions{MinContributors: 2}, withCounts: true, want: "[null,6,15]", wantCounts: "[1,2,3]"},
+		{opts: AggregateOptions{Func: AggregateFunc{name: aggregateFuncNameMax}, NaNPolicy: AggregateNaNPropagate}, want: "[null,null,7]"},
+	}
+	for _, tc := range testCases {
+		for _, base := range []string{dir, server.URL} {
+			r, err := aggregateWhisperFile(base, "item", "*.wsp", tc.opts, tc.withCounts,
+				ArchiveIDAll, now-180, now, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tsList, countTsList := r.tsList, r.countTsList
+			got, err := json.Marshal(tsList[0].Values())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("values unmatch for opts %+v, base=%s, got=%s, want=%s", tc.opts, base, got, tc.want)
+			}
+			if !tc.withCounts {
+				if countTsList != nil {
+					t.Errorf("counts should be nil for opts %+v, base=%s", tc.opts, base)
+				}
+				continue
+			}
+			gotCounts, err := json.Marshal(countTsList[0].Values())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(gotCounts) != tc.wantCounts {
+				t.Errorf("counts unmatch for opts %+v, base=%s, got=%s, want=%s", tc.opts, base, gotCounts, tc.wantCounts)
+			}
+		}
+	}
+}
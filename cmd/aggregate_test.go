@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestAggregateWhisperFileLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile := func(name, retentions string, value whispertool.Value) {
+		archiveInfoList, err := whispertool.ParseArchiveInfoList(retentions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := whispertool.NewHeader(whispertool.Sum, 0, archiveInfoList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db, err := createUpdateDestFile(filepath.Join(dir, "item", name), h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdatePointsForArchive(whispertool.Points{{Time: now, Value: value}}, 0, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		writeFile(string(rune('a'+i))+".wsp", "1m:2m", whispertool.Value(i+1))
+	}
+	writeFile("other-retentions.wsp", "1m:3m", 100)
+	if err := ioutil.WriteFile(filepath.Join(dir, "item", "corrupt.wsp"), []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 3, 100} {
+		r, err := aggregateWhisperFileLocal(dir, "item", "*.wsp", AggregateOptions{ReadWorkers: workers},
+			ArchiveIDAll, now-120, now, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(r.tsList[0].Values())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "[null,36]"; string(got) != want {
+			t.Errorf("values unmatch for workers %d, got=%s, want=%s", workers, got, want)
+		}
+		var skipped []string
+		for _, fe := range r.fileErrors {
+			skipped = append(skipped, filepath.Base(fe.filename))
+		}
+		if got, want := len(skipped), 2; got != want || skipped[0] != "corrupt.wsp" || skipped[1] != "other-retentions.wsp" {
+			t.Errorf("skipped files unmatch for workers %d, got=%v", workers, skipped)
+		}
+	}
+
+	if _, err := aggregateWhisperFileLocal(dir, "item", "*.wsp", AggregateOptions{AbortOnFileError: true},
+		ArchiveIDAll, now-120, now, now); err == nil {
+		t.Errorf("should get error with AbortOnFileError")
+	}
+	if _, err := aggregateWhisperFileLocal(dir, "item", "corrupt.wsp", AggregateOptions{},
+		ArchiveIDAll, now-120, now, now); err == nil {
+		t.Errorf("should get error when all files are skipped")
+	}
+}
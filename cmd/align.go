@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/hnakamur/whispertool"
+)
+
+var errTimeRangeUnalike = errors.New("timeseries time ranges and steps are unalike and cannot be aligned")
+
+// alignTimeRanges returns tl and ul whose time series are sliced to the
+// intersection of the time ranges of the same archive. Archives which are
+// not fetched must be nil in both. Both lists must be fetched with the same
+// now, so that their ranges differ only at archive boundaries. It returns
+// false if any of the time ranges cannot be intersected.
+func (tl TimeSeriesList) alignTimeRanges(ul TimeSeriesList) (TimeSeriesList, TimeSeriesList, bool) {
+	if len(tl) != len(ul) {
+		return nil, nil, false
+	}
+
+	tl2 := make(TimeSeriesList, len(tl))
+	ul2 := make(TimeSeriesList, len(ul))
+	for i, ts := range tl {
+		us := ul[i]
+		if ts == nil || us == nil {
+			if ts != us {
+				return nil, nil, false
+			}
+			continue
+		}
+		from, until, ok := intersectTimeRange(ts, us)
+		if !ok {
+			return nil, nil, false
+		}
+		tl2[i] = sliceTimeSeries(ts, from, until)
+		ul2[i] = sliceTimeSeries(us, from, until)
+	}
+	return tl2, ul2, true
+}
+
+// alignTimeSeriesLists returns lists whose time series are sliced to the
+// intersection of the time ranges of the same archive in all lists.
+func alignTimeSeriesLists(lists []TimeSeriesList) ([]TimeSeriesList, bool) {
+	if len(lists) == 0 {
+		return lists, true
+	}
+	base := lists[0]
+	for _, tl := range lists[1:] {
+		var ok bool
+		if base, _, ok = base.alignTimeRanges(tl); !ok {
+			return nil, false
+		}
+	}
+	aligned := make([]TimeSeriesList, len(lists))
+	for i, tl := range lists {
+		var ok bool
+		if _, aligned[i], ok = base.alignTimeRanges(tl); !ok {
+			return nil, false
+		}
+	}
+	return aligned, true
+}
+
+// intersectTimeRange returns the intersection of the time ranges of ts and
+// us. It returns false if the steps are different, the times of points are
+// not aligned or the time ranges do not overlap.
+func intersectTimeRange(ts, us *whispertool.TimeSeries) (from, until whispertool.Timestamp, ok bool) {
+	step := ts.Step()
+	if step != us.Step() || step <= 0 || ts.FromTime().Sub(us.FromTime())%step != 0 {
+		return 0, 0, false
+	}
+	from = ts.FromTime()
+	if us.FromTime() > from {
+		from = us.FromTime()
+	}
+	until = ts.UntilTime()
+	if us.UntilTime() < until {
+		until = us.UntilTime()
+	}
+	if from > until {
+		return 0, 0, false
+	}
+	return from, until, true
+}
+
+// sliceTimeSeries returns the part of ts from from to until which must be
+// aligned to the step and within the time range of ts.
+func sliceTimeSeries(ts *whispertool.TimeSeries, from, until whispertool.Timestamp) *whispertool.TimeSeries {
+	if from == ts.FromTime() && until == ts.UntilTime() {
+		return ts
+	}
+	start := int(from.Sub(ts.FromTime()) / ts.Step())
+	end := int(until.Sub(ts.FromTime()) / ts.Step())
+	return whispertool.NewTimeSeries(from, until, ts.Step(), ts.Values()[start:end])
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestAlignTimeRanges(t *testing.T) {
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := whispertool.Minute
+	newTs := func(fromOffset, untilOffset, step whispertool.Duration, values ...whispertool.Value) *whispertool.TimeSeries {
+		return whispertool.NewTimeSeries(now.Add(fromOffset), now.Add(untilOffset), step, values)
+	}
+
+	testCases := []struct {
+		tl, ul         TimeSeriesList
+		wantTl, wantUl string
+		wantOK         bool
+	}{
+		{
+			tl:     TimeSeriesList{newTs(-3*m, 0, m, 1, 2, 3)},
+			ul:     TimeSeriesList{newTs(-2*m, m, m, 4, 5, 6)},
+			wantTl: `[{"fromTime":"2020-06-20T11:58:00Z","untilTime":"2020-06-20T12:00:00Z","step":60,"values":[2,3]}]`,
+			wantUl: `[{"fromTime":"2020-06-20T11:58:00Z","untilTime":"2020-06-20T12:00:00Z","step":60,"values":[4,5]}]`,
+			wantOK: true,
+		},
+		{
+			tl:     TimeSeriesList{newTs(-3*m, 0, m, 1, 2, 3)},
+			ul:     TimeSeriesList{newTs(-3*m, 0, m, 4, 5, 6)},
+			wantTl: `[{"fromTime":"2020-06-20T11:57:00Z","untilTime":"2020-06-20T12:00:00Z","step":60,"values":[1,2,3]}]`,
+			wantUl: `[{"fromTime":"2020-06-20T11:57:00Z","untilTime":"2020-06-20T12:00:00Z","step":60,"values":[4,5,6]}]`,
+			wantOK: true,
+		},
+		{
+			tl: TimeSeriesList{newTs(-4*m, 0, 2*m, 1, 2)},
+			ul: TimeSeriesList{newTs(-4*m, 0, m, 1, 2, 3, 4)},
+		},
+		{
+			tl: TimeSeriesList{newTs(-4*m, 0, 2*m, 1, 2)},
+			ul: TimeSeriesList{newTs(-3*m, m, 2*m, 1, 2)},
+		},
+		{
+			tl: TimeSeriesList{newTs(-3*m, -2*m, m, 1)},
+			ul: TimeSeriesList{newTs(-m, 0, m, 1)},
+		},
+	}
+	for i, tc := range testCases {
+		gotTl, gotUl, gotOK := tc.tl.alignTimeRanges(tc.ul)
+		if gotOK != tc.wantOK {
+			t.Errorf("ok unmatch for case %d, got=%v, want=%v", i, gotOK, tc.wantOK)
+			continue
+		}
+		if !gotOK {
+			continue
+		}
+		for _, r := range []struct {
+			got  TimeSeriesList
+			want string
+		}{{gotTl, tc.wantTl}, {gotUl, tc.wantUl}} {
+			b, err := json.Marshal(r.got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != r.want {
+				t.Errorf("result unmatch for case %d, got=%s, want=%s", i, b, r.want)
+			}
+		}
+	}
+}
+
+func TestAggregateAccumulatorNarrow(t *testing.T) {
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := whispertool.NewHeader(whispertool.Sum, 0, archiveInfoList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := whispertool.Minute
+	a := newAggregateAccumulator(&AggregateOptions{})
+	if err := a.add(h, TimeSeriesList{whispertool.NewTimeSeries(now.Add(-3*m), now, m, []whispertool.Value{1, 2, 3})}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.add(h, TimeSeriesList{whispertool.NewTimeSeries(now.Add(-2*m), now.Add(m), m, []whispertool.Value{10, 20, 30})}); err != nil {
+		t.Fatal(err)
+	}
+	tsList, _ := a.result()
+	got, err := json.Marshal(tsList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"fromTime":"2020-06-20T11:58:00Z","untilTime":"2020-06-20T12:00:00Z","step":60,"values":[12,23]}]`
+	if string(got) != want {
+		t.Errorf("result unmatch, got=%s, want=%s", got, want)
+	}
+}
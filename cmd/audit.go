@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+)
+
+type AuditCommand struct {
+	BaseDir         string
+	SchemasFile     string
+	AggregationFile string
+	TextOut         string
+	Format          string
+	TimeFormat      TimeFormat
+}
+
+type auditResult struct {
+	relPath     string
+	schema      *storageSchema
+	aggregation *storageAggregation
+	header      *whispertool.Header
+	fileSize    int64
+	wantSize    int64
+}
+
+// auditRuleKey is the pair of rules which a file is assigned to.
+// The indexes are used for sorting groups in the order of config files.
+type auditRuleKey struct {
+	schemaIndex      int
+	aggregationIndex int
+}
+
+func (c *AuditCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.BaseDir, "base", "", "base directory of whisper files")
+	fs.StringVar(&c.SchemasFile, "schemas", "", "path of carbon storage-schemas.conf")
+	fs.StringVar(&c.AggregationFile, "aggregation", "", "path of carbon storage-aggregation.conf. empty means whisper defaults (average, xFilesFactor 0.5)")
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of audit. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.Parse(args)
+
+	if c.BaseDir == "" {
+		return newRequiredOptionError(fs, "base")
+	}
+	if c.SchemasFile == "" {
+		return newRequiredOptionError(fs, "schemas")
+	}
+	return nil
+}
+
+func (c *AuditCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *AuditCommand) execute(tow *textOutWriter) (err error) {
+	schemas, err := readStorageSchemasFile(c.SchemasFile)
+	if err != nil {
+		return err
+	}
+	var aggs storageAggregations
+	if c.AggregationFile == "" {
+		aggs, err = parseStorageAggregations(strings.NewReader(""))
+	} else {
+		aggs, err = readStorageAggregationsFile(c.AggregationFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	t0 := time.Now()
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"})
+	var totalFileCount, mismatchCount, errorCount int
+	var totalSizeDelta int64
+	defer func() {
+		t1 := time.Now()
+		tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"},
+			textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalFileCount", totalFileCount},
+			textOutField{"mismatchCount", mismatchCount}, textOutField{"errorCount", errorCount},
+			textOutField{"sizeDelta", totalSizeDelta})
+	}()
+
+	groups := make(map[auditRuleKey][]auditResult)
+	err = filepath.Walk(c.BaseDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".wsp" {
+			return nil
+		}
+		totalFileCount++
+
+		relPath, err := filepath.Rel(c.BaseDir, path)
+		if err != nil {
+			return err
+		}
+		res, err := auditFile(path, relPath, info.Size(), schemas, aggs)
+		if err != nil {
+			errorCount++
+			tow.writeLog(textOutField{"file", relPath}, textOutField{"err", err.Error()})
+			return nil
+		}
+		if res.matches() {
+			return nil
+		}
+		mismatchCount++
+		totalSizeDelta += res.wantSize - res.fileSize
+		key := auditRuleKey{
+			schemaIndex:      res.schema.index(schemas),
+			aggregationIndex: res.aggregation.index(aggs),
+		}
+		groups[key] = append(groups[key], res)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	keys := make([]auditRuleKey, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].schemaIndex != keys[j].schemaIndex {
+			return keys[i].schemaIndex < keys[j].schemaIndex
+		}
+		return keys[i].aggregationIndex < keys[j].aggregationIndex
+	})
+	for _, key := range keys {
+		if err := printAuditGroup(tow, groups[key]); err != nil {
+			return err
+		}
+	}
+
+	if mismatchCount > 0 || errorCount > 0 {
+		return ErrDiffFound
+	}
+	return nil
+}
+
+func auditFile(filename, relPath string, fileSize int64, schemas storageSchemas, aggs storageAggregations) (auditResult, error) {
+	db, err := whispertool.Open(filename, whispertool.WithOpenFileFlag(os.O_RDONLY))
+	if err != nil {
+		return auditResult{}, err
+	}
+	defer db.Close()
+
+	metric := relDirToItem(strings.TrimSuffix(relPath, ".wsp"))
+	res := auditResult{
+		relPath:     relPath,
+		schema:      schemas.match(metric),
+		aggregation: aggs.match(metric),
+		header:      db.Header(),
+		fileSize:    fileSize,
+	}
+	h, err := whispertool.NewHeader(res.aggregation.aggregationMethod,
+		res.aggregation.xFilesFactor, res.schema.archiveInfoList)
+	if err != nil {
+		return auditResult{}, err
+	}
+	res.wantSize = h.ExpectedFileSize()
+	return res, nil
+}
+
+func (r *auditResult) matches() bool {
+	return r.header.ArchiveInfoList().Equal(r.schema.archiveInfoList) &&
+		r.header.AggregationMethod() == r.aggregation.aggregationMethod &&
+		r.header.XFilesFactor() == r.aggregation.xFilesFactor
+}
+
+func (s *storageSchema) index(ss storageSchemas) int {
+	for i := range ss {
+		if &ss[i] == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func (a *storageAggregation) index(aa storageAggregations) int {
+	for i := range aa {
+		if &aa[i] == a {
+			return i
+		}
+	}
+	return -1
+}
+
+func printAuditGroup(w *textOutWriter, results []auditResult) error {
+	schema := results[0].schema
+	agg := results[0].aggregation
+	var sizeDelta int64
+	for _, r := range results {
+		sizeDelta += r.wantSize - r.fileSize
+	}
+	err := w.writeContext(textOutField{"schema", schema.name},
+		textOutField{"retentions", schema.archiveInfoList.String()},
+		textOutField{"aggregation", agg.name}, textOutField{"aggMethod", agg.aggregationMethod.String()},
+		textOutField{"xFilesFactor", json.Number(formatXFilesFactor(agg.xFilesFactor))},
+		textOutField{"mismatchCount", len(results)}, textOutField{"sizeDelta", sizeDelta})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		err := w.writeData(textOutField{"file", r.relPath},
+			textOutField{"retentions", r.header.ArchiveInfoList().String()},
+			textOutField{"aggMethod", r.header.AggregationMethod().String()},
+			textOutField{"xFilesFactor", json.Number(formatXFilesFactor(r.header.XFilesFactor()))},
+			textOutField{"size", r.fileSize}, textOutField{"wantSize", r.wantSize})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatXFilesFactor(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', -1, 32)
+}
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hnakamur/whispertool"
+)
+
+// defaultSchemaName is the name of the fallback schema which carbon
+// appends after all rules in storage-schemas.conf.
+const defaultSchemaName = "default"
+
+// defaultSchemaArchiveInfoList is the retentions of the fallback schema
+// in carbon, that is 7 days of minutely data.
+var defaultSchemaArchiveInfoList = whispertool.ArchiveInfoList{
+	whispertool.NewArchiveInfo(whispertool.Minute, 60*24*7),
+}
+
+// Default values used by whisper when no aggregation rule matches
+// or a rule omits the value.
+const (
+	defaultAggregationMethod = whispertool.Average
+	defaultXFilesFactor      = 0.5
+)
+
+type iniSection struct {
+	name    string
+	options map[string]string
+}
+
+// storageSchema is a rule in carbon's storage-schemas.conf.
+type storageSchema struct {
+	name            string
+	pattern         *regexp.Regexp
+	matchAll        bool
+	archiveInfoList whispertool.ArchiveInfoList
+}
+
+// storageAggregation is a rule in carbon's storage-aggregation.conf.
+type storageAggregation struct {
+	name              string
+	pattern           *regexp.Regexp
+	matchAll          bool
+	aggregationMethod whispertool.AggregationMethod
+	xFilesFactor      float32
+}
+
+type storageSchemas []storageSchema
+
+type storageAggregations []storageAggregation
+
+func readStorageSchemasFile(filename string) (storageSchemas, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	schemas, err := parseStorageSchemas(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return schemas, nil
+}
+
+// parseStorageSchemas parses the content of storage-schemas.conf.
+// Like carbon, the default schema is appended after the rules in r.
+func parseStorageSchemas(r io.Reader) (storageSchemas, error) {
+	sections, err := parseINI(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var schemas storageSchemas
+	for _, sec := range sections {
+		s := storageSchema{name: sec.name}
+		retentions, ok := sec.options["retentions"]
+		if !ok {
+			return nil, fmt.Errorf("section [%s]: retentions is required", sec.name)
+		}
+		s.archiveInfoList, err = whispertool.ParseArchiveInfoList(retentions)
+		if err != nil {
+			return nil, fmt.Errorf("section [%s]: %s", sec.name, err)
+		}
+		s.matchAll, s.pattern, err = parseRuleMatcher(sec)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, s)
+	}
+	schemas = append(schemas, storageSchema{
+		name:            defaultSchemaName,
+		matchAll:        true,
+		archiveInfoList: defaultSchemaArchiveInfoList,
+	})
+	return schemas, nil
+}
+
+func readStorageAggregationsFile(filename string) (storageAggregations, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	aggs, err := parseStorageAggregations(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return aggs, nil
+}
+
+// parseStorageAggregations parses the content of storage-aggregation.conf.
+// Like carbon, the default rule is appended after the rules in r, and
+// whisper's defaults are used for values omitted in a rule.
+func parseStorageAggregations(r io.Reader) (storageAggregations, error) {
+	sections, err := parseINI(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var aggs storageAggregations
+	for _, sec := range sections {
+		a := storageAggregation{
+			name:              sec.name,
+			aggregationMethod: defaultAggregationMethod,
+			xFilesFactor:      defaultXFilesFactor,
+		}
+		if v, ok := sec.options["aggregationmethod"]; ok {
+			if err := (aggregationMethodValue{m: &a.aggregationMethod}).Set(v); err != nil {
+				return nil, fmt.Errorf("section [%s]: %s", sec.name, err)
+			}
+		}
+		if v, ok := sec.options["xfilesfactor"]; ok {
+			if err := (xFilesFactorValue{f: &a.xFilesFactor}).Set(v); err != nil {
+				return nil, fmt.Errorf("section [%s]: %s", sec.name, err)
+			}
+		}
+		a.matchAll, a.pattern, err = parseRuleMatcher(sec)
+		if err != nil {
+			return nil, err
+		}
+		aggs = append(aggs, a)
+	}
+	aggs = append(aggs, storageAggregation{
+		name:              defaultSchemaName,
+		matchAll:          true,
+		aggregationMethod: defaultAggregationMethod,
+		xFilesFactor:      defaultXFilesFactor,
+	})
+	return aggs, nil
+}
+
+func parseRuleMatcher(sec iniSection) (matchAll bool, pattern *regexp.Regexp, err error) {
+	if v, ok := sec.options["match-all"]; ok {
+		matchAll, err = strconv.ParseBool(v)
+		if err != nil {
+			return false, nil, fmt.Errorf("section [%s]: invalid match-all: %s", sec.name, v)
+		}
+		if matchAll {
+			return true, nil, nil
+		}
+	}
+	p, ok := sec.options["pattern"]
+	if !ok {
+		return false, nil, fmt.Errorf("section [%s]: pattern or match-all is required", sec.name)
+	}
+	pattern, err = regexp.Compile(p)
+	if err != nil {
+		return false, nil, fmt.Errorf("section [%s]: invalid pattern: %s", sec.name, err)
+	}
+	return false, pattern, nil
+}
+
+// match returns the first schema which matches the metric name.
+// Note the pattern is searched in the metric name as carbon does,
+// so it is not anchored unless the pattern contains "^" or "$".
+func (ss storageSchemas) match(metric string) *storageSchema {
+	for i := range ss {
+		s := &ss[i]
+		if s.matchAll || s.pattern.MatchString(metric) {
+			return s
+		}
+	}
+	return nil
+}
+
+// match returns the first aggregation rule which matches the metric name.
+func (aa storageAggregations) match(metric string) *storageAggregation {
+	for i := range aa {
+		a := &aa[i]
+		if a.matchAll || a.pattern.MatchString(metric) {
+			return a
+		}
+	}
+	return nil
+}
+
+// parseINI parses a config file in the format of Python's ConfigParser
+// which is used by carbon. Option names are lowercased and both "=" and
+// ":" are accepted as delimiters.
+func parseINI(r io.Reader) ([]iniSection, error) {
+	var sections []iniSection
+	s := bufio.NewScanner(r)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("line %d: invalid section header: %s", lineNo, line)
+			}
+			sections = append(sections, iniSection{
+				name:    strings.TrimSpace(line[1 : len(line)-1]),
+				options: make(map[string]string),
+			})
+			continue
+		}
+		if len(sections) == 0 {
+			return nil, fmt.Errorf("line %d: option outside of section: %s", lineNo, line)
+		}
+		i := strings.IndexAny(line, "=:")
+		if i == -1 {
+			return nil, fmt.Errorf("line %d: invalid option: %s", lineNo, line)
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+		sections[len(sections)-1].options[key] = value
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
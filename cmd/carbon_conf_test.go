@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestParseStorageSchemas(t *testing.T) {
+	const conf = `# Schema definitions for Whisper files.
+[carbon]
+pattern = ^carbon\.
+retentions = 60s:90d
+
+; comment
+[app]
+PATTERN: ^app\.(web|db)\.
+retentions = 10s:6h, 1min:7d,10m:5y
+
+[default_1min_for_1day]
+pattern = .*
+retentions = 60s:1d
+`
+	schemas, err := parseStorageSchemas(strings.NewReader(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(schemas), 4; got != want {
+		t.Fatalf("schema count unmatch, got=%d, want=%d", got, want)
+	}
+
+	testCases := []struct {
+		metric         string
+		wantName       string
+		wantRetentions string
+	}{
+		{metric: "carbon.agents.a.cpuUsage", wantName: "carbon", wantRetentions: "1m:90d"},
+		{metric: "app.web.requests", wantName: "app", wantRetentions: "10s:6h,1m:1w,10m:5y"},
+		{metric: "app.batch.requests", wantName: "default_1min_for_1day", wantRetentions: "1m:1d"},
+		{metric: "foo.carbon.bar", wantName: "default_1min_for_1day", wantRetentions: "1m:1d"},
+	}
+	for _, tc := range testCases {
+		s := schemas.match(tc.metric)
+		if got, want := s.name, tc.wantName; got != want {
+			t.Errorf("schema name unmatch for metric %s, got=%s, want=%s", tc.metric, got, want)
+		}
+		if got, want := s.archiveInfoList.String(), tc.wantRetentions; got != want {
+			t.Errorf("retentions unmatch for metric %s, got=%s, want=%s", tc.metric, got, want)
+		}
+	}
+
+	schemas, err = parseStorageSchemas(strings.NewReader("[carbon]\npattern = ^carbon\\.\nretentions = 60s:90d\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := schemas.match("foo").name, defaultSchemaName; got != want {
+		t.Errorf("fallback schema name unmatch, got=%s, want=%s", got, want)
+	}
+}
+
+func TestParseStorageAggregations(t *testing.T) {
+	const conf = `[min]
+pattern = \.min$
+xFilesFactor = 0.1
+aggregationMethod = min
+
+[count]
+pattern = \.count$
+aggregationMethod = sum
+
+[all]
+match-all = true
+xFilesFactor = 0
+`
+	aggs, err := parseStorageAggregations(strings.NewReader(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		metric           string
+		wantName         string
+		wantAggMethod    whispertool.AggregationMethod
+		wantXFilesFactor float32
+	}{
+		{metric: "app.latency.min", wantName: "min", wantAggMethod: whispertool.Min, wantXFilesFactor: 0.1},
+		{metric: "app.requests.count", wantName: "count", wantAggMethod: whispertool.Sum, wantXFilesFactor: 0.5},
+		{metric: "app.latency.mean", wantName: "all", wantAggMethod: whispertool.Average, wantXFilesFactor: 0},
+	}
+	for _, tc := range testCases {
+		a := aggs.match(tc.metric)
+		if got, want := a.name, tc.wantName; got != want {
+			t.Errorf("rule name unmatch for metric %s, got=%s, want=%s", tc.metric, got, want)
+		}
+		if got, want := a.aggregationMethod, tc.wantAggMethod; got != want {
+			t.Errorf("aggregation method unmatch for metric %s, got=%s, want=%s", tc.metric, got, want)
+		}
+		if got, want := a.xFilesFactor, tc.wantXFilesFactor; got != want {
+			t.Errorf("xFilesFactor unmatch for metric %s, got=%v, want=%v", tc.metric, got, want)
+		}
+	}
+
+	invalidConfs := []string{
+		"[a]\npattern = (\n",
+		"[a]\naggregationMethod = sum\n",
+		"[a]\npattern = .*\naggregationMethod = median\n",
+		"[a]\npattern = .*\nxFilesFactor = 2\n",
+		"pattern = .*\n",
+	}
+	for _, conf := range invalidConfs {
+		if _, err := parseStorageAggregations(strings.NewReader(conf)); err == nil {
+			t.Errorf("should get error for conf %q", conf)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Names of hash types of carbon relays.
+const (
+	carbonHashCarbonCH    = "carbon_ch"
+	carbonHashFNV1aCH     = "fnv1a_ch"
+	carbonHashJumpFNV1aCH = "jump_fnv1a_ch"
+)
+
+const carbonHashTypeUsage = `hash type of relays. "carbon_ch" (carbon consistent-hashing and carbon-c-relay carbon_ch), ` +
+	`"fnv1a_ch" or "jump_fnv1a_ch" (carbon-c-relay)`
+
+var errInvalidCarbonHashType = errors.New(`hash must be one of "carbon_ch", "fnv1a_ch" or "jump_fnv1a_ch"`)
+
+// carbonRingReplicaCount is the number of positions of each node in
+// consistent hashing rings, which is fixed to 100 in carbon and
+// carbon-c-relay.
+const carbonRingReplicaCount = 100
+
+// carbonNode is a destination of carbon relays.
+type carbonNode struct {
+	server   string
+	port     int
+	instance string
+}
+
+// parseCarbonNode parses a destination in the format of carbon's
+// DESTINATIONS, that is "server:port:instance" or "server:port".
+func parseCarbonNode(s string) (carbonNode, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return carbonNode{}, fmt.Errorf("invalid carbon destination %q, must be server:port[:instance]", s)
+	}
+	port, err := strconv.Atoi(parts[1])
+	if err != nil || port <= 0 || port > 65535 {
+		return carbonNode{}, fmt.Errorf("invalid port in carbon destination %q", s)
+	}
+	n := carbonNode{server: parts[0], port: port}
+	if len(parts) == 3 {
+		n.instance = parts[2]
+	}
+	return n, nil
+}
+
+func (n carbonNode) String() string {
+	if n.instance == "" {
+		return n.server + ":" + strconv.Itoa(n.port)
+	}
+	return n.server + ":" + strconv.Itoa(n.port) + ":" + n.instance
+}
+
+// ringKey returns the key which identifies n in consistent hashing rings.
+// For carbon_ch it is the Python string of the (server, instance) tuple
+// as carbon and carbon-c-relay use, so the port does not affect placement.
+// For fnv1a_ch it is the instance, or server:port if the instance is empty
+// as carbon-c-relay uses.
+func (n carbonNode) ringKey(hashType string) string {
+	if hashType == carbonHashFNV1aCH {
+		if n.instance == "" {
+			return n.server + ":" + strconv.Itoa(n.port)
+		}
+		return n.instance
+	}
+	instance := "None"
+	if n.instance != "" {
+		instance = "'" + n.instance + "'"
+	}
+	return "('" + n.server + "', " + instance + ")"
+}
+
+// carbonRing returns the nodes for metrics like carbon relays.
+type carbonRing interface {
+	// getNodes returns indexes of nodes for the metric up to count.
+	getNodes(metric string, count int) []int
+}
+
+func newCarbonRing(hashType string, nodes []carbonNode) (carbonRing, error) {
+	if len(nodes) == 0 {
+		return nil, errors.New("no carbon destinations")
+	}
+	switch hashType {
+	case carbonHashCarbonCH, carbonHashFNV1aCH:
+		return newConsistentHashRing(hashType, nodes), nil
+	case carbonHashJumpFNV1aCH:
+		return &jumpHashRing{nodeCount: len(nodes)}, nil
+	default:
+		return nil, errInvalidCarbonHashType
+	}
+}
+
+type ringEntry struct {
+	position int
+	node     int
+}
+
+// consistentHashRing is the same as ConsistentHashRing in carbon's
+// hashing.py for carbon_ch and the fnv1a_ch ring of carbon-c-relay.
+// Positions are 16 bit hashes of replica keys. For carbon_ch a colliding
+// position is incremented until it is not used as carbon does, and for
+// fnv1a_ch entries at the same position are ordered by server and port
+// as carbon-c-relay does.
+type consistentHashRing struct {
+	hashType string
+	entries  []ringEntry
+
+	// keys is ring keys of nodes. Nodes with the same key are
+	// the same node in the ring.
+	keys      []string
+	nodeCount int
+}
+
+func newConsistentHashRing(hashType string, nodes []carbonNode) *consistentHashRing {
+	r := &consistentHashRing{hashType: hashType, keys: make([]string, len(nodes))}
+	used := make(map[int]bool)
+	distinctKeys := make(map[string]bool)
+	for i, n := range nodes {
+		r.keys[i] = n.ringKey(hashType)
+		distinctKeys[r.keys[i]] = true
+		for j := 0; j < carbonRingReplicaCount; j++ {
+			position := r.position(r.replicaKey(i, j))
+			if hashType == carbonHashCarbonCH {
+				for used[position] {
+					position++
+				}
+				used[position] = true
+			}
+			r.entries = append(r.entries, ringEntry{position: position, node: i})
+		}
+	}
+	sort.SliceStable(r.entries, func(i, j int) bool {
+		e, f := r.entries[i], r.entries[j]
+		if e.position != f.position || hashType != carbonHashFNV1aCH {
+			return e.position < f.position
+		}
+		m, n := nodes[e.node], nodes[f.node]
+		if m.server != n.server {
+			return m.server < n.server
+		}
+		return m.port < n.port
+	})
+	r.nodeCount = len(distinctKeys)
+	return r
+}
+
+// replicaKey returns the key of j-th position of i-th node, which is
+// "key:j" for carbon_ch and "j-key" for fnv1a_ch.
+func (r *consistentHashRing) replicaKey(i, j int) string {
+	if r.hashType == carbonHashFNV1aCH {
+		return strconv.Itoa(j) + "-" + r.keys[i]
+	}
+	return r.keys[i] + ":" + strconv.Itoa(j)
+}
+
+func (r *consistentHashRing) position(key string) int {
+	if r.hashType == carbonHashFNV1aCH {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		v := h.Sum32()
+		return int((v >> 16) ^ (v & 0xffff))
+	}
+	sum := md5.Sum([]byte(key))
+	return int(binary.BigEndian.Uint16(sum[:2]))
+}
+
+// getNodes walks the ring from the position of the metric and returns
+// distinct nodes like get_nodes of carbon's ConsistentHashRing.
+func (r *consistentHashRing) getNodes(metric string, count int) []int {
+	if count > r.nodeCount {
+		count = r.nodeCount
+	}
+	position := r.position(metric)
+	start := sort.Search(len(r.entries), func(i int) bool {
+		return r.entries[i].position >= position
+	})
+	var nodes []int
+	for k := 0; k < len(r.entries) && len(nodes) < count; k++ {
+		node := r.entries[(start+k)%len(r.entries)].node
+		if !r.containsNode(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// containsNode returns whether or not indexes has a node with the same
+// ring key as i-th node.
+func (r *consistentHashRing) containsNode(indexes []int, i int) bool {
+	for _, k := range indexes {
+		if r.keys[k] == r.keys[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// jumpHashRing is jump_fnv1a_ch of carbon-c-relay, which is the jump
+// consistent hash of the 64 bit FNV-1a hash of metrics. Nodes are buckets
+// in the order of the list, so nodes must be appended to keep placement.
+// Replicas are the following buckets.
+type jumpHashRing struct {
+	nodeCount int
+}
+
+func (r *jumpHashRing) getNodes(metric string, count int) []int {
+	if count > r.nodeCount {
+		count = r.nodeCount
+	}
+	h := fnv.New64a()
+	h.Write([]byte(metric))
+	b := jumpHash(h.Sum64(), r.nodeCount)
+	nodes := make([]int, count)
+	for i := range nodes {
+		nodes[i] = (b + i) % r.nodeCount
+	}
+	return nodes
+}
+
+// jumpHash returns the bucket of key in [0, numBuckets) with the jump
+// consistent hash by Lamping and Veach.
+func jumpHash(key uint64, numBuckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(numBuckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
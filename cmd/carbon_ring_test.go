@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConsistentHashRing(t *testing.T) {
+	nodes := []carbonNode{
+		{server: "127.0.0.1", port: 2004, instance: "a"},
+		{server: "127.0.0.1", port: 2104, instance: "b"},
+		{server: "127.0.0.2", port: 2004},
+	}
+	r := newConsistentHashRing(carbonHashCarbonCH, nodes)
+	if got, want := r.position(r.replicaKey(0, 0)), 24043; got != want {
+		t.Errorf("position unmatch, got=%d, want=%d", got, want)
+	}
+
+	// Expected nodes are made with ConsistentHashRing in carbon's hashing.py.
+	testCases := []struct {
+		metric string
+		want   []int
+	}{
+		{metric: "carbon.agents.host1.cpuUsage", want: []int{0, 2, 1}},
+		{metric: "servers.web1.load.shortterm", want: []int{2, 1, 0}},
+		{metric: "a.b.c", want: []int{2, 0, 1}},
+		{metric: "foo", want: []int{2, 0, 1}},
+	}
+	for _, tc := range testCases {
+		if got := r.getNodes(tc.metric, 3); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("nodes unmatch for metric=%s, got=%v, want=%v", tc.metric, got, tc.want)
+		}
+		if got := r.getNodes(tc.metric, 1); !reflect.DeepEqual(got, tc.want[:1]) {
+			t.Errorf("first node unmatch for metric=%s, got=%v, want=%v", tc.metric, got, tc.want[:1])
+		}
+	}
+
+}
+
+func TestConsistentHashRing_FNV1a(t *testing.T) {
+	nodes := []carbonNode{
+		{server: "127.0.0.1", port: 2004, instance: "a"},
+		{server: "127.0.0.1", port: 2104},
+		{server: "127.0.0.2", port: 2004},
+	}
+	r := newConsistentHashRing(carbonHashFNV1aCH, nodes)
+	positionTestCases := []struct {
+		i, j int
+		key  string
+		want int
+	}{
+		{i: 0, j: 0, key: "0-a", want: 52678},
+		{i: 1, j: 0, key: "0-127.0.0.1:2104", want: 30138},
+	}
+	for _, tc := range positionTestCases {
+		if got := r.replicaKey(tc.i, tc.j); got != tc.key {
+			t.Errorf("replica key unmatch, got=%s, want=%s", got, tc.key)
+		}
+		if got := r.position(tc.key); got != tc.want {
+			t.Errorf("position unmatch for key=%s, got=%d, want=%d", tc.key, got, tc.want)
+		}
+	}
+
+	// Expected nodes are made with a model of the fnv1a_ch ring in carbon-c-relay's ch.c.
+	testCases := []struct {
+		metric string
+		want   []int
+	}{
+		{metric: "carbon.agents.host1.cpuUsage", want: []int{2, 0, 1}},
+		{metric: "servers.web1.load.shortterm", want: []int{0, 1, 2}},
+		{metric: "a.b.c", want: []int{0, 1, 2}},
+		{metric: "foo", want: []int{1, 2, 0}},
+	}
+	for _, tc := range testCases {
+		if got := r.getNodes(tc.metric, 5); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("nodes unmatch for metric=%s, got=%v, want=%v", tc.metric, got, tc.want)
+		}
+	}
+}
+
+func TestJumpHash(t *testing.T) {
+	testCases := []struct {
+		key        uint64
+		numBuckets int
+		want       int
+	}{
+		{key: 1, numBuckets: 1, want: 0},
+		{key: 42, numBuckets: 57, want: 43},
+		{key: 0xDEAD10CC, numBuckets: 666, want: 361},
+		{key: 256, numBuckets: 1024, want: 520},
+	}
+	for _, tc := range testCases {
+		if got := jumpHash(tc.key, tc.numBuckets); got != tc.want {
+			t.Errorf("bucket unmatch for key=%d, numBuckets=%d, got=%d, want=%d", tc.key, tc.numBuckets, got, tc.want)
+		}
+	}
+
+	r := &jumpHashRing{nodeCount: 4}
+	if got, want := r.getNodes("a.b.c", 2), []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("nodes unmatch, got=%v, want=%v", got, want)
+	}
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+)
+
+type ConvertCommand struct {
+	SrcBase           string
+	SrcRelPath        string
+	DestBase          string
+	DestRelPath       string
+	AggregationMethod whispertool.AggregationMethod
+	XFilesFactor      float32
+	ArchiveInfoList   whispertool.ArchiveInfoList
+	Now               whispertool.Timestamp
+	TextOut           string
+	Format            string
+	TimeFormat        TimeFormat
+
+	xFilesFactorSet bool
+}
+
+func (c *ConvertCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.SrcBase, "src-base", "", "src base directory of Ceres database")
+	fs.StringVar(&c.SrcRelPath, "src", "", "Ceres node directory relative path to src base")
+	fs.StringVar(&c.DestBase, "dest-base", "", "dest base directory")
+	fs.StringVar(&c.DestRelPath, "dest", "", "whisper file relative path to dest base. the file must not exist. empty means src with .wsp extension.")
+
+	fs.Var(&aggregationMethodValue{&c.AggregationMethod}, "agg-method", "aggregation method of dest file. empty means the one in the Ceres node metadata.")
+	fs.Var(&xFilesFactorValue{&c.XFilesFactor}, "x-files-factor", "xFilesFactor of dest file. empty means the one in the Ceres node metadata.")
+	fs.Var(&archiveInfoListValue{&c.ArchiveInfoList}, "retentions", "retentions definitions of dest file. empty means the ones in the Ceres node metadata.")
+
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of converting data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.Parse(args)
+
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "x-files-factor" {
+			c.xFilesFactorSet = true
+		}
+	})
+
+	if c.SrcBase == "" {
+		return newRequiredOptionError(fs, "src-base")
+	}
+	if c.SrcRelPath == "" {
+		return newRequiredOptionError(fs, "src")
+	}
+	if c.DestBase == "" {
+		return newRequiredOptionError(fs, "dest-base")
+	}
+	if isBaseURL(c.SrcBase) || isBaseURL(c.DestBase) {
+		return errors.New("src-base and dest-base must be local directories")
+	}
+	if c.DestRelPath == "" {
+		c.DestRelPath = strings.TrimSuffix(c.SrcRelPath, string(filepath.Separator)) + ".wsp"
+	}
+	return nil
+}
+
+func (c *ConvertCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *ConvertCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
+	t0 := time.Now()
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now))
+	var totalUpdated int
+	defer func() {
+		t1 := time.Now()
+		tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+			textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalUpdated", totalUpdated})
+	}()
+
+	node, err := whispertool.OpenCeresNode(filepath.Join(c.SrcBase, c.SrcRelPath))
+	if err != nil {
+		return err
+	}
+	h, err := c.destHeader(node)
+	if err != nil {
+		return err
+	}
+
+	db, err := createUpdateDestFile(filepath.Join(c.DestBase, c.DestRelPath), h)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err2 := db.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	if err := tow.writeContext(textOutField{"srcRel", c.SrcRelPath}, textOutField{"destRel", c.DestRelPath}); err != nil {
+		return err
+	}
+	updatedCounts, err := convertCeresNode(db, node, now)
+	if err != nil {
+		return err
+	}
+	if err := db.Sync(); err != nil {
+		return err
+	}
+	for i, r := range h.ArchiveInfoList() {
+		totalUpdated += updatedCounts[i]
+		err := tow.writeData(textOutField{"archive", i}, textOutField{"step", r.SecondsPerPoint().String()},
+			textOutField{"updated", updatedCounts[i]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ConvertCommand) destHeader(node *whispertool.CeresNode) (*whispertool.Header, error) {
+	aggMethod := c.AggregationMethod
+	if aggMethod == 0 {
+		aggMethod = node.AggregationMethod()
+	}
+	xFilesFactor := c.XFilesFactor
+	if !c.xFilesFactorSet {
+		xFilesFactor = node.XFilesFactor()
+	}
+	archiveInfoList := c.ArchiveInfoList
+	if archiveInfoList == nil {
+		archiveInfoList = node.ArchiveInfoList()
+		if archiveInfoList == nil {
+			return nil, errors.New("retentions must be specified since Ceres node metadata does not have retentions")
+		}
+	}
+	return whispertool.NewHeader(aggMethod, xFilesFactor, archiveInfoList)
+}
+
+// convertCeresNode writes points of the node to db and returns the number
+// of updated points for each archive.
+//
+// Each archive is written with points aggregated from the node for the
+// time range which is not covered by higher precision archives, and
+// archives are written from the lowest precision one. So points in the
+// time range covered by higher precision archives are propagated by
+// whisper with the aggregation method of db, as carbon would have done.
+func convertCeresNode(db *whispertool.Whisper, node *whispertool.CeresNode, now whispertool.Timestamp) ([]int, error) {
+	archiveInfoList := db.ArchiveInfoList()
+	updatedCounts := make([]int, len(archiveInfoList))
+	for i := len(archiveInfoList) - 1; i >= 0; i-- {
+		r := &archiveInfoList[i]
+		from := now.Add(-r.MaxRetention())
+		until := now
+		if i > 0 {
+			until = now.Add(-archiveInfoList[i-1].MaxRetention())
+		}
+
+		ts, err := node.Fetch(from, until)
+		if err != nil {
+			return nil, err
+		}
+		if ts == nil {
+			continue
+		}
+		if ts.Step() != r.SecondsPerPoint() {
+			ts, err = ts.Aggregate(r.SecondsPerPoint(), db.AggregationMethod(), db.XFilesFactor())
+			if err != nil {
+				return nil, fmt.Errorf("archive %d: %s", i, err)
+			}
+		}
+
+		var points whispertool.Points
+		for _, p := range ts.Points() {
+			if p.Value.IsNaN() || p.Time <= from || now < p.Time {
+				continue
+			}
+			points = append(points, p)
+		}
+		if len(points) == 0 {
+			continue
+		}
+		if err := db.UpdatePointsForArchive(points, i, now); err != nil {
+			return nil, err
+		}
+		updatedCounts[i] = len(points)
+	}
+	return updatedCounts, nil
+}
+
+// readCeresNodeLocal reads a Ceres node as a whisper file whose header
+// is made from the node metadata. Points of archives whose step is not
+// the time step of the node are aggregated from the points of the node.
+func readCeresNodeLocal(dir string, archiveID int, from, until whispertool.Timestamp) (*whispertool.Header, TimeSeriesList, error) {
+	node, err := whispertool.OpenCeresNode(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	ts, err := node.Fetch(from, until)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	archiveInfoList := node.ArchiveInfoList()
+	if archiveInfoList == nil {
+		n := 1
+		if ts != nil && len(ts.Values()) > 0 {
+			n = len(ts.Values())
+		}
+		archiveInfoList = whispertool.ArchiveInfoList{whispertool.NewArchiveInfo(node.TimeStep(), uint32(n))}
+	}
+	h, err := whispertool.NewHeader(node.AggregationMethod(), node.XFilesFactor(), archiveInfoList)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if archiveID != ArchiveIDAll && (archiveID < 0 || archiveID >= len(archiveInfoList)) {
+		return nil, nil, whispertool.ErrArchiveIDOutOfRange
+	}
+	tsList := make(TimeSeriesList, len(archiveInfoList))
+	if ts == nil {
+		return h, tsList, nil
+	}
+	for i, r := range h.ArchiveInfoList() {
+		if archiveID != ArchiveIDAll && archiveID != i {
+			continue
+		}
+		if r.SecondsPerPoint() == ts.Step() {
+			tsList[i] = ts
+			continue
+		}
+		tsList[i], err = ts.Aggregate(r.SecondsPerPoint(), h.AggregationMethod(), h.XFilesFactor())
+		if err != nil {
+			return nil, nil, fmt.Errorf("archive %d: %s", i, err)
+		}
+	}
+	return h, tsList, nil
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestConvertCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeDir := filepath.Join(dir, "ceres", "a", "b")
+	if err := os.MkdirAll(nodeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	metadata := `{"timeStep":60,"aggregationMethod":"sum","xFilesFactor":0.5,"retentions":[[60,5],[300,6]]}`
+	if err := ioutil.WriteFile(filepath.Join(nodeDir, whispertool.CeresNodeMetadataFilename), []byte(metadata), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 31*8)
+	for i := 0; i < 31; i++ {
+		binary.BigEndian.PutUint64(buf[i*8:], math.Float64bits(1))
+	}
+	sliceFilename := filepath.Join(nodeDir, fmt.Sprintf("%d@60.slice", now.Add(-30*whispertool.Minute)))
+	if err := ioutil.WriteFile(sliceFilename, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, tsList, err := readWhisperFileLocal(nodeDir, ArchiveIDAll, now.Add(-10*whispertool.Minute), now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tsList[1].Values(); len(got) != 3 || got[0] != 4 || got[1] != 5 || !got[2].IsNaN() {
+		t.Errorf("aggregated values of ceres node unmatch, got=%v, want=[4 5 NaN]", got)
+	}
+
+	c := &ConvertCommand{}
+	if err := c.Parse(flag.NewFlagSet("test", flag.ContinueOnError), []string{
+		"-src-base", filepath.Join(dir, "ceres"), "-src", "a/b",
+		"-dest-base", filepath.Join(dir, "whisper"), "-now", now.String(), "-text-out", "",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	destFilename := filepath.Join(dir, "whisper", "a", "b.wsp")
+	h, tsList, err := readWhisperFileLocal(destFilename, ArchiveIDAll, now.Add(-30*whispertool.Minute), now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.AggregationMethod() != whispertool.Sum || h.XFilesFactor() != 0.5 || h.ArchiveInfoList().String() != "1m:5m,5m:30m" {
+		t.Errorf("header unmatch, got=%s", h)
+	}
+	nan := whispertool.Value(math.NaN())
+	wantList := [][]whispertool.Value{
+		{1, 1, 1, 1, 1},
+		{5, 5, 5, 5, 4, nan},
+	}
+	for i, want := range wantList {
+		got := tsList[i].Values()
+		if len(got) != len(want) {
+			t.Fatalf("value count unmatch for archive %d, got=%v, want=%v", i, got, want)
+		}
+		for j := range got {
+			if !got[j].Equal(want[j]) {
+				t.Errorf("values unmatch for archive %d, got=%v, want=%v", i, got, want)
+				break
+			}
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"time"
@@ -23,9 +22,16 @@ type CopyCommand struct {
 	ArchiveInfoList   whispertool.ArchiveInfoList
 	From              whispertool.Timestamp
 	Until             whispertool.Timestamp
+	Now               whispertool.Timestamp
 	ArchiveID         int
 	TextOut           string
+	Format            string
+	TimeFormat        TimeFormat
 	CopyNaN           bool
+	Workers           int
+	UndoLog           UndoLogOptions
+
+	undoLog *undoLogWriter
 }
 
 func (c *CopyCommand) Parse(fs *flag.FlagSet, args []string) error {
@@ -38,15 +44,25 @@ func (c *CopyCommand) Parse(fs *flag.FlagSet, args []string) error {
 	fs.Var(&xFilesFactorValue{&c.XFilesFactor}, "x-files-factor", "xFilesFactor")
 	fs.Var(&archiveInfoListValue{&c.ArchiveInfoList}, "retentions", "retentions definitions")
 
-	fs.Var(&timestampValue{t: &c.From}, "from", "range start UTC time in 2006-01-02T15:04:05Z format")
-	fs.Var(&timestampValue{t: &c.Until}, "until", "range end UTC time in 2006-01-02T15:04:05Z format")
+	fs.Var(&timestampValue{t: &c.From}, "from", "range start time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Until}, "until", "range end time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
 
 	fs.IntVar(&c.ArchiveID, "archive", ArchiveIDAll, "archive ID (-1 is all).")
 	fs.StringVar(&c.TextOut, "text-out", "-", "text output of copying data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
 	fs.BoolVar(&c.CopyNaN, "copy-nan", false, "whether or not copy when source value is NaN")
+	fs.IntVar(&c.Workers, "workers", 1, workersUsage)
+	c.UndoLog.setFlags(fs)
 
 	fs.Parse(args)
 
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
 	if c.SrcBase == "" {
 		return newRequiredOptionError(fs, "src-base")
 	}
@@ -68,25 +84,40 @@ func (c *CopyCommand) Parse(fs *flag.FlagSet, args []string) error {
 	if c.ArchiveInfoList == nil {
 		return newRequiredOptionError(fs, "retentions")
 	}
-	if c.From > c.Until {
+	if c.Until != 0 && c.From > c.Until {
 		return errFromIsAfterUntil
 	}
+	if err := validateUndoLogFormat(c.UndoLog.Format); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 func (c *CopyCommand) Execute() error {
-	return withTextOutWriter(c.TextOut, c.execute)
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
 }
 
-func (c *CopyCommand) execute(tow io.Writer) (err error) {
+func (c *CopyCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
+	c.undoLog, err = openUndoLog(c.UndoLog)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err2 := c.undoLog.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
 	if hasMeta(c.SrcRelPath) {
 		t0 := time.Now()
-		fmt.Fprintf(tow, "time:%s\tmsg:start\n", formatTime(t0))
+		tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now))
 		var totalFileCount int
 		defer func() {
 			t1 := time.Now()
-			fmt.Fprintf(tow, "time:%s\tmsg:finish\tduration:%s\ttotalFileCount:%d\n", formatTime(t1), t1.Sub(t0).String(), totalFileCount)
+			tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+				textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalFileCount", totalFileCount})
 		}()
 
 		filenames, err := globFiles(c.SrcBase, c.SrcRelPath)
@@ -94,13 +125,11 @@ func (c *CopyCommand) execute(tow io.Writer) (err error) {
 			return WrapFileNotExistError(Source, err)
 		}
 		totalFileCount = len(filenames)
-		for _, relPath := range filenames {
-			err = c.copyOneFile(relPath, relPath, tow)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		return runOrderedTasks(tow, len(filenames), c.Workers, func(i int, tow *textOutWriter) error {
+			return c.copyOneFile(filenames[i], filenames[i], now, tow)
+		}, func(err error) error {
+			return err
+		})
 	}
 
 	var destRelPath string
@@ -109,11 +138,10 @@ func (c *CopyCommand) execute(tow io.Writer) (err error) {
 	} else {
 		destRelPath = c.DestRelPath
 	}
-	return c.copyOneFile(c.SrcRelPath, destRelPath, tow)
+	return c.copyOneFile(c.SrcRelPath, destRelPath, now, tow)
 }
 
-func (c *CopyCommand) copyOneFile(srcRelPath, destRelPath string, tow io.Writer) (err error) {
-	now := whispertool.TimestampFromStdTime(time.Now())
+func (c *CopyCommand) copyOneFile(srcRelPath, destRelPath string, now whispertool.Timestamp, tow *textOutWriter) (err error) {
 	var until whispertool.Timestamp
 	if c.Until == 0 {
 		until = now
@@ -122,13 +150,18 @@ func (c *CopyCommand) copyOneFile(srcRelPath, destRelPath string, tow io.Writer)
 	}
 
 	if c.DestRelPath == "" {
-		fmt.Fprintf(tow, "now:%s\tsrcRel:%s\n", now, srcRelPath)
+		tow.writeContext(tow.timestampField("now", now), textOutField{"srcRel", srcRelPath})
 	} else {
-		fmt.Fprintf(tow, "now:%s\tsrcRel:%s\tdestRel:%s\n", now, srcRelPath, destRelPath)
+		tow.writeContext(tow.timestampField("now", now), textOutField{"srcRel", srcRelPath}, textOutField{"destRel", destRelPath})
 	}
 
 	var destDB *whispertool.Whisper
-	var srcHeader, destHeader *whispertool.Header
+	defer func() {
+		if destDB != nil {
+			destDB.Close()
+		}
+	}()
+	var srcHeader *whispertool.Header
 	var srcTsList, destTsList TimeSeriesList
 	var eg errgroup.Group
 	eg.Go(func() error {
@@ -146,22 +179,19 @@ func (c *CopyCommand) copyOneFile(srcRelPath, destRelPath string, tow io.Writer)
 		if err != nil {
 			return err
 		}
-		destHeader = destDB.Header()
 		destTsList, err = fetchTimeSeriesList(destDB, c.ArchiveID, c.From, until, now)
 		return err
 	})
 	if err := eg.Wait(); err != nil {
 		return err
 	}
-	defer destDB.Close()
 
-	if !srcHeader.ArchiveInfoList().Equal(destHeader.ArchiveInfoList()) {
+	if !srcHeader.ArchiveInfoList().Equal(destDB.Header().ArchiveInfoList()) {
 		return errors.New("archive info list unmatch between src and dest whisper files")
 	}
-
-	if !srcTsList.AllEqualTimeRangeAndStep(destTsList) {
-		return errors.New("timeseries time ranges and steps are unalike. " +
-			"retry reading input files before copying")
+	srcTsList, destTsList, ok := srcTsList.alignTimeRanges(destTsList)
+	if !ok {
+		return errTimeRangeUnalike
 	}
 
 	var srcPlDif, destPlDif PointsList
@@ -174,6 +204,9 @@ func (c *CopyCommand) copyOneFile(srcRelPath, destRelPath string, tow io.Writer)
 		return nil
 	}
 
+	if err := c.undoLog.write(destRelPath, destPlDif); err != nil {
+		return err
+	}
 	if err := updateFileDataWithPointsList(destDB, srcPlDif, now); err != nil {
 		return err
 	}
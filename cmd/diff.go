@@ -3,8 +3,6 @@ package cmd
 import (
 	"errors"
 	"flag"
-	"fmt"
-	"io"
 	"time"
 
 	"github.com/hnakamur/whispertool"
@@ -20,8 +18,15 @@ type DiffCommand struct {
 	DestRelPath string
 	From        whispertool.Timestamp
 	Until       whispertool.Timestamp
+	Now         whispertool.Timestamp
 	ArchiveID   int
 	TextOut     string
+	Format      string
+	TimeFormat  TimeFormat
+	Workers     int
+	Tolerance   whispertool.Tolerance
+	Summary     bool
+	Report      string
 }
 
 func (c *DiffCommand) Parse(fs *flag.FlagSet, args []string) error {
@@ -31,11 +36,23 @@ func (c *DiffCommand) Parse(fs *flag.FlagSet, args []string) error {
 	fs.StringVar(&c.DestRelPath, "dest", "", "whisper file relative path to dest base")
 	fs.IntVar(&c.ArchiveID, "archive", ArchiveIDAll, "archive ID (-1 is all).")
 	fs.StringVar(&c.TextOut, "text-out", "-", "text output of copying data. empty means no output, - means stdout, other means output file.")
-
-	fs.Var(&timestampValue{t: &c.From}, "from", "range start UTC time in 2006-01-02T15:04:05Z format")
-	fs.Var(&timestampValue{t: &c.Until}, "until", "range end UTC time in 2006-01-02T15:04:05Z format")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.IntVar(&c.Workers, "workers", 1, workersUsage)
+	setToleranceFlags(fs, &c.Tolerance)
+	fs.BoolVar(&c.Summary, "summary", false, diffSummaryUsage)
+	fs.StringVar(&c.Report, "report", "", diffReportUsage)
+
+	fs.Var(&timestampValue{t: &c.From}, "from", "range start time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Until}, "until", "range end time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
 	fs.Parse(args)
 
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
 	if c.SrcBase == "" {
 		return newRequiredOptionError(fs, "src-base")
 	}
@@ -48,26 +65,32 @@ func (c *DiffCommand) Parse(fs *flag.FlagSet, args []string) error {
 	if c.DestRelPath != "" && hasMeta(c.SrcRelPath) {
 		return errNonEmptyDestRelPathForSrcRelPathWithMeta
 	}
-	if c.From > c.Until {
+	if c.Until != 0 && c.From > c.Until {
 		return errFromIsAfterUntil
 	}
+	if err := validateTolerance(c.Tolerance); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 func (c *DiffCommand) Execute() error {
-	return withTextOutWriter(c.TextOut, c.execute)
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
 }
 
-func (c *DiffCommand) execute(tow io.Writer) (err error) {
+func (c *DiffCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
 	if hasMeta(c.SrcRelPath) {
 		t0 := time.Now()
-		fmt.Fprintf(tow, "time:%s\tmsg:start\n", formatTime(t0))
+		tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now))
 		var totalFileCount int
 		diffFound := false
 		defer func() {
 			t1 := time.Now()
-			fmt.Fprintf(tow, "time:%s\tmsg:finish\tduration:%s\ttotalFileCount:%d\tdiffFound:%v\n", formatTime(t1), t1.Sub(t0).String(), totalFileCount, diffFound)
+			tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+				textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalFileCount", totalFileCount},
+				textOutField{"diffFound", diffFound})
 		}()
 
 		filenames, err := globFiles(c.SrcBase, c.SrcRelPath)
@@ -75,15 +98,23 @@ func (c *DiffCommand) execute(tow io.Writer) (err error) {
 			return WrapFileNotExistError(Source, err)
 		}
 		totalFileCount = len(filenames)
-		for _, relPath := range filenames {
-			err = c.diffOneFile(relPath, relPath, tow)
-			if err != nil {
-				if errors.Is(err, ErrDiffFound) {
-					diffFound = true
-					continue
-				}
-				return err
+		fileReports := make([]*diffFileReport, len(filenames))
+		err = runOrderedTasks(tow, len(filenames), c.Workers, func(i int, tow *textOutWriter) error {
+			var err error
+			fileReports[i], err = c.diffOneFile(filenames[i], filenames[i], now, tow)
+			return err
+		}, func(err error) error {
+			if errors.Is(err, ErrDiffFound) {
+				diffFound = true
+				return nil
 			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err := c.writeReport(now, fileReports); err != nil {
+			return err
 		}
 		if diffFound {
 			return ErrDiffFound
@@ -97,11 +128,26 @@ func (c *DiffCommand) execute(tow io.Writer) (err error) {
 	} else {
 		destRelPath = c.DestRelPath
 	}
-	return c.diffOneFile(c.SrcRelPath, destRelPath, tow)
+	fileReport, err := c.diffOneFile(c.SrcRelPath, destRelPath, now, tow)
+	if err != nil && !errors.Is(err, ErrDiffFound) {
+		return err
+	}
+	if err2 := c.writeReport(now, []*diffFileReport{fileReport}); err2 != nil {
+		return err2
+	}
+	return err
+}
+
+func (c *DiffCommand) writeReport(now whispertool.Timestamp, fileReports []*diffFileReport) error {
+	if c.Report == "" {
+		return nil
+	}
+	return writeDiffReport(c.Report, newDiffReport(now, fileReports))
 }
 
-func (c *DiffCommand) diffOneFile(srcRelPath, destRelPath string, tow io.Writer) (err error) {
-	now := whispertool.TimestampFromStdTime(time.Now())
+// diffOneFile returns ErrDiffFound and the report of the file
+// if src and dest files are different.
+func (c *DiffCommand) diffOneFile(srcRelPath, destRelPath string, now whispertool.Timestamp, tow *textOutWriter) (*diffFileReport, error) {
 	var until whispertool.Timestamp
 	if c.Until == 0 {
 		until = now
@@ -109,10 +155,12 @@ func (c *DiffCommand) diffOneFile(srcRelPath, destRelPath string, tow io.Writer)
 		until = c.Until
 	}
 
+	fileReport := &diffFileReport{SrcRel: srcRelPath}
 	if c.DestRelPath == "" {
-		fmt.Fprintf(tow, "now:%s\tsrcRel:%s\n", now, srcRelPath)
+		tow.writeContext(tow.timestampField("now", now), textOutField{"srcRel", srcRelPath})
 	} else {
-		fmt.Fprintf(tow, "now:%s\tsrcRel:%s\tdestRel:%s\n", now, srcRelPath, destRelPath)
+		fileReport.DestRel = destRelPath
+		tow.writeContext(tow.timestampField("now", now), textOutField{"srcRel", srcRelPath}, textOutField{"destRel", destRelPath})
 	}
 
 	var srcHeader, destHeader *whispertool.Header
@@ -130,41 +178,52 @@ func (c *DiffCommand) diffOneFile(srcRelPath, destRelPath string, tow io.Writer)
 	})
 	if err := eg.Wait(); err != nil {
 		if err2 := AsFileNotExistError(err); err2 != nil {
-			fmt.Fprintf(tow, "err:%s\tsrcOrDest:%s\n", err2.cause, err2.srcOrDest)
-			return ErrDiffFound
+			tow.writeLog(textOutField{"err", err2.cause.Error()}, textOutField{"srcOrDest", err2.srcOrDest.String()})
+			fileReport.Err = err2.Error()
+			return fileReport, ErrDiffFound
 		}
-		return err
+		return nil, err
 	}
 
 	if !srcHeader.ArchiveInfoList().Equal(destHeader.ArchiveInfoList()) {
-		return errors.New("retentions unmatch between src and dest whisper files")
+		return nil, errors.New("retentions unmatch between src and dest whisper files")
 	}
-	if !srcTsList.AllEqualTimeRangeAndStep(destTsList) {
-		return errors.New("timeseries time ranges and steps are unalike. " +
-			"retry reading input files before diffing")
+	srcTsList, destTsList, ok := srcTsList.alignTimeRanges(destTsList)
+	if !ok {
+		return nil, errTimeRangeUnalike
 	}
 
-	srcPlDif, destPlDif := srcTsList.Diff(destTsList)
+	srcPlDif, destPlDif := srcTsList.DiffWithTolerance(destTsList, c.Tolerance)
 	if srcPlDif.AllEmpty() && destPlDif.AllEmpty() {
-		return nil
+		return nil, nil
 	}
 
-	if err := printDiff(tow, srcHeader, destHeader, srcPlDif, destPlDif); err != nil {
-		return err
+	fileReport.Archives = summarizeDiff(srcPlDif, destPlDif)
+	if c.Summary {
+		if err := printDiffSummary(tow, fileReport.Archives); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := printDiff(tow, srcHeader, destHeader, srcPlDif, destPlDif); err != nil {
+			return nil, err
+		}
 	}
 
-	return ErrDiffFound
+	return fileReport, ErrDiffFound
 }
 
-func printDiff(w io.Writer, srcHeader, destHeader *whispertool.Header, srcPlDif, destPlDif PointsList) error {
+func printDiff(w *textOutWriter, srcHeader, destHeader *whispertool.Header, srcPlDif, destPlDif PointsList) error {
 	for archiveID := range srcHeader.ArchiveInfoList() {
 		srcPtsDif := srcPlDif[archiveID]
 		destPtsDif := destPlDif[archiveID]
 		for i, srcPt := range srcPtsDif {
 			destPt := destPtsDif[i]
-			fmt.Fprintf(w, "archive:%d\tt:%s\tsrcVal:%s\tdestVal:%s\tdestMinusSrc:%s\n",
-				archiveID, srcPt.Time, srcPt.Value, destPt.Value, destPt.Value.Diff(srcPt.Value))
-
+			err := w.writeData(textOutField{"archive", archiveID}, w.timestampField("t", srcPt.Time),
+				textOutField{"srcVal", srcPt.Value}, textOutField{"destVal", destPt.Value},
+				textOutField{"destMinusSrc", destPt.Value.Diff(srcPt.Value)})
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/hnakamur/whispertool"
+)
+
+const diffSummaryUsage = "print a summary per archive of differing points instead of each differing point."
+
+const diffReportUsage = "JSON report file of differences for CI jobs and dashboards. empty means no report."
+
+// diffArchiveSummary is the summary of differing points in an archive.
+// Relative differences are the absolute differences divided by the larger
+// magnitude of src and dest values. Points where only one side is NaN are
+// counted in SrcOnlyNaNCount or DestOnlyNaNCount and are excluded from
+// the maximum differences. If either value is infinite, both differences
+// are +Inf, which is written as "+Inf" in the report.
+type diffArchiveSummary struct {
+	Archive          int               `json:"archive"`
+	DiffCount        int               `json:"diffCount"`
+	MaxAbsDiff       whispertool.Value `json:"maxAbsDiff"`
+	MaxRelDiff       whispertool.Value `json:"maxRelDiff"`
+	FirstTime        string            `json:"firstTime"`
+	LastTime         string            `json:"lastTime"`
+	SrcOnlyNaNCount  int               `json:"srcOnlyNaNCount"`
+	DestOnlyNaNCount int               `json:"destOnlyNaNCount"`
+
+	firstTime, lastTime whispertool.Timestamp
+}
+
+// summarizeDiff returns the summaries of archives which have differing points.
+func summarizeDiff(srcPlDif, destPlDif PointsList) []diffArchiveSummary {
+	var summaries []diffArchiveSummary
+	for archiveID, srcPtsDif := range srcPlDif {
+		if len(srcPtsDif) == 0 {
+			continue
+		}
+		destPtsDif := destPlDif[archiveID]
+		s := diffArchiveSummary{
+			Archive:   archiveID,
+			DiffCount: len(srcPtsDif),
+			firstTime: srcPtsDif[0].Time,
+			lastTime:  srcPtsDif[len(srcPtsDif)-1].Time,
+		}
+		for i, srcPt := range srcPtsDif {
+			srcVal, destVal := srcPt.Value, destPtsDif[i].Value
+			switch {
+			case srcVal.IsNaN() && destVal.IsNaN():
+			case srcVal.IsNaN():
+				s.SrcOnlyNaNCount++
+			case destVal.IsNaN():
+				s.DestOnlyNaNCount++
+			default:
+				absDiff := math.Abs(float64(destVal - srcVal))
+				if absDiff > float64(s.MaxAbsDiff) {
+					s.MaxAbsDiff = whispertool.Value(absDiff)
+				}
+				relDiff := math.Inf(1)
+				if !math.IsInf(absDiff, 0) {
+					relDiff = absDiff / math.Max(math.Abs(float64(srcVal)), math.Abs(float64(destVal)))
+				}
+				if relDiff > float64(s.MaxRelDiff) {
+					s.MaxRelDiff = whispertool.Value(relDiff)
+				}
+			}
+		}
+		s.FirstTime = s.firstTime.String()
+		s.LastTime = s.lastTime.String()
+		summaries = append(summaries, s)
+	}
+	return summaries
+}
+
+func printDiffSummary(w *textOutWriter, summaries []diffArchiveSummary) error {
+	for _, s := range summaries {
+		err := w.writeData(textOutField{"archive", s.Archive}, textOutField{"diffCount", s.DiffCount},
+			textOutField{"maxAbsDiff", s.MaxAbsDiff}, textOutField{"maxRelDiff", s.MaxRelDiff},
+			w.timestampField("firstT", s.firstTime), w.timestampField("lastT", s.lastTime),
+			textOutField{"srcOnlyNaN", s.SrcOnlyNaNCount}, textOutField{"destOnlyNaN", s.DestOnlyNaNCount})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffFileReport is the report of a file or an item which is different
+// between src and dest. Err is set when src or dest file does not exist.
+type diffFileReport struct {
+	SrcRel   string               `json:"srcRel,omitempty"`
+	DestRel  string               `json:"destRel,omitempty"`
+	Item     string               `json:"item,omitempty"`
+	Err      string               `json:"err,omitempty"`
+	Archives []diffArchiveSummary `json:"archives,omitempty"`
+}
+
+// diffReport is the content of the -report file. Files only has files or
+// items which are different.
+type diffReport struct {
+	Now               string            `json:"now"`
+	DiffFound         bool              `json:"diffFound"`
+	TotalCount        int               `json:"totalCount"`
+	DiffCount         int               `json:"diffCount"`
+	ArchiveDiffCounts []int             `json:"archiveDiffCounts,omitempty"`
+	Files             []*diffFileReport `json:"files"`
+}
+
+// newDiffReport returns a report of fileReports whose nil elements are
+// files or items without differences.
+func newDiffReport(now whispertool.Timestamp, fileReports []*diffFileReport) *diffReport {
+	r := &diffReport{
+		Now:        now.String(),
+		TotalCount: len(fileReports),
+		Files:      []*diffFileReport{},
+	}
+	for _, fr := range fileReports {
+		if fr == nil {
+			continue
+		}
+		r.DiffCount++
+		r.Files = append(r.Files, fr)
+		for _, s := range fr.Archives {
+			for len(r.ArchiveDiffCounts) <= s.Archive {
+				r.ArchiveDiffCounts = append(r.ArchiveDiffCounts, 0)
+			}
+			r.ArchiveDiffCounts[s.Archive]++
+		}
+	}
+	r.DiffFound = r.DiffCount > 0
+	return r
+}
+
+// writeDiffReport writes r to filename. The file is replaced with rename
+// so that readers never see a partially written report.
+func writeDiffReport(filename string, r *diffReport) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file for -report: %s", err)
+	}
+	tmpName := tmpFile.Name()
+	if _, err := tmpFile.Write(b); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("cannot write file for -report: %s", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("cannot close file for -report: %s", err)
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("cannot rename file for -report: %s", err)
+	}
+	return nil
+}
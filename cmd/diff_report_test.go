@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestDiffCommandSummaryAndReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := whispertool.NewHeader(whispertool.Sum, 0, archiveInfoList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nan := whispertool.Value(math.NaN())
+	writeFile := func(relPath string, values []whispertool.Value) {
+		db, err := createUpdateDestFile(filepath.Join(dir, relPath), h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pts whispertool.Points
+		for i, v := range values {
+			if !v.IsNaN() {
+				pts = append(pts, whispertool.Point{Time: now.Add(whispertool.Duration(i-len(values)+1) * whispertool.Minute), Value: v})
+			}
+		}
+		if err := db.UpdatePointsForArchive(pts, 0, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("src/a.wsp", []whispertool.Value{1, 2, 3, 4})
+	writeFile("dest/a.wsp", []whispertool.Value{1, 2, 3, 4})
+	writeFile("src/b.wsp", []whispertool.Value{1, 2, nan, 4})
+	writeFile("dest/b.wsp", []whispertool.Value{1, 4, 5, 5})
+
+	reportFilename := filepath.Join(dir, "report.json")
+	var b bytes.Buffer
+	c := &DiffCommand{
+		SrcBase:    filepath.Join(dir, "src"),
+		SrcRelPath: "*.wsp",
+		DestBase:   filepath.Join(dir, "dest"),
+		From:       now.Add(-3 * whispertool.Minute),
+		Until:      now,
+		Now:        now,
+		ArchiveID:  ArchiveIDAll,
+		Summary:    true,
+		Report:     reportFilename,
+		Workers:    2,
+	}
+	tow := &textOutWriter{Writer: &b, format: textOutFormatCSV}
+	err = c.execute(tow)
+	if !errors.Is(err, ErrDiffFound) {
+		t.Fatalf("error unmatch, got=%v, want=%v", err, ErrDiffFound)
+	}
+	wantCSV := "now,srcRel,archive,diffCount,maxAbsDiff,maxRelDiff,firstT,lastT,srcOnlyNaN,destOnlyNaN\n" +
+		"2020-06-20T12:00:00Z,b.wsp,0,3,2,0.5,2020-06-20T11:58:00Z,2020-06-20T12:00:00Z,1,0\n"
+	if err := tow.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != wantCSV {
+		t.Errorf("summary unmatch, got=%s, want=%s", got, wantCSV)
+	}
+
+	got, err := ioutil.ReadFile(reportFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotReport diffReport
+	if err := json.Unmarshal(got, &gotReport); err != nil {
+		t.Fatal(err)
+	}
+	if !gotReport.DiffFound || gotReport.TotalCount != 2 || gotReport.DiffCount != 1 ||
+		len(gotReport.Files) != 1 || gotReport.Files[0].SrcRel != "b.wsp" {
+		t.Fatalf("report unmatch, got=%s", got)
+	}
+	if s := gotReport.Files[0].Archives[0]; s.DiffCount != 3 || s.MaxAbsDiff != 2 || s.MaxRelDiff != 0.5 ||
+		s.FirstTime != "2020-06-20T11:58:00Z" || s.LastTime != "2020-06-20T12:00:00Z" || s.SrcOnlyNaNCount != 1 {
+		t.Errorf("archive summary unmatch, got=%s", got)
+	}
+
+	c.Tolerance = whispertool.Tolerance{Abs: 2, IgnoreOneSideNaN: true}
+	c.Summary = false
+	b.Reset()
+	if err := c.execute(&textOutWriter{Writer: &b, format: textOutFormatCSV}); err != nil {
+		t.Errorf("should get no diff within tolerance, got=%v", err)
+	}
+	got, err = ioutil.ReadFile(reportFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(got, &gotReport); err != nil {
+		t.Fatal(err)
+	}
+	if gotReport.DiffFound || gotReport.DiffCount != 0 || len(gotReport.Files) != 0 {
+		t.Errorf("report unmatch within tolerance, got=%s", got)
+	}
+}
+
+func TestSummarizeDiff_Inf(t *testing.T) {
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcPlDif := PointsList{{{Time: now, Value: whispertool.Value(math.Inf(1))}}}
+	destPlDif := PointsList{{{Time: now, Value: 1}}}
+	got, err := json.Marshal(summarizeDiff(srcPlDif, destPlDif))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"archive":0,"diffCount":1,"maxAbsDiff":"+Inf","maxRelDiff":"+Inf",` +
+		`"firstTime":"2020-06-20T12:00:00Z","lastTime":"2020-06-20T12:00:00Z","srcOnlyNaNCount":0,"destOnlyNaNCount":0}]`
+	if string(got) != want {
+		t.Errorf("summary unmatch, got=%s, want=%s", got, want)
+	}
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+
+	"github.com/hnakamur/whispertool"
+)
+
+// setToleranceFlags sets flags for the tolerance of diff commands to tol.
+func setToleranceFlags(fs *flag.FlagSet, tol *whispertool.Tolerance) {
+	fs.Float64Var(&tol.Abs, "abs-tolerance", 0,
+		"values are regarded as equal if the absolute difference is within this.")
+	fs.Float64Var(&tol.Rel, "rel-tolerance", 0,
+		"values are regarded as equal if the difference relative to the larger magnitude is within this (ex. 1e-9).")
+	fs.Uint64Var(&tol.ULP, "ulp-tolerance", 0,
+		"values are regarded as equal if the number of representable float64 values between them is within this.")
+	fs.BoolVar(&tol.IgnoreOneSideNaN, "ignore-one-side-nan", false,
+		"ignore points where only one of src and dest values is NaN.")
+}
+
+func validateTolerance(tol whispertool.Tolerance) error {
+	if tol.Abs < 0 {
+		return errors.New("abs-tolerance must not be negative")
+	}
+	if tol.Rel < 0 {
+		return errors.New("rel-tolerance must not be negative")
+	}
+	return nil
+}
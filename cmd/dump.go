@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hnakamur/whispertool"
+)
+
+// Names of formats for the -format option of the dump subcommand.
+const (
+	dumpFormatLTSV   = "ltsv"
+	dumpFormatNDJSON = "ndjson"
+)
+
+// canonicalNaNBits is the bits of NaN which is written as "NaN" in dumps.
+// Other NaNs are written with their bits to restore them as they are.
+var canonicalNaNBits = math.Float64bits(math.NaN())
+
+type DumpCommand struct {
+	SrcBase    string
+	SrcRelPath string
+	Out        string
+	Format     string
+}
+
+func (c *DumpCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.SrcBase, "src-base", "", "src base directory or URL of \"whispertool server\"")
+	fs.StringVar(&c.SrcRelPath, "src", "", "whisper file relative path to src base")
+	fs.StringVar(&c.Out, "out", "-", "dump output file. - means stdout.")
+	fs.StringVar(&c.Format, "format", dumpFormatLTSV, `format of dump. "ltsv" or "ndjson"`)
+	fs.Parse(args)
+
+	if c.SrcBase == "" {
+		return newRequiredOptionError(fs, "src-base")
+	}
+	if c.SrcRelPath == "" {
+		return newRequiredOptionError(fs, "src")
+	}
+	if c.Format != dumpFormatLTSV && c.Format != dumpFormatNDJSON {
+		return errors.New(`format must be "ltsv" or "ndjson"`)
+	}
+	return nil
+}
+
+func (c *DumpCommand) Execute() error {
+	h, ptsList, err := readWhisperFileRaw(c.SrcBase, c.SrcRelPath, ArchiveIDAll)
+	if err != nil {
+		return err
+	}
+
+	if c.Out == "-" {
+		return writeDump(os.Stdout, c.Format, h, ptsList)
+	}
+
+	file, err := os.Create(c.Out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if err := writeDump(w, c.Format, h, ptsList); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// writeDump writes the header and all raw points of a whisper file.
+// Each point has the slot index in the archive, so the ring buffer
+// positions are kept. Empty slots which have zero time and zero value
+// are omitted since they are filled with zeros on restore.
+func writeDump(w io.Writer, format string, h *whispertool.Header, ptsList PointsList) error {
+	if format == dumpFormatNDJSON {
+		b, err := json.Marshal(struct {
+			Header *whispertool.Header `json:"header"`
+		}{Header: h})
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", b); err != nil {
+			return err
+		}
+	} else {
+		if _, err := io.WriteString(w, h.String()); err != nil {
+			return err
+		}
+	}
+
+	for archiveID, pts := range ptsList {
+		for slot, p := range pts {
+			if p.Time == 0 && math.Float64bits(float64(p.Value)) == 0 {
+				continue
+			}
+
+			var err error
+			val := formatDumpValue(p.Value)
+			if format == dumpFormatNDJSON {
+				if !math.IsNaN(float64(p.Value)) && !math.IsInf(float64(p.Value), 0) {
+					_, err = fmt.Fprintf(w, `{"archive":%d,"slot":%d,"t":%d,"val":%s}`+"\n",
+						archiveID, slot, uint32(p.Time), val)
+				} else {
+					_, err = fmt.Fprintf(w, `{"archive":%d,"slot":%d,"t":%d,"val":%q}`+"\n",
+						archiveID, slot, uint32(p.Time), val)
+				}
+			} else {
+				_, err = fmt.Fprintf(w, "archive:%d\tslot:%d\tt:%d\tval:%s\n",
+					archiveID, slot, uint32(p.Time), val)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatDumpValue(v whispertool.Value) string {
+	if v.IsNaN() {
+		if bits := math.Float64bits(float64(v)); bits != canonicalNaNBits {
+			return fmt.Sprintf("NaN:%016x", bits)
+		}
+		return "NaN"
+	}
+	return v.String()
+}
+
+func parseDumpValue(s string) (whispertool.Value, error) {
+	if strings.HasPrefix(s, "NaN:") {
+		bits, err := strconv.ParseUint(s[len("NaN:"):], 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid NaN value: %s", s)
+		}
+		return whispertool.Value(math.Float64frombits(bits)), nil
+	}
+	if s == "NaN" {
+		return whispertool.Value(math.Float64frombits(canonicalNaNBits)), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value: %s", s)
+	}
+	return whispertool.Value(f), nil
+}
+
+// dumpData is the content of a dump read by readDump.
+type dumpData struct {
+	aggregationMethod whispertool.AggregationMethod
+	xFilesFactor      float32
+	archiveInfoList   whispertool.ArchiveInfoList
+	offsets           []uint32
+	ptsList           PointsList
+}
+
+type dumpPoint struct {
+	archiveID int
+	slot      int
+	point     whispertool.Point
+}
+
+// readDump reads a dump written by writeDump.
+// The format is detected for each line, so both of LTSV and NDJSON are accepted.
+func readDump(r io.Reader) (*dumpData, error) {
+	d := &dumpData{}
+	var headerFound bool
+	var archiveCount int
+	var points []dumpPoint
+
+	s := bufio.NewScanner(r)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+
+		var err error
+		if line[0] == '{' {
+			var p *dumpPoint
+			p, err = d.parseNDJSONLine(line)
+			if p != nil {
+				points = append(points, *p)
+			} else if err == nil {
+				headerFound = true
+				archiveCount = len(d.archiveInfoList)
+			}
+		} else {
+			fields := parseLTSVLine(line)
+			switch {
+			case fields["aggMethod"] != "":
+				headerFound = true
+				archiveCount, err = d.parseLTSVHeader(fields)
+			case fields["archiveInfo"] != "":
+				err = d.parseLTSVArchiveInfo(fields)
+			case fields["archive"] != "":
+				var p dumpPoint
+				p, err = parseLTSVPoint(fields)
+				points = append(points, p)
+			default:
+				err = errors.New("unknown record")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if !headerFound {
+		return nil, errors.New("header not found in dump")
+	}
+	if len(d.archiveInfoList) != archiveCount {
+		return nil, fmt.Errorf("archive count unmatch, got=%d, want=%d",
+			len(d.archiveInfoList), archiveCount)
+	}
+
+	d.ptsList = make(PointsList, len(d.archiveInfoList))
+	for i, r := range d.archiveInfoList {
+		d.ptsList[i] = make(whispertool.Points, r.NumberOfPoints())
+	}
+	for _, p := range points {
+		if p.archiveID < 0 || p.archiveID >= len(d.ptsList) {
+			return nil, fmt.Errorf("archive ID out of range: %d", p.archiveID)
+		}
+		if p.slot < 0 || p.slot >= len(d.ptsList[p.archiveID]) {
+			return nil, fmt.Errorf("slot out of range in archive %d: %d", p.archiveID, p.slot)
+		}
+		d.ptsList[p.archiveID][p.slot] = p.point
+	}
+	return d, nil
+}
+
+func (d *dumpData) parseLTSVHeader(fields map[string]string) (archiveCount int, err error) {
+	d.aggregationMethod, err = whispertool.AggregationMethodString(fields["aggMethod"])
+	if err != nil {
+		return 0, err
+	}
+	// NOTE: The label is "xFileFactor" in whispertool.Header.String.
+	xff, err := strconv.ParseFloat(fields["xFileFactor"], 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid xFileFactor: %s", fields["xFileFactor"])
+	}
+	d.xFilesFactor = float32(xff)
+	archiveCount, err = strconv.Atoi(fields["archiveCount"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid archiveCount: %s", fields["archiveCount"])
+	}
+	return archiveCount, nil
+}
+
+func (d *dumpData) parseLTSVArchiveInfo(fields map[string]string) error {
+	archiveID, err := strconv.Atoi(fields["archiveInfo"])
+	if err != nil || archiveID != len(d.archiveInfoList) {
+		return fmt.Errorf("unexpected archiveInfo: %s", fields["archiveInfo"])
+	}
+	step, err := whispertool.ParseDuration(fields["durationPerPoint"])
+	if err != nil {
+		return err
+	}
+	n, err := strconv.ParseUint(fields["numberOfPoints"], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid numberOfPoints: %s", fields["numberOfPoints"])
+	}
+	offset, err := strconv.ParseUint(fields["offset"], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid offset: %s", fields["offset"])
+	}
+	d.archiveInfoList = append(d.archiveInfoList, whispertool.NewArchiveInfo(step, uint32(n)))
+	d.offsets = append(d.offsets, uint32(offset))
+	return nil
+}
+
+func parseLTSVPoint(fields map[string]string) (dumpPoint, error) {
+	archiveID, err := strconv.Atoi(fields["archive"])
+	if err != nil {
+		return dumpPoint{}, fmt.Errorf("invalid archive: %s", fields["archive"])
+	}
+	slot, err := strconv.Atoi(fields["slot"])
+	if err != nil {
+		return dumpPoint{}, fmt.Errorf("invalid slot: %s", fields["slot"])
+	}
+	t, err := strconv.ParseUint(fields["t"], 10, 32)
+	if err != nil {
+		return dumpPoint{}, fmt.Errorf("invalid t: %s", fields["t"])
+	}
+	v, err := parseDumpValue(fields["val"])
+	if err != nil {
+		return dumpPoint{}, err
+	}
+	return dumpPoint{
+		archiveID: archiveID,
+		slot:      slot,
+		point:     whispertool.Point{Time: whispertool.Timestamp(t), Value: v},
+	}, nil
+}
+
+// parseNDJSONLine parses a line in NDJSON format. It returns a non-nil point
+// for a point record, or sets the header to d for a header record.
+func (d *dumpData) parseNDJSONLine(line string) (*dumpPoint, error) {
+	var rec struct {
+		Header *struct {
+			AggMethod       string  `json:"aggMethod"`
+			XFilesFactor    float32 `json:"xFilesFactor"`
+			ArchiveInfoList []struct {
+				SecondsPerPoint int32  `json:"secondsPerPoint"`
+				NumberOfPoints  uint32 `json:"numberOfPoints"`
+				Offset          uint32 `json:"offset"`
+			} `json:"archiveInfoList"`
+		} `json:"header"`
+		Archive *int            `json:"archive"`
+		Slot    int             `json:"slot"`
+		T       uint32          `json:"t"`
+		Val     json.RawMessage `json:"val"`
+	}
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		return nil, err
+	}
+
+	if rec.Header != nil {
+		var err error
+		d.aggregationMethod, err = whispertool.AggregationMethodString(rec.Header.AggMethod)
+		if err != nil {
+			return nil, err
+		}
+		d.xFilesFactor = rec.Header.XFilesFactor
+		for _, a := range rec.Header.ArchiveInfoList {
+			d.archiveInfoList = append(d.archiveInfoList,
+				whispertool.NewArchiveInfo(whispertool.Duration(a.SecondsPerPoint), a.NumberOfPoints))
+			d.offsets = append(d.offsets, a.Offset)
+		}
+		return nil, nil
+	}
+
+	if rec.Archive == nil {
+		return nil, errors.New("unknown record")
+	}
+	val := string(rec.Val)
+	if len(rec.Val) > 0 && rec.Val[0] == '"' {
+		if err := json.Unmarshal(rec.Val, &val); err != nil {
+			return nil, err
+		}
+	}
+	v, err := parseDumpValue(val)
+	if err != nil {
+		return nil, err
+	}
+	return &dumpPoint{
+		archiveID: *rec.Archive,
+		slot:      rec.Slot,
+		point:     whispertool.Point{Time: whispertool.Timestamp(rec.T), Value: v},
+	}, nil
+}
+
+// parseLTSVLine parses a line in LTSV format.
+func parseLTSVLine(line string) map[string]string {
+	fields := make(map[string]string)
+	for _, f := range strings.Split(line, "\t") {
+		i := strings.IndexByte(f, ':')
+		if i == -1 {
+			continue
+		}
+		fields[f[:i]] = f[i+1:]
+	}
+	return fields
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestDumpRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:5m,5m:1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcFilename := filepath.Join(dir, "src.wsp")
+	db, err := whispertool.Create(srcFilename, archiveInfoList, whispertool.Sum, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write more points than the number of points of the archive 0
+	// to make the ring buffer wrap around.
+	for i := 7; i >= 0; i-- {
+		err := db.UpdatePointForArchive(0, now.Add(-whispertool.Duration(i)*whispertool.Minute),
+			whispertool.Value(i)+0.1, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pts, err := db.GetAllRawUnsortedPoints(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pts[5] = whispertool.Point{Time: now.Add(-whispertool.Hour / 2), Value: whispertool.Value(math.NaN())}
+	pts[6] = whispertool.Point{
+		Time:  now.Add(-whispertool.Hour / 3),
+		Value: whispertool.Value(math.Float64frombits(0x7ff8000000000000)),
+	}
+	if err := db.PutAllRawUnsortedPoints(1, pts); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(srcFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{dumpFormatLTSV, dumpFormatNDJSON} {
+		h, ptsList, err := readWhisperFileRawLocal(srcFilename, ArchiveIDAll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := writeDump(&b, format, h, ptsList); err != nil {
+			t.Fatal(err)
+		}
+		d, err := readDump(&b)
+		if err != nil {
+			t.Fatalf("readDump failed for format %s: %s", format, err)
+		}
+		destFilename := filepath.Join(dir, format+".wsp")
+		if err := restoreWhisperFile(destFilename, d); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(destFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("restored file unmatch for format %s", format)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hnakamur/whispertool"
+)
+
+type ExportOpenMetricsCommand struct {
+	SrcBase    string
+	SrcPattern string
+	From       whispertool.Timestamp
+	Until      whispertool.Timestamp
+	Now        whispertool.Timestamp
+	Rules      openMetricsRules
+	Out        string
+}
+
+// openMetricsFile is a whisper file and its series to export.
+type openMetricsFile struct {
+	relPath string
+	series  openMetricsSeries
+	key     string
+}
+
+func (c *ExportOpenMetricsCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.SrcBase, "src-base", "", "src base directory or URL of \"whispertool server\"")
+	fs.StringVar(&c.SrcPattern, "src", "", "whisper file glob pattern relative to src base (ex. sys/*/cpu/*.wsp).")
+	fs.Var(&timestampValue{t: &c.From}, "from", "range start time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Until}, "until", "range end time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
+	fs.Var(&openMetricsRulesValue{&c.Rules}, "rule",
+		`rewrite rule of item path to metric name and labels, "<regexp> <template>" (ex. '^sys\.([^.]+)\.cpu\.(\w+)$ node_cpu_$2{host="$1"}'). `+
+			`can be specified multiple times and the first matching rule is used. item paths which match no rules are used as names with "." replaced with "_".`)
+	fs.StringVar(&c.Out, "out", "-", "output file. - means stdout.")
+	fs.Parse(args)
+
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
+	if c.SrcBase == "" {
+		return newRequiredOptionError(fs, "src-base")
+	}
+	if c.SrcPattern == "" {
+		return newRequiredOptionError(fs, "src")
+	}
+	if c.Until != 0 && c.From > c.Until {
+		return errFromIsAfterUntil
+	}
+	return nil
+}
+
+func (c *ExportOpenMetricsCommand) Execute() error {
+	if c.Out == "-" {
+		return c.execute(os.Stdout)
+	}
+
+	file, err := os.Create(c.Out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if err := c.execute(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func (c *ExportOpenMetricsCommand) execute(w io.Writer) error {
+	now := nowOrCurrent(c.Now)
+	var until whispertool.Timestamp
+	if c.Until == 0 {
+		until = now
+	} else {
+		until = c.Until
+	}
+
+	files, err := c.globFiles()
+	if err != nil {
+		return err
+	}
+
+	// NOTE: OpenMetrics requires samples of a metric family to be
+	// written together, so files are sorted by metric name first.
+	var lastName string
+	for i, f := range files {
+		if i > 0 && f.key == files[i-1].key {
+			return fmt.Errorf("same series %s for %s and %s", f.key, files[i-1].relPath, f.relPath)
+		}
+		if i == 0 || f.series.name != lastName {
+			if _, err := fmt.Fprintf(w, "# TYPE %s gauge\n", f.series.name); err != nil {
+				return err
+			}
+			lastName = f.series.name
+		}
+
+		h, tsList, err := readWhisperFile(c.SrcBase, f.relPath, ArchiveIDAll, c.From, until, now)
+		if err != nil {
+			return err
+		}
+		if err := writeOpenMetricsSamples(w, f.key, h, tsList, now); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "# EOF\n")
+	return err
+}
+
+func (c *ExportOpenMetricsCommand) globFiles() ([]openMetricsFile, error) {
+	relPaths, err := globFiles(c.SrcBase, c.SrcPattern)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]openMetricsFile, len(relPaths))
+	for i, relPath := range relPaths {
+		item := relDirToItem(strings.TrimSuffix(relPath, ".wsp"))
+		s := c.Rules.series(item)
+		files[i] = openMetricsFile{relPath: relPath, series: s, key: s.String()}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].series.name != files[j].series.name {
+			return files[i].series.name < files[j].series.name
+		}
+		return files[i].key < files[j].key
+	})
+	return files, nil
+}
+
+// writeOpenMetricsSamples writes non-NaN points in ascending order of time.
+// Each point is taken from the archive which Whisper.Fetch would choose
+// for the time, so points are from the finest archive which covers them.
+func writeOpenMetricsSamples(w io.Writer, key string, h *whispertool.Header, tsList TimeSeriesList, now whispertool.Timestamp) error {
+	for archiveID := len(tsList) - 1; archiveID >= 0; archiveID-- {
+		ts := tsList[archiveID]
+		if ts == nil {
+			continue
+		}
+		for _, p := range ts.Points() {
+			if p.Value.IsNaN() || findBestArchive(h, p.Time, now) != archiveID {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "%s %s %d\n", key, formatOpenMetricsValue(p.Value), p.Time); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findBestArchive returns the ID of the archive which has the finest
+// precision and covers the time t, that is same as Whisper.Fetch.
+func findBestArchive(h *whispertool.Header, t, now whispertool.Timestamp) int {
+	var archiveID int
+	diff := now.Sub(t)
+	for i, r := range h.ArchiveInfoList() {
+		archiveID = i
+		if r.MaxRetention() >= diff {
+			break
+		}
+	}
+	return archiveID
+}
+
+func formatOpenMetricsValue(v whispertool.Value) string {
+	f := float64(v)
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestOpenMetricsRules(t *testing.T) {
+	var rules openMetricsRules
+	v := openMetricsRulesValue{&rules}
+	for _, s := range []string{
+		`^sys\.([^.]+)\.cpu\.(\w+)$ node_cpu_${2}_total{host="$1",mode="$2"}`,
+		`^app\.(?P<app>[^.]+)\.requests$ requests{app="${app}",note="a\"b"}`,
+	} {
+		if err := v.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		item string
+		want string
+	}{
+		{item: "sys.web-01.cpu.user", want: `node_cpu_user_total{host="web-01",mode="user"}`},
+		{item: "app.shop.requests", want: `requests{app="shop",note="a\"b"}`},
+		{item: "app.shop.errors", want: `app_shop_errors`},
+		{item: "1st.metric", want: `_st_metric`},
+	}
+	for _, tc := range testCases {
+		if got := rules.series(tc.item).String(); got != tc.want {
+			t.Errorf("series unmatch for item %s, got=%s, want=%s", tc.item, got, tc.want)
+		}
+	}
+
+	for _, s := range []string{
+		`^a$`,
+		`^a$ a{b}`,
+		`^a$ a{1b="c"}`,
+		`^a$ a{b="c"`,
+		`^a$ {b="c"}`,
+	} {
+		if err := v.Set(s); err == nil {
+			t.Errorf("should get error for rule %s", s)
+		}
+	}
+}
+
+func TestExportOpenMetricsCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:5m,5m:30m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := whispertool.NewHeader(whispertool.Average, 0, archiveInfoList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, relPath := range []string{"sys/web01/cpu/user.wsp", "other/a/b/x.wsp"} {
+		db, err := createUpdateDestFile(filepath.Join(dir, relPath), h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdatePointsForArchive(whispertool.Points{
+			{Time: now - 240, Value: 1},
+			{Time: now - 60, Value: 3},
+		}, 0, now); err != nil {
+			t.Fatal(err)
+		}
+		// The point at now-300 is written to the archive 1 but it is not
+		// exported since the archive 0 covers it.
+		if err := db.UpdatePointsForArchive(whispertool.Points{
+			{Time: now - 1500, Value: 10},
+			{Time: now - 1200, Value: 20},
+			{Time: now - 300, Value: 30},
+		}, 1, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &ExportOpenMetricsCommand{
+		SrcBase:    dir,
+		SrcPattern: "*/*/*/*.wsp",
+		Now:        now,
+	}
+	if err := (openMetricsRulesValue{&c.Rules}).Set(`^sys\.([^.]+)\.cpu\.(\w+)$ cpu_$2{host="$1"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.execute(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "# TYPE cpu_user gauge\n" +
+		"cpu_user{host=\"web01\"} 10 1592652900\n" +
+		"cpu_user{host=\"web01\"} 20 1592653200\n" +
+		"cpu_user{host=\"web01\"} 1 1592654160\n" +
+		"cpu_user{host=\"web01\"} 3 1592654340\n" +
+		"# TYPE other_a_b_x gauge\n" +
+		"other_a_b_x 10 1592652900\n" +
+		"other_a_b_x 20 1592653200\n" +
+		"other_a_b_x 1 1592654160\n" +
+		"other_a_b_x 3 1592654340\n" +
+		"# EOF\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output unmatch, got=\n%s\nwant=\n%s", got, want)
+	}
+}
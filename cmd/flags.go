@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hnakamur/whispertool"
@@ -20,26 +21,67 @@ type Command interface {
 	Execute() error
 }
 
+// timeExprHelp is the help text for formats of timestampValue.
+const timeExprHelp = `in one of formats: 2006-01-02T15:04:05Z, 2006-01-02T15:04:05+09:00, "2006-01-02T15:04:05 Asia/Tokyo", Unix seconds (1136214245), now, -1h, now-2d`
+
 type timestampValue struct {
-	t *whispertool.Timestamp
+	t    *whispertool.Timestamp
+	expr string
 }
 
-func (t timestampValue) String() string {
+func (t *timestampValue) String() string {
 	if t.t == nil {
 		return ""
 	}
 	return t.t.ToStdTime().Format(whispertool.UTCTimeLayout)
 }
 
-func (t timestampValue) Set(s string) error {
-	t2, err := time.Parse(whispertool.UTCTimeLayout, s)
+// Set parses s with whispertool.ParseTimestampRelativeTo.
+// Relative expressions like "-1h" are relative to the current time here,
+// and they are evaluated again in resolveNow.
+func (t *timestampValue) Set(s string) error {
+	t2, err := whispertool.ParseTimestampRelativeTo(s, whispertool.TimestampFromStdTime(time.Now()))
 	if err != nil {
 		return err
 	}
-	*t.t = whispertool.TimestampFromStdTime(t2)
+	*t.t = t2
+	t.expr = s
 	return nil
 }
 
+// nowUsage is the help text for the -now option.
+const nowUsage = "current time used for selecting archives and default time ranges, " +
+	"and relative -from and -until are relative to this. default is the time when the command started. " + timeExprHelp
+
+// resolveNow sets now to the current time if it is zero, and
+// evaluates relative time expressions in flags other than -now
+// against now so that the whole command run uses the same now.
+func resolveNow(fs *flag.FlagSet, now *whispertool.Timestamp) error {
+	if *now == 0 {
+		*now = whispertool.TimestampFromStdTime(time.Now())
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		v, ok := f.Value.(*timestampValue)
+		if !ok || v.t == now || err != nil {
+			return
+		}
+		*v.t, err = whispertool.ParseTimestampRelativeTo(v.expr, *now)
+		if err != nil {
+			err = fmt.Errorf("invalid value %q for flag -%s: %s", v.expr, f.Name, err)
+		}
+	})
+	return err
+}
+
+// nowOrCurrent returns now if it is not zero, or the current time otherwise.
+func nowOrCurrent(now whispertool.Timestamp) whispertool.Timestamp {
+	if now == 0 {
+		return whispertool.TimestampFromStdTime(time.Now())
+	}
+	return now
+}
+
 type fileModeValue struct {
 	m *os.FileMode
 }
@@ -60,6 +102,23 @@ func (v fileModeValue) Set(s string) error {
 	return nil
 }
 
+// stringsValue is a flag value which can be specified multiple times.
+type stringsValue struct {
+	ss *[]string
+}
+
+func (v stringsValue) String() string {
+	if v.ss == nil {
+		return ""
+	}
+	return strings.Join(*v.ss, ",")
+}
+
+func (v stringsValue) Set(s string) error {
+	*v.ss = append(*v.ss, s)
+	return nil
+}
+
 type aggregationMethodValue struct {
 	m *whispertool.AggregationMethod
 }
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestResolveNow(t *testing.T) {
+	testCases := []struct {
+		args      []string
+		wantFrom  string
+		wantUntil string
+		wantNow   string
+	}{
+		{
+			args:      []string{"-from", "-1h", "-until", "now-30min", "-now", "2020-06-20T12:00:00Z"},
+			wantFrom:  "2020-06-20T11:00:00Z",
+			wantUntil: "2020-06-20T11:30:00Z",
+			wantNow:   "2020-06-20T12:00:00Z",
+		},
+		{
+			args:      []string{"-now", "2020-06-20T21:00:00+09:00", "-from", "2020-06-20T10:00:00Z", "-until", "-1d"},
+			wantFrom:  "2020-06-20T10:00:00Z",
+			wantUntil: "2020-06-19T12:00:00Z",
+			wantNow:   "2020-06-20T12:00:00Z",
+		},
+	}
+	for _, tc := range testCases {
+		var from, until, now whispertool.Timestamp
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		fs.Var(&timestampValue{t: &from}, "from", "")
+		fs.Var(&timestampValue{t: &until}, "until", "")
+		fs.Var(&timestampValue{t: &now}, "now", "")
+		if err := fs.Parse(tc.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := resolveNow(fs, &now); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := from.String(), tc.wantFrom; got != want {
+			t.Errorf("from unmatch for args %v, got=%s, want=%s", tc.args, got, want)
+		}
+		if got, want := until.String(), tc.wantUntil; got != want {
+			t.Errorf("until unmatch for args %v, got=%s, want=%s", tc.args, got, want)
+		}
+		if got, want := now.String(), tc.wantNow; got != want {
+			t.Errorf("now unmatch for args %v, got=%s, want=%s", tc.args, got, want)
+		}
+	}
+}
+
+func TestParseFromWithoutUntil(t *testing.T) {
+	testCases := []struct {
+		cmd interface {
+			Parse(*flag.FlagSet, []string) error
+		}
+		args []string
+	}{
+		{cmd: &ViewCommand{}, args: []string{"-src-base", "src", "-src", "a.wsp"}},
+		{cmd: &ViewRawCommand{}, args: []string{"-src-base", "src", "-src", "a.wsp"}},
+		{cmd: &DiffCommand{}, args: []string{"-src-base", "src", "-src", "a.wsp", "-dest-base", "dest"}},
+		{cmd: &CopyCommand{}, args: []string{"-src-base", "src", "-src", "a.wsp", "-dest-base", "dest",
+			"-agg-method", "sum", "-retentions", "1m:1h"}},
+		{cmd: &ExportOpenMetricsCommand{}, args: []string{"-src-base", "src", "-src", "a.wsp"}},
+	}
+	for _, tc := range testCases {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		if err := tc.cmd.Parse(fs, append(tc.args, "-from", "-1h")); err != nil {
+			t.Errorf("%T: should accept -from -1h without -until, err=%v", tc.cmd, err)
+		}
+
+		fs = flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		if err := tc.cmd.Parse(fs, append(tc.args, "-from", "-1h", "-until", "-2h")); err != errFromIsAfterUntil {
+			t.Errorf("%T: err unmatch for -from after -until, got=%v, want=%v", tc.cmd, err, errFromIsAfterUntil)
+		}
+	}
+}
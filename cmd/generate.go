@@ -4,7 +4,6 @@ import (
 	crand "crypto/rand"
 	"encoding/binary"
 	"flag"
-	"io"
 	"math/rand"
 	"os"
 	"time"
@@ -20,7 +19,10 @@ type GenerateCommand struct {
 	ArchiveInfoList   whispertool.ArchiveInfoList
 	RandMax           int
 	Fill              bool
+	Now               whispertool.Timestamp
 	TextOut           string
+	Format            string
+	TimeFormat        TimeFormat
 }
 
 func (c *GenerateCommand) Parse(fs *flag.FlagSet, args []string) error {
@@ -35,10 +37,19 @@ func (c *GenerateCommand) Parse(fs *flag.FlagSet, args []string) error {
 	fs.IntVar(&c.RandMax, "max", 100, "random max value for shortest retention unit")
 	fs.BoolVar(&c.Fill, "fill", true, "fill with random data")
 
+	fs.Var(&timestampValue{t: &c.Now}, "now", "current time used as the time of the latest points. default is the time when the command started. "+timeExprHelp)
+
 	fs.StringVar(&c.TextOut, "text-out", "", "text output of copying data. empty means no output, - means stdout, other means output file")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
 
 	fs.Parse(args)
 
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
 	if c.AggregationMethod == 0 {
 		return newRequiredOptionError(fs, "agg-method")
 	}
@@ -53,10 +64,10 @@ func (c *GenerateCommand) Parse(fs *flag.FlagSet, args []string) error {
 }
 
 func (c *GenerateCommand) Execute() error {
-	return withTextOutWriter(c.TextOut, c.execute)
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
 }
 
-func (c *GenerateCommand) execute(tow io.Writer) (err error) {
+func (c *GenerateCommand) execute(tow *textOutWriter) (err error) {
 	db, err := whispertool.Create(c.Dest, c.ArchiveInfoList, c.AggregationMethod, c.XFilesFactor)
 	if err != nil {
 		return err
@@ -66,7 +77,7 @@ func (c *GenerateCommand) execute(tow io.Writer) (err error) {
 	var ptsList PointsList
 	if c.Fill {
 		rnd := rand.New(rand.NewSource(newRandSeed()))
-		now := whispertool.TimestampFromStdTime(time.Now())
+		now := nowOrCurrent(c.Now)
 		until := now
 		ptsList = randomPointsList(c.ArchiveInfoList, rnd, c.RandMax, until, now)
 		if err := updateFileDataWithPointsList(db, ptsList, now); err != nil {
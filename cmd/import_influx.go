@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+)
+
+type ImportInfluxCommand struct {
+	In                string
+	Template          string
+	Precision         string
+	DestBase          string
+	AggregationMethod whispertool.AggregationMethod
+	XFilesFactor      float32
+	ArchiveInfoList   whispertool.ArchiveInfoList
+	Now               whispertool.Timestamp
+	DryRun            bool
+	TextOut           string
+	Format            string
+	TimeFormat        TimeFormat
+
+	template *influxTemplate
+}
+
+func (c *ImportInfluxCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.In, "in", "-", "input file of InfluxDB line protocol. - means stdin.")
+	fs.StringVar(&c.Template, "template", defaultInfluxTemplate,
+		`template to map series and field to metric path like Telegraf graphite serializer. parts are "measurement", "field", "tags" or tag keys.`)
+	fs.StringVar(&c.Precision, "precision", influxPrecisionNanosecond, `precision of timestamps. "ns", "us", "ms" or "s"`)
+	fs.StringVar(&c.DestBase, "dest-base", "", "dest base directory")
+
+	fs.Var(&aggregationMethodValue{&c.AggregationMethod}, "agg-method", "aggregation method for creating missing files")
+	fs.Var(&xFilesFactorValue{&c.XFilesFactor}, "x-files-factor", "xFilesFactor for creating missing files")
+	fs.Var(&archiveInfoListValue{&c.ArchiveInfoList}, "retentions", "retentions definitions for creating missing files. empty means missing files are errors.")
+
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
+	fs.BoolVar(&c.DryRun, "dry-run", false, "show what would be updated without writing files")
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of importing data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.Parse(args)
+
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
+	if c.DestBase == "" {
+		return newRequiredOptionError(fs, "dest-base")
+	}
+	if isBaseURL(c.DestBase) {
+		return errors.New("dest-base must be local directory")
+	}
+	switch c.Precision {
+	case influxPrecisionNanosecond, influxPrecisionMicrosecond, influxPrecisionMillisecond, influxPrecisionSecond:
+	default:
+		return errors.New(`precision must be one of "ns", "us", "ms" or "s"`)
+	}
+	if c.ArchiveInfoList != nil && c.AggregationMethod == 0 {
+		return newRequiredOptionError(fs, "agg-method")
+	}
+	return nil
+}
+
+func (c *ImportInfluxCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *ImportInfluxCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
+	t0 := time.Now()
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now),
+		textOutField{"dryRun", c.DryRun})
+	var totalFileCount, totalUpdated, totalSkipped int
+	defer func() {
+		t1 := time.Now()
+		tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+			textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalFileCount", totalFileCount},
+			textOutField{"totalUpdated", totalUpdated}, textOutField{"totalSkipped", totalSkipped},
+			textOutField{"dryRun", c.DryRun})
+	}()
+
+	c.template, err = parseInfluxTemplate(c.Template)
+	if err != nil {
+		return err
+	}
+	rows, err := c.readRows(now)
+	if err != nil {
+		return err
+	}
+
+	u := &UpdateCommand{
+		DestBase:          c.DestBase,
+		AggregationMethod: c.AggregationMethod,
+		XFilesFactor:      c.XFilesFactor,
+		ArchiveInfoList:   c.ArchiveInfoList,
+		DryRun:            c.DryRun,
+	}
+	totalFileCount, totalUpdated, totalSkipped, err = u.updateFiles(tow, rows, now)
+	return err
+}
+
+func (c *ImportInfluxCommand) readRows(now whispertool.Timestamp) ([]updateRow, error) {
+	if c.In == "-" {
+		return readInfluxRows(os.Stdin, c.template, c.Precision, now)
+	}
+
+	file, err := os.Open(c.In)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := readInfluxRows(file, c.template, c.Precision, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", c.In, err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestImportInfluxCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.txt")
+	lines := "cpu,host=web01 usage=7 1592647200\n" +
+		"cpu,host=web01 usage=1.5 1592654340\n" +
+		"cpu,host=web01 usage=2.5 1592654400\n" +
+		"mem,host=web01 value=3 1592654400\n"
+	if err := ioutil.WriteFile(input, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:1h,5m:1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ImportInfluxCommand{
+		In:                input,
+		Template:          defaultInfluxTemplate,
+		Precision:         influxPrecisionSecond,
+		DestBase:          dir,
+		AggregationMethod: whispertool.Sum,
+		ArchiveInfoList:   archiveInfoList,
+		Now:               now,
+		DryRun:            true,
+	}
+	if err := c.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	cpuFilename := filepath.Join(dir, "web01", "cpu", "usage.wsp")
+	if _, err := os.Stat(cpuFilename); !os.IsNotExist(err) {
+		t.Fatalf("file should not be created in dry run, err=%v", err)
+	}
+
+	c.DryRun = false
+	if err := c.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	_, tsList, err := readWhisperFileLocal(cpuFilename, 0, now.Add(-2*whispertool.Minute), now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tsList[0].Values(), []whispertool.Value{1.5, 2.5}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("values unmatch for %s, got=%v, want=%v", cpuFilename, got, want)
+	}
+	// The point older than archive 0 goes to archive 1 and newer points still go to archive 0.
+	_, tsList, err = readWhisperFileLocal(cpuFilename, 1, now.Add(-2*whispertool.Hour-5*whispertool.Minute), now.Add(-2*whispertool.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tsList[1].Values(); len(got) != 1 || got[0] != 7 {
+		t.Errorf("archive 1 values unmatch for %s, got=%v, want=[7]", cpuFilename, got)
+	}
+	memFilename := filepath.Join(dir, "web01", "mem.wsp")
+	_, tsList, err = readWhisperFileLocal(memFilename, 0, now.Add(-2*whispertool.Minute), now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tsList[0].Values(); len(got) != 2 || !got[0].IsNaN() || got[1] != 3 {
+		t.Errorf("values unmatch for %s, got=%v, want=[NaN 3]", memFilename, got)
+	}
+
+	c.In = filepath.Join(dir, "input2.txt")
+	if err := ioutil.WriteFile(c.In, []byte("disk,host=web01 used=4 1592654400\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.ArchiveInfoList = nil
+	if err := c.Execute(); err == nil {
+		t.Error("should get error for missing file without retentions")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "web01", "disk", "used.wsp")); !os.IsNotExist(err) {
+		t.Errorf("file should not be created without retentions, err=%v", err)
+	}
+}
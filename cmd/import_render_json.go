@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+)
+
+type ImportRenderJSONCommand struct {
+	InPattern         string
+	DestBase          string
+	AggregationMethod whispertool.AggregationMethod
+	XFilesFactor      float32
+	ArchiveInfoList   whispertool.ArchiveInfoList
+	Now               whispertool.Timestamp
+	TextOut           string
+	Format            string
+	TimeFormat        TimeFormat
+}
+
+// renderSeries is a series in the response of Graphite render API
+// with format=json.
+type renderSeries struct {
+	Target     string        `json:"target"`
+	Datapoints [][2]*float64 `json:"datapoints"`
+}
+
+// renderImportResult is the result of importing a series.
+type renderImportResult struct {
+	relPath   string
+	created   bool
+	archiveID int
+	step      whispertool.Duration
+	updated   int
+	kept      int
+	skipped   int
+}
+
+func (c *ImportRenderJSONCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.InPattern, "in", "", "glob pattern of JSON files of Graphite render API responses (format=json)")
+	fs.StringVar(&c.DestBase, "dest-base", "", "dest base directory")
+
+	fs.Var(&aggregationMethodValue{&c.AggregationMethod}, "agg-method", "aggregation method for creating missing files")
+	fs.Var(&xFilesFactorValue{&c.XFilesFactor}, "x-files-factor", "xFilesFactor for creating missing files")
+	fs.Var(&archiveInfoListValue{&c.ArchiveInfoList}, "retentions", "retentions definitions for creating missing files. empty means missing files are errors.")
+
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of importing data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.Parse(args)
+
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
+	if c.InPattern == "" {
+		return newRequiredOptionError(fs, "in")
+	}
+	if c.DestBase == "" {
+		return newRequiredOptionError(fs, "dest-base")
+	}
+	if isBaseURL(c.DestBase) {
+		return errors.New("dest-base must be local directory")
+	}
+	if c.ArchiveInfoList != nil && c.AggregationMethod == 0 {
+		return newRequiredOptionError(fs, "agg-method")
+	}
+	return nil
+}
+
+func (c *ImportRenderJSONCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *ImportRenderJSONCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
+	t0 := time.Now()
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now))
+	var totalSeriesCount, errorCount int
+	defer func() {
+		t1 := time.Now()
+		tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+			textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalSeriesCount", totalSeriesCount},
+			textOutField{"errorCount", errorCount})
+	}()
+
+	filenames, err := filepath.Glob(c.InPattern)
+	if err != nil {
+		return err
+	}
+	if len(filenames) == 0 {
+		return &os.PathError{Op: "glob", Path: c.InPattern, Err: os.ErrNotExist}
+	}
+
+	for _, filename := range filenames {
+		seriesList, err := readRenderJSONFile(filename)
+		if err != nil {
+			return err
+		}
+		for _, s := range seriesList {
+			totalSeriesCount++
+			res, err := c.importSeries(s, now)
+			if err != nil {
+				// NOTE: Continue with other series since render JSON may
+				// contain targets with functions which cannot be imported.
+				errorCount++
+				tow.writeLog(textOutField{"in", filename}, textOutField{"target", s.Target},
+					textOutField{"err", err.Error()})
+				continue
+			}
+			if err := printRenderImportResult(tow, filename, s.Target, res); err != nil {
+				return err
+			}
+		}
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("failed to import %d series", errorCount)
+	}
+	return nil
+}
+
+func readRenderJSONFile(filename string) ([]renderSeries, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var seriesList []renderSeries
+	if err := json.Unmarshal(data, &seriesList); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return seriesList, nil
+}
+
+// renderSeriesToTimeSeries converts datapoints to a TimeSeries.
+// The step is inferred as the smallest interval of datapoints, and
+// missing datapoints and null values become NaN.
+func renderSeriesToTimeSeries(s renderSeries) (*whispertool.TimeSeries, error) {
+	type point struct {
+		t whispertool.Timestamp
+		v whispertool.Value
+	}
+	points := make([]point, 0, len(s.Datapoints))
+	for _, dp := range s.Datapoints {
+		if dp[1] == nil || *dp[1] < 0 || *dp[1] > math.MaxUint32 {
+			return nil, errors.New("invalid timestamp in datapoints")
+		}
+		p := point{t: whispertool.Timestamp(*dp[1]), v: whispertool.Value(math.NaN())}
+		if dp[0] != nil {
+			p.v = whispertool.Value(*dp[0])
+		}
+		points = append(points, p)
+	}
+	if len(points) < 2 {
+		return nil, errors.New("at least two datapoints are needed to infer step")
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].t < points[j].t })
+
+	var step whispertool.Duration
+	for i := 1; i < len(points); i++ {
+		d := points[i].t.Sub(points[i-1].t)
+		if d <= 0 {
+			return nil, fmt.Errorf("duplicated timestamp in datapoints: %s", points[i].t)
+		}
+		if step == 0 || d < step {
+			step = d
+		}
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i].t.Sub(points[0].t)%step != 0 {
+			return nil, fmt.Errorf("timestamps in datapoints are not aligned to step %s", step)
+		}
+	}
+
+	from := points[0].t
+	n := int(points[len(points)-1].t.Sub(from)/step) + 1
+	values := make([]whispertool.Value, n)
+	for i := range values {
+		values[i].SetNaN()
+	}
+	for _, p := range points {
+		values[int(p.t.Sub(from)/step)] = p.v
+	}
+	return whispertool.NewTimeSeries(from, from.Add(whispertool.Duration(n)*step), step, values), nil
+}
+
+func renderTargetToRelPath(target string) (string, error) {
+	if target == "" || strings.ContainsAny(target, "(), \t*?[]{}") {
+		return "", fmt.Errorf("target is not a plain metric path: %s", target)
+	}
+	return metricToRelPath(target)
+}
+
+// importSeries merges the series into the whisper file for the target.
+// Only points whose existing value is NaN are updated, so non-NaN
+// values in the file are kept.
+func (c *ImportRenderJSONCommand) importSeries(s renderSeries, now whispertool.Timestamp) (res renderImportResult, err error) {
+	res.relPath, err = renderTargetToRelPath(s.Target)
+	if err != nil {
+		return res, err
+	}
+	ts, err := renderSeriesToTimeSeries(s)
+	if err != nil {
+		return res, err
+	}
+	res.step = ts.Step()
+
+	var h *whispertool.Header
+	fullPath := filepath.Join(c.DestBase, res.relPath)
+	db, err := whispertool.Open(fullPath)
+	if err == nil {
+		defer db.Close()
+		h = db.Header()
+	} else {
+		if !os.IsNotExist(err) || c.ArchiveInfoList == nil {
+			return res, err
+		}
+		h, err = whispertool.NewHeader(c.AggregationMethod, c.XFilesFactor, c.ArchiveInfoList)
+		if err != nil {
+			return res, err
+		}
+		res.created = true
+	}
+
+	res.archiveID = -1
+	for i := range h.ArchiveInfoList() {
+		if h.ArchiveInfoList()[i].SecondsPerPoint() == ts.Step() {
+			res.archiveID = i
+			break
+		}
+	}
+	if res.archiveID == -1 {
+		return res, fmt.Errorf("no archive with step %s in %s", ts.Step(), res.relPath)
+	}
+
+	if res.created {
+		db, err = createUpdateDestFile(fullPath, h)
+		if err != nil {
+			return res, err
+		}
+		defer db.Close()
+	}
+
+	existing := make(map[whispertool.Timestamp]whispertool.Value)
+	destTs, err := db.FetchFromArchive(res.archiveID, ts.FromTime().Add(-ts.Step()), ts.UntilTime(), now)
+	if err != nil {
+		return res, err
+	}
+	if destTs != nil {
+		for _, p := range destTs.Points() {
+			existing[p.Time] = p.Value
+		}
+	}
+
+	r := &db.ArchiveInfoList()[res.archiveID]
+	oldest := now.Add(-r.MaxRetention())
+	var points whispertool.Points
+	for _, p := range ts.Points() {
+		if p.Value.IsNaN() {
+			continue
+		}
+		if p.Time <= oldest || now < p.Time {
+			res.skipped++
+			continue
+		}
+		if v, ok := existing[p.Time.Truncate(ts.Step())]; ok && !v.IsNaN() {
+			res.kept++
+			continue
+		}
+		points = append(points, p)
+	}
+	res.updated = len(points)
+	if len(points) == 0 && !res.created {
+		return res, nil
+	}
+
+	if len(points) > 0 {
+		if err := db.UpdatePointsForArchive(points, res.archiveID, now); err != nil {
+			return res, err
+		}
+	}
+	if err := db.Sync(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func printRenderImportResult(w *textOutWriter, in, target string, res renderImportResult) error {
+	if err := w.writeContext(textOutField{"in", in}, textOutField{"target", target},
+		textOutField{"file", res.relPath}, textOutField{"created", res.created}); err != nil {
+		return err
+	}
+	return w.writeData(textOutField{"archive", res.archiveID}, textOutField{"step", res.step.String()},
+		textOutField{"updated", res.updated}, textOutField{"kept", res.kept},
+		textOutField{"skipped", res.skipped})
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestRenderSeriesToTimeSeries(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  string
+	}{
+		{
+			input: `{"target":"a.b","datapoints":[[1,1592654400],[null,1592654460],[3,1592654580]]}`,
+			want:  `{"fromTime":"2020-06-20T12:00:00Z","untilTime":"2020-06-20T12:04:00Z","step":60,"values":[1,null,null,3]}`,
+		},
+		{
+			input: `{"target":"a.b","datapoints":[[2,1592654700],[1,1592654400]]}`,
+			want:  `{"fromTime":"2020-06-20T12:00:00Z","untilTime":"2020-06-20T12:10:00Z","step":300,"values":[1,2]}`,
+		},
+	}
+	for _, tc := range testCases {
+		var s renderSeries
+		if err := json.Unmarshal([]byte(tc.input), &s); err != nil {
+			t.Fatal(err)
+		}
+		ts, err := renderSeriesToTimeSeries(s)
+		if err != nil {
+			t.Fatalf("error for input %s: %s", tc.input, err)
+		}
+		got, err := json.Marshal(ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("timeseries unmatch for input %s, got=%s, want=%s", tc.input, got, tc.want)
+		}
+	}
+
+	invalidInputs := []string{
+		`{"target":"a.b","datapoints":[[1,1592654400]]}`,
+		`{"target":"a.b","datapoints":[[1,1592654400],[1,1592654400]]}`,
+		`{"target":"a.b","datapoints":[[1,1592654400],[1,1592654460],[1,1592654500]]}`,
+	}
+	for _, input := range invalidInputs {
+		var s renderSeries
+		if err := json.Unmarshal([]byte(input), &s); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := renderSeriesToTimeSeries(s); err == nil {
+			t.Errorf("should get error for input %s", input)
+		}
+	}
+}
+
+func TestImportRenderJSONCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:05:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:1h,5m:1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ImportRenderJSONCommand{
+		InPattern:         filepath.Join(dir, "*.json"),
+		DestBase:          filepath.Join(dir, "dest"),
+		AggregationMethod: whispertool.Sum,
+		ArchiveInfoList:   archiveInfoList,
+		Now:               now,
+	}
+
+	input := `[{"target":"a.b","datapoints":[[1,1592654400],[2,1592654460],[null,1592654520]]},` +
+		`{"target":"sumSeries(a.*)","datapoints":[[1,1592654400],[2,1592654460]]}]`
+	if err := ioutil.WriteFile(filepath.Join(dir, "1.json"), []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Execute(); err == nil {
+		t.Errorf("should get error for target with function")
+	}
+
+	input = `[{"target":"a.b","datapoints":[[10,1592654460],[30,1592654520]]}]`
+	if err := ioutil.WriteFile(filepath.Join(dir, "1.json"), []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, tsList, err := readWhisperFileLocal(filepath.Join(dir, "dest", "a", "b.wsp"), 0,
+		now.Add(-6*whispertool.Minute), now.Add(-2*whispertool.Minute), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []whispertool.Value{1, 2, 30, whispertool.Value(math.NaN())}
+	got := tsList[0].Values()
+	if len(got) != len(want) {
+		t.Fatalf("value count unmatch, got=%v, want=%v", got, want)
+	}
+	for i := range got {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("values unmatch, got=%v, want=%v", got, want)
+			break
+		}
+	}
+}
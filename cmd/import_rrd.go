@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+)
+
+type ImportRRDCommand struct {
+	InPattern  string
+	DestBase   string
+	CF         string
+	TextOut    string
+	Format     string
+	TimeFormat TimeFormat
+}
+
+// rrdCFAggregationMethods is the aggregation methods of whisper for
+// consolidation functions of RRDtool which can be represented.
+var rrdCFAggregationMethods = map[string]whispertool.AggregationMethod{
+	"AVERAGE": whispertool.Average,
+	"MAX":     whispertool.Max,
+	"MIN":     whispertool.Min,
+	"LAST":    whispertool.Last,
+}
+
+// rrdImportPlan is the mapping from RRAs to archives of whisper files.
+// It is same for all data sources in a RRD file.
+type rrdImportPlan struct {
+	header     *whispertool.Header
+	archiveIDs []int    // archive ID for each RRA, -1 for RRAs not imported
+	notes      []string // reasons for RRAs not imported
+}
+
+func (c *ImportRRDCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.InPattern, "in", "", "glob pattern of RRD files. whisper files are written to <dest-base>/<RRD basename without .rrd>/<data source>.wsp")
+	fs.StringVar(&c.DestBase, "dest-base", "", "dest base directory")
+	fs.StringVar(&c.CF, "cf", "", `consolidation function of RRAs to import, "AVERAGE", "MAX", "MIN" or "LAST". empty means AVERAGE if exists or the one of the first RRA which can be imported.`)
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of importing data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.Parse(args)
+
+	if c.InPattern == "" {
+		return newRequiredOptionError(fs, "in")
+	}
+	if c.DestBase == "" {
+		return newRequiredOptionError(fs, "dest-base")
+	}
+	if isBaseURL(c.DestBase) {
+		return errors.New("dest-base must be local directory")
+	}
+	if _, ok := rrdCFAggregationMethods[c.CF]; c.CF != "" && !ok {
+		return errors.New(`cf must be one of "AVERAGE", "MAX", "MIN" or "LAST"`)
+	}
+	return nil
+}
+
+func (c *ImportRRDCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *ImportRRDCommand) execute(tow *textOutWriter) (err error) {
+	t0 := time.Now()
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"})
+	var totalFileCount, errorCount int
+	defer func() {
+		t1 := time.Now()
+		tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"},
+			textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalFileCount", totalFileCount},
+			textOutField{"errorCount", errorCount})
+	}()
+
+	filenames, err := filepath.Glob(c.InPattern)
+	if err != nil {
+		return err
+	}
+	if len(filenames) == 0 {
+		return &os.PathError{Op: "glob", Path: c.InPattern, Err: os.ErrNotExist}
+	}
+
+	for _, filename := range filenames {
+		totalFileCount++
+		if err := c.importRRDFile(tow, filename); err != nil {
+			errorCount++
+			tow.writeLog(textOutField{"in", filename}, textOutField{"err", err.Error()})
+		}
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("failed to import %d RRD files", errorCount)
+	}
+	return nil
+}
+
+func (c *ImportRRDCommand) importRRDFile(tow *textOutWriter, filename string) error {
+	rrd, err := whispertool.ReadRRDFile(filename)
+	if err != nil {
+		return err
+	}
+	plan, err := planRRDImport(rrd, c.CF)
+	if err != nil {
+		return err
+	}
+
+	destRelDir := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	for dsIndex, ds := range rrd.DataSources {
+		relPath, err := cleanRelPath(filepath.Join(destRelDir, ds.Name+".wsp"))
+		if err != nil {
+			return err
+		}
+		updatedCounts, err := writeRRDDataSource(filepath.Join(c.DestBase, relPath), rrd, dsIndex, plan)
+		if err != nil {
+			return fmt.Errorf("%s: %s", relPath, err)
+		}
+		if err := printRRDImportResult(tow, filename, ds.Name, relPath, rrd, plan, updatedCounts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planRRDImport chooses RRAs to be imported as archives of whisper files.
+// RRAs are imported only if their consolidation function is cf and
+// the archives made from them are valid in whisper.
+func planRRDImport(rrd *whispertool.RRD, cf string) (*rrdImportPlan, error) {
+	if cf == "" {
+		cf = chooseRRDCF(rrd)
+		if cf == "" {
+			return nil, errors.New("no RRA with consolidation function which can be represented in whisper")
+		}
+	}
+	aggMethod := rrdCFAggregationMethods[cf]
+
+	plan := &rrdImportPlan{
+		archiveIDs: make([]int, len(rrd.RRAs)),
+		notes:      make([]string, len(rrd.RRAs)),
+	}
+	var candidates []int
+	for i, rra := range rrd.RRAs {
+		plan.archiveIDs[i] = -1
+		if _, ok := rrdCFAggregationMethods[rra.CF]; !ok {
+			plan.notes[i] = fmt.Sprintf("consolidation function %s cannot be represented in whisper", rra.CF)
+		} else if rra.CF != cf {
+			plan.notes[i] = fmt.Sprintf("consolidation function %s is not %s", rra.CF, cf)
+		} else {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no RRA with consolidation function %s", cf)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		si, sj := rrd.RRAStep(candidates[i]), rrd.RRAStep(candidates[j])
+		if si != sj {
+			return si < sj
+		}
+		return rrd.RRAs[candidates[i]].RowCount > rrd.RRAs[candidates[j]].RowCount
+	})
+
+	// NOTE: whisper has one xFilesFactor per file, so the one of the highest
+	// precision RRA is used.
+	xFilesFactor := float32(rrd.RRAs[candidates[0]].XFilesFactor)
+	var accepted []int
+	for _, rraIndex := range candidates {
+		rra := &rrd.RRAs[rraIndex]
+		if rra.RowCount > uint64(^uint32(0)) {
+			plan.notes[rraIndex] = "too many rows for whisper"
+			continue
+		}
+		archiveInfoList := make(whispertool.ArchiveInfoList, 0, len(accepted)+1)
+		for _, i := range append(accepted, rraIndex) {
+			archiveInfoList = append(archiveInfoList,
+				whispertool.NewArchiveInfo(rrd.RRAStep(i), uint32(rrd.RRAs[i].RowCount)))
+		}
+		h, err := whispertool.NewHeader(aggMethod, xFilesFactor, archiveInfoList)
+		if err != nil {
+			plan.notes[rraIndex] = err.Error()
+			continue
+		}
+		plan.header = h
+		accepted = append(accepted, rraIndex)
+		if float32(rra.XFilesFactor) != xFilesFactor {
+			plan.notes[rraIndex] = fmt.Sprintf("xFilesFactor %g is replaced with %g", rra.XFilesFactor, xFilesFactor)
+		}
+	}
+	for archiveID, rraIndex := range accepted {
+		plan.archiveIDs[rraIndex] = archiveID
+	}
+	return plan, nil
+}
+
+// chooseRRDCF returns AVERAGE if there is a RRA with it, or the consolidation
+// function of the first RRA which can be represented in whisper.
+func chooseRRDCF(rrd *whispertool.RRD) string {
+	var first string
+	for _, rra := range rrd.RRAs {
+		if rra.CF == "AVERAGE" {
+			return rra.CF
+		}
+		if _, ok := rrdCFAggregationMethods[rra.CF]; ok && first == "" {
+			first = rra.CF
+		}
+	}
+	return first
+}
+
+// writeRRDDataSource creates a whisper file and writes values of the data
+// source in RRAs. It returns the number of written points for each RRA.
+//
+// Raw points are written directly to keep the consolidated values of RRAs
+// as they are, rather than propagating from higher precision archives.
+// Note consolidations in progress in CDP preps are not imported.
+func writeRRDDataSource(filename string, rrd *whispertool.RRD, dsIndex int, plan *rrdImportPlan) (updatedCounts []int, err error) {
+	db, err := createUpdateDestFile(filename, plan.header)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err2 := db.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	updatedCounts = make([]int, len(rrd.RRAs))
+	for rraIndex, archiveID := range plan.archiveIDs {
+		if archiveID == -1 {
+			continue
+		}
+		points, n := rawPointsFromTimeSeries(rrd.TimeSeries(rraIndex, dsIndex))
+		if n == 0 {
+			continue
+		}
+		if err := db.PutAllRawUnsortedPoints(archiveID, points); err != nil {
+			return nil, err
+		}
+		updatedCounts[rraIndex] = n
+	}
+	if err := db.Sync(); err != nil {
+		return nil, err
+	}
+	return updatedCounts, nil
+}
+
+// rawPointsFromTimeSeries returns raw points of an archive which has the
+// same number of points as ts, and the number of non-NaN points.
+// The first non-NaN point is put at the start of the archive since
+// whisper uses the time of the first raw point as the base of the ring.
+// NaN values are left as empty points.
+func rawPointsFromTimeSeries(ts *whispertool.TimeSeries) (whispertool.Points, int) {
+	values := ts.Values()
+	base := -1
+	for i, v := range values {
+		if !v.IsNaN() {
+			base = i
+			break
+		}
+	}
+	if base == -1 {
+		return nil, 0
+	}
+
+	n := len(values)
+	points := make(whispertool.Points, n)
+	var count int
+	for i, v := range values {
+		if v.IsNaN() {
+			continue
+		}
+		points[(i-base+n)%n] = whispertool.Point{
+			Time:  ts.FromTime().Add(whispertool.Duration(i) * ts.Step()),
+			Value: v,
+		}
+		count++
+	}
+	return points, count
+}
+
+func printRRDImportResult(w *textOutWriter, in, ds, relPath string, rrd *whispertool.RRD, plan *rrdImportPlan, updatedCounts []int) error {
+	if err := w.writeContext(textOutField{"in", in}, textOutField{"ds", ds}, textOutField{"file", relPath}); err != nil {
+		return err
+	}
+	for i, rra := range rrd.RRAs {
+		err := w.writeData(textOutField{"rra", i}, textOutField{"cf", rra.CF},
+			textOutField{"step", rrd.RRAStep(i).String()}, textOutField{"rows", rra.RowCount},
+			textOutField{"archive", plan.archiveIDs[i]}, textOutField{"updated", updatedCounts[i]},
+			textOutField{"note", plan.notes[i]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
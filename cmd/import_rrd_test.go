@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"math"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestPlanRRDImport(t *testing.T) {
+	rrd := &whispertool.RRD{
+		Step: whispertool.Minute,
+		RRAs: []whispertool.RRDArchive{
+			{CF: "AVERAGE", RowCount: 60, PDPCount: 1, XFilesFactor: 0.5},
+			{CF: "AVERAGE", RowCount: 12, PDPCount: 5, XFilesFactor: 0.5},
+			{CF: "AVERAGE", RowCount: 288, PDPCount: 5, XFilesFactor: 0.3},
+			{CF: "MAX", RowCount: 60, PDPCount: 1, XFilesFactor: 0.5},
+			{CF: "HWPREDICT", RowCount: 60, PDPCount: 1},
+			{CF: "AVERAGE", RowCount: 30, PDPCount: 1, XFilesFactor: 0.5},
+		},
+	}
+	plan, err := planRRDImport(rrd, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := plan.header.ArchiveInfoList().String(), "1m:1h,5m:1d"; got != want {
+		t.Errorf("archives unmatch, got=%s, want=%s", got, want)
+	}
+	if plan.header.AggregationMethod() != whispertool.Average || plan.header.XFilesFactor() != 0.5 {
+		t.Errorf("aggregation unmatch, got=%s, %g", plan.header.AggregationMethod(), plan.header.XFilesFactor())
+	}
+	wantArchiveIDs := []int{0, -1, 1, -1, -1, -1}
+	for i, want := range wantArchiveIDs {
+		if got := plan.archiveIDs[i]; got != want {
+			t.Errorf("archive ID unmatch for RRA %d, got=%d, want=%d", i, got, want)
+		}
+		// NOTE: RRA 2 is imported with a note for the replaced xFilesFactor.
+		if (plan.notes[i] == "") != (i == 0) {
+			t.Errorf("note unmatch for RRA %d, got=%q", i, plan.notes[i])
+		}
+	}
+
+	plan, err = planRRDImport(rrd, "MAX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := plan.header.AggregationMethod(), whispertool.Max; got != want {
+		t.Errorf("aggregation method unmatch, got=%s, want=%s", got, want)
+	}
+
+	if _, err := planRRDImport(rrd, "LAST"); err == nil {
+		t.Errorf("should get error for cf without RRAs")
+	}
+}
+
+func TestRawPointsFromTimeSeries(t *testing.T) {
+	nan := whispertool.Value(math.NaN())
+	ts := whispertool.NewTimeSeries(1000, 1240, 60, []whispertool.Value{nan, 2, nan, 4})
+	got, n := rawPointsFromTimeSeries(ts)
+	want := whispertool.Points{{Time: 1060, Value: 2}, {}, {Time: 1180, Value: 4}, {}}
+	if n != 2 || !got.Equal(want) {
+		t.Errorf("raw points unmatch, got=%v (%d), want=%v", got, n, want)
+	}
+
+	ts = whispertool.NewTimeSeries(1000, 1120, 60, []whispertool.Value{nan, nan})
+	if got, n := rawPointsFromTimeSeries(ts); got != nil || n != 0 {
+		t.Errorf("raw points should be nil for all NaN, got=%v", got)
+	}
+}
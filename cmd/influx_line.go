@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hnakamur/whispertool"
+)
+
+// Names of precisions of timestamps in InfluxDB line protocol.
+const (
+	influxPrecisionNanosecond  = "ns"
+	influxPrecisionMicrosecond = "us"
+	influxPrecisionMillisecond = "ms"
+	influxPrecisionSecond      = "s"
+)
+
+// defaultInfluxTemplate is the default template of Telegraf graphite serializer.
+const defaultInfluxTemplate = "host.tags.measurement.field"
+
+// influxPoint is a line of InfluxDB line protocol.
+// String fields are skipped since they cannot be written to whisper files,
+// and boolean fields are converted to 1 or 0 as Telegraf does.
+type influxPoint struct {
+	measurement string
+	tags        map[string]string
+	fields      []influxField
+	time        whispertool.Timestamp
+	hasTime     bool
+}
+
+type influxField struct {
+	key   string
+	value float64
+}
+
+// influxTemplate is a Telegraf graphite serializer style template to
+// map a series and a field to a dotted metric path. Each part of the
+// template separated with "." is "measurement", "field", "tags" or
+// a tag key. "tags" is replaced with values of tags not used elsewhere
+// in the template sorted by keys. Like Telegraf, the field "value" is
+// omitted and the field is appended if the template does not contain
+// "field".
+type influxTemplate struct {
+	parts    []string
+	usedTags map[string]bool
+	hasField bool
+}
+
+func parseInfluxTemplate(s string) (*influxTemplate, error) {
+	if s == "" {
+		return nil, errors.New("template must not be empty")
+	}
+	t := &influxTemplate{
+		parts:    strings.Split(s, "."),
+		usedTags: make(map[string]bool),
+	}
+	for _, p := range t.parts {
+		switch p {
+		case "":
+			return nil, fmt.Errorf("empty part in template: %s", s)
+		case "measurement", "tags":
+		case "field":
+			t.hasField = true
+		default:
+			t.usedTags[p] = true
+		}
+	}
+	return t, nil
+}
+
+// metric returns the dotted metric path for the field of the point.
+// Parts for missing tags are omitted.
+func (t *influxTemplate) metric(p *influxPoint, field string) string {
+	var out []string
+	if field == "value" {
+		field = ""
+	}
+	for _, part := range t.parts {
+		switch part {
+		case "measurement":
+			out = append(out, sanitizeInfluxMetricPart(p.measurement))
+		case "field":
+			if field != "" {
+				out = append(out, sanitizeInfluxMetricPart(field))
+			}
+		case "tags":
+			keys := make([]string, 0, len(p.tags))
+			for k := range p.tags {
+				if !t.usedTags[k] {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				out = append(out, sanitizeInfluxMetricPart(p.tags[k]))
+			}
+		default:
+			if v, ok := p.tags[part]; ok {
+				out = append(out, sanitizeInfluxMetricPart(v))
+			}
+		}
+	}
+	if !t.hasField && field != "" {
+		out = append(out, sanitizeInfluxMetricPart(field))
+	}
+	return strings.Join(out, ".")
+}
+
+// influxMetricPartReplacer replaces characters which are not allowed
+// in a node of a metric path. Note "." is replaced too so that a value
+// never makes extra directories.
+var influxMetricPartReplacer = strings.NewReplacer(
+	".", "_", " ", "_", "/", "_", `\`, "_", "*", "_", "?", "_",
+	"[", "_", "]", "_", "{", "_", "}", "_", "(", "_", ")", "_")
+
+func sanitizeInfluxMetricPart(s string) string {
+	return influxMetricPartReplacer.Replace(s)
+}
+
+// readInfluxRows reads InfluxDB line protocol and returns a row for each
+// field of points. Points without a timestamp are written at now.
+func readInfluxRows(r io.Reader, tmpl *influxTemplate, precision string, now whispertool.Timestamp) ([]updateRow, error) {
+	var rows []updateRow
+	s := bufio.NewScanner(r)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := parseInfluxLine(line, precision)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		if !p.hasTime {
+			p.time = now
+		}
+		for _, f := range p.fields {
+			relPath, err := metricToRelPath(tmpl.metric(p, f.key))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNo, err)
+			}
+			rows = append(rows, updateRow{
+				relPath:   relPath,
+				archiveID: whispertool.ArchiveIDBest,
+				point:     whispertool.Point{Time: p.time, Value: whispertool.Value(f.value)},
+			})
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// parseInfluxLine parses a line of InfluxDB line protocol, that is
+// "measurement[,tag=value...] field=value[,field=value...] [timestamp]".
+func parseInfluxLine(line, precision string) (*influxPoint, error) {
+	p := &influxPoint{tags: make(map[string]string)}
+	var stop byte
+	p.measurement, line, stop = scanInfluxToken(line, ", ")
+	if p.measurement == "" {
+		return nil, errors.New("measurement is empty")
+	}
+
+	for stop == ',' {
+		var key, value string
+		key, line, stop = scanInfluxToken(line, "=")
+		if key == "" || stop != '=' {
+			return nil, errors.New("invalid tag")
+		}
+		value, line, stop = scanInfluxToken(line, ", ")
+		if value == "" {
+			return nil, fmt.Errorf("empty value of tag %q", key)
+		}
+		p.tags[key] = value
+	}
+	if stop != ' ' {
+		return nil, errors.New("fields not found")
+	}
+
+	line = strings.TrimLeft(line, " ")
+	for {
+		var key string
+		key, line, stop = scanInfluxToken(line, "=")
+		if key == "" || stop != '=' {
+			return nil, errors.New("invalid field")
+		}
+		if strings.HasPrefix(line, `"`) {
+			end := closingQuoteIndex(line)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated string value of field %q", key)
+			}
+			line = line[end+1:]
+			stop = 0
+			if line != "" {
+				stop, line = line[0], line[1:]
+			}
+		} else {
+			var s string
+			s, line, stop = scanInfluxToken(line, ", ")
+			v, err := parseInfluxFieldValue(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of field %q: %s", key, s)
+			}
+			p.fields = append(p.fields, influxField{key: key, value: v})
+		}
+		if stop != ',' {
+			break
+		}
+	}
+	if stop != 0 && stop != ' ' {
+		return nil, errors.New("invalid fields")
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return p, nil
+	}
+	t, err := parseInfluxTimestamp(line, precision)
+	if err != nil {
+		return nil, err
+	}
+	p.time = t
+	p.hasTime = true
+	return p, nil
+}
+
+// scanInfluxToken returns the unescaped token before one of stops,
+// the rest after the stop and the stop. The stop is 0 at the end of s.
+func scanInfluxToken(s, stops string) (token, rest string, stop byte) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && strings.IndexByte(`,= "\`, s[i+1]) != -1 {
+			i++
+			b.WriteByte(s[i])
+			continue
+		}
+		if strings.IndexByte(stops, c) != -1 {
+			return b.String(), s[i+1:], c
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), "", 0
+}
+
+func parseInfluxFieldValue(s string) (float64, error) {
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, nil
+	}
+	if strings.HasSuffix(s, "i") {
+		v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		return float64(v), err
+	}
+	if strings.HasSuffix(s, "u") {
+		v, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+		return float64(v), err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseInfluxTimestamp(s, precision string) (whispertool.Timestamp, error) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp: %s", s)
+	}
+	switch precision {
+	case influxPrecisionNanosecond:
+		v /= 1e9
+	case influxPrecisionMicrosecond:
+		v /= 1e6
+	case influxPrecisionMillisecond:
+		v /= 1e3
+	case influxPrecisionSecond:
+	default:
+		return 0, fmt.Errorf("unsupported precision: %s", precision)
+	}
+	if v < 0 || v > int64(^uint32(0)) {
+		return 0, fmt.Errorf("timestamp out of range: %s", s)
+	}
+	return whispertool.Timestamp(v), nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestReadInfluxRows(t *testing.T) {
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		template  string
+		precision string
+		input     string
+		want      []updateRow
+	}{
+		{
+			template:  defaultInfluxTemplate,
+			precision: influxPrecisionNanosecond,
+			input: "# comment\n" +
+				"cpu,host=web.01,cpu=cpu0 usage_user=1.5,usage_idle=98i 1592654340000000000\n" +
+				"mem,host=db01 value=3,active=true,note=\"a \\\"b\\\", c\"\n",
+			want: []updateRow{
+				{relPath: "web_01/cpu0/cpu/usage_user.wsp", archiveID: -1, point: whispertool.Point{Time: now - 60, Value: 1.5}},
+				{relPath: "web_01/cpu0/cpu/usage_idle.wsp", archiveID: -1, point: whispertool.Point{Time: now - 60, Value: 98}},
+				{relPath: "db01/mem.wsp", archiveID: -1, point: whispertool.Point{Time: now, Value: 3}},
+				{relPath: "db01/mem/active.wsp", archiveID: -1, point: whispertool.Point{Time: now, Value: 1}},
+			},
+		},
+		{
+			template:  "measurement.region.host",
+			precision: influxPrecisionSecond,
+			input:     "disk\\ io,region=us\\,west,host=a\\ b,path=/ reads=7u 1592654280\n",
+			want: []updateRow{
+				{relPath: "disk_io/us,west/a_b/reads.wsp", archiveID: -1, point: whispertool.Point{Time: now - 120, Value: 7}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tmpl, err := parseInfluxTemplate(tc.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := readInfluxRows(strings.NewReader(tc.input), tmpl, tc.precision, now)
+		if err != nil {
+			t.Fatalf("error for input %q: %s", tc.input, err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("row count unmatch for input %q, got=%+v, want=%+v", tc.input, got, tc.want)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("row unmatch for input %q, i=%d, got=%+v, want=%+v", tc.input, i, got[i], tc.want[i])
+			}
+		}
+	}
+
+	tmpl, err := parseInfluxTemplate(defaultInfluxTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidInputs := []string{
+		"cpu\n",
+		"cpu,host usage=1\n",
+		"cpu usage=abc\n",
+		"cpu usage=1 abc\n",
+		"cpu usage=\"abc\n",
+		"cpu usage=1 -1\n",
+	}
+	for _, input := range invalidInputs {
+		if _, err := readInfluxRows(strings.NewReader(input), tmpl, influxPrecisionSecond, now); err == nil {
+			t.Errorf("should get error for input %q", input)
+		}
+	}
+}
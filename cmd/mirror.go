@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+)
+
+// MirrorCommand copies recent points of whisper files from src to dest
+// every interval until it is stopped with SIGINT or SIGTERM.
+// New files are copied with all points.
+type MirrorCommand struct {
+	SrcBase     string
+	SrcRelPath  string
+	DestBase    string
+	Interval    time.Duration
+	RecentSteps int
+	Now         whispertool.Timestamp
+	TextOut     string
+	Format      string
+	TimeFormat  TimeFormat
+	CopyNaN     bool
+	Workers     int
+	MetricsAddr string
+	Once        bool
+}
+
+func (c *MirrorCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.SrcBase, "src-base", "", "src base directory or URL of \"whispertool server\"")
+	fs.StringVar(&c.SrcRelPath, "src", "", "whisper file glob pattern relative to src base (ex. dir/*.wsp).")
+	fs.StringVar(&c.DestBase, "dest-base", "", "dest base directory")
+	fs.DurationVar(&c.Interval, "interval", time.Minute, "interval between starts of copying rounds.")
+	fs.IntVar(&c.RecentSteps, "recent-steps", 10, "number of recent points of each archive to copy for existing dest files.")
+	fs.Var(&timestampValue{t: &c.Now}, "now", "fixed current time for all rounds, for testing. empty means the current time at the start of each round.")
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of copying data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.BoolVar(&c.CopyNaN, "copy-nan", false, "whether or not copy when source value is NaN")
+	fs.IntVar(&c.Workers, "workers", 1, workersUsage)
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", "", "listen address to export counters at /metrics in Prometheus text format. empty means no export.")
+	fs.BoolVar(&c.Once, "once", false, "run only one round and exit.")
+	fs.Parse(args)
+
+	if c.SrcBase == "" {
+		return newRequiredOptionError(fs, "src-base")
+	}
+	if c.SrcRelPath == "" {
+		return newRequiredOptionError(fs, "src")
+	}
+	if c.DestBase == "" {
+		return newRequiredOptionError(fs, "dest-base")
+	}
+	if isBaseURL(c.DestBase) {
+		return errors.New("dest-base must be local directory")
+	}
+	if c.Interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	if c.RecentSteps <= 0 {
+		return errors.New("recent-steps must be positive")
+	}
+	return nil
+}
+
+func (c *MirrorCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *MirrorCommand) execute(tow *textOutWriter) error {
+	stats := &mirrorStats{}
+	if c.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", stats.handleMetrics)
+		s := &http.Server{
+			Addr:           c.MetricsAddr,
+			Handler:        mux,
+			ReadTimeout:    10 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			MaxHeaderBytes: 1 << 20,
+		}
+		go func() {
+			if err := s.ListenAndServe(); err != nil {
+				log.Printf("metrics server stopped: %v", err)
+			}
+		}()
+		defer s.Close()
+	}
+
+	if c.Once {
+		return c.runRound(tow, stats)
+	}
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigC)
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		if err := c.runRound(tow, stats); err != nil {
+			tow.writeLog(tow.timeField("time", time.Now()), textOutField{"msg", "round failed"}, textOutField{"err", err.Error()})
+		}
+		select {
+		case <-ticker.C:
+		case sig := <-sigC:
+			tow.writeLog(tow.timeField("time", time.Now()), textOutField{"msg", "stop"}, textOutField{"signal", sig.String()})
+			return nil
+		}
+	}
+}
+
+// runRound copies recent points of all matched files once. Errors of
+// each file are logged and counted without stopping the round.
+func (c *MirrorCommand) runRound(tow *textOutWriter, stats *mirrorStats) error {
+	t0 := time.Now()
+	now := nowOrCurrent(c.Now)
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now))
+
+	filenames, err := globFiles(c.SrcBase, c.SrcRelPath)
+	if err != nil {
+		stats.finishRound(t0, now, 0, 0, 1)
+		return WrapFileNotExistError(Source, err)
+	}
+
+	isNew := make([]bool, len(filenames))
+	var newFileCount, errorCount int
+	err = runOrderedTasks(tow, len(filenames), c.Workers, func(i int, tow *textOutWriter) error {
+		var err error
+		isNew[i], err = c.mirrorOneFile(filenames[i], now, tow)
+		if err != nil {
+			tow.writeLog(textOutField{"msg", "copy failed"}, textOutField{"srcRel", filenames[i]}, textOutField{"err", err.Error()})
+		}
+		return err
+	}, func(err error) error {
+		if err != nil {
+			errorCount++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, n := range isNew {
+		if n {
+			newFileCount++
+		}
+	}
+	stats.finishRound(t0, now, len(filenames), newFileCount, errorCount)
+
+	t1 := time.Now()
+	tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+		textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalFileCount", len(filenames)},
+		textOutField{"newFileCount", newFileCount}, textOutField{"errorCount", errorCount})
+	return nil
+}
+
+// mirrorOneFile copies the recent points of each archive with copyOneFile.
+// If the dest file does not exist, it is created with the header of src
+// and all points are copied, and true is returned.
+func (c *MirrorCommand) mirrorOneFile(relPath string, now whispertool.Timestamp, tow *textOutWriter) (bool, error) {
+	cc := &CopyCommand{
+		SrcBase:   c.SrcBase,
+		DestBase:  c.DestBase,
+		Until:     now,
+		ArchiveID: ArchiveIDAll,
+		CopyNaN:   c.CopyNaN,
+	}
+
+	destHeader, err := readWhisperHeaderLocal(filepath.Join(c.DestBase, relPath))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+		srcHeader, _, err := readWhisperFile(c.SrcBase, relPath, ArchiveIDAll, 0, now, now)
+		if err != nil {
+			return false, err
+		}
+		cc.AggregationMethod = srcHeader.AggregationMethod()
+		cc.XFilesFactor = srcHeader.XFilesFactor()
+		cc.ArchiveInfoList = srcHeader.ArchiveInfoList()
+		return true, cc.copyOneFile(relPath, relPath, now, tow)
+	}
+
+	cc.AggregationMethod = destHeader.AggregationMethod()
+	cc.XFilesFactor = destHeader.XFilesFactor()
+	cc.ArchiveInfoList = destHeader.ArchiveInfoList()
+	for i, archiveInfo := range destHeader.ArchiveInfoList() {
+		cc.ArchiveID = i
+		cc.From = now.Add(-whispertool.Duration(c.RecentSteps) * archiveInfo.SecondsPerPoint())
+		if err := cc.copyOneFile(relPath, relPath, now, tow); err != nil {
+			return false, fmt.Errorf("archive %d: %w", i, err)
+		}
+	}
+	return false, nil
+}
+
+func readWhisperHeaderLocal(filename string) (*whispertool.Header, error) {
+	db, err := whispertool.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return db.Header(), nil
+}
+
+// mirrorStats is counters of MirrorCommand exported at /metrics.
+type mirrorStats struct {
+	mu                 sync.Mutex
+	roundCount         int
+	newFileCount       int
+	errorCount         int
+	lastFileCount      int
+	lastRoundDuration  time.Duration
+	lastRoundStartTime time.Time
+	lastNow            whispertool.Timestamp
+}
+
+func (s *mirrorStats) finishRound(t0 time.Time, now whispertool.Timestamp, fileCount, newFileCount, errorCount int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roundCount++
+	s.newFileCount += newFileCount
+	s.errorCount += errorCount
+	s.lastFileCount = fileCount
+	s.lastRoundDuration = time.Since(t0)
+	s.lastRoundStartTime = t0
+	s.lastNow = now
+}
+
+// handleMetrics writes counters in Prometheus text format. The lag is
+// the time since the start of the last finished round, that is the
+// maximum age of points which may not be copied yet.
+func (s *mirrorStats) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var lag float64
+	if !s.lastRoundStartTime.IsZero() {
+		lag = time.Since(s.lastRoundStartTime).Seconds()
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range []struct {
+		name, typ, help string
+		value           interface{}
+	}{
+		{"whispertool_mirror_rounds_total", "counter", "Number of finished rounds.", s.roundCount},
+		{"whispertool_mirror_new_files_total", "counter", "Number of dest files created.", s.newFileCount},
+		{"whispertool_mirror_errors_total", "counter", "Number of files failed to copy.", s.errorCount},
+		{"whispertool_mirror_files", "gauge", "Number of files matched in the last round.", s.lastFileCount},
+		{"whispertool_mirror_last_round_duration_seconds", "gauge", "Duration of the last round.", s.lastRoundDuration.Seconds()},
+		{"whispertool_mirror_last_round_now_seconds", "gauge", "Now of the last round in Unix time.", uint32(s.lastNow)},
+		{"whispertool_mirror_lag_seconds", "gauge", "Time since the start of the last finished round.", lag},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", m.name, m.help, m.name, m.typ, m.name, m.value)
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestMirrorCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := whispertool.NewHeader(whispertool.Sum, 0, archiveInfoList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcBase := filepath.Join(dir, "src")
+	destBase := filepath.Join(dir, "dest")
+	updateSrc := func(pts whispertool.Points) {
+		filename := filepath.Join(srcBase, "m.wsp")
+		db, err := whispertool.Open(filename)
+		if os.IsNotExist(err) {
+			db, err = createUpdateDestFile(filename, h)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdatePointsForArchive(pts, 0, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := whispertool.Minute
+	updateSrc(whispertool.Points{{Time: now.Add(-5 * m), Value: 1}, {Time: now, Value: 2}})
+
+	c := &MirrorCommand{
+		SrcBase:     srcBase,
+		SrcRelPath:  "*.wsp",
+		DestBase:    destBase,
+		RecentSteps: 2,
+		Now:         now,
+		Once:        true,
+	}
+	stats := &mirrorStats{}
+	tow := &textOutWriter{Writer: ioutil.Discard}
+	if err := c.runRound(tow, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	updateSrc(whispertool.Points{{Time: now.Add(-5 * m), Value: 10}, {Time: now.Add(-m), Value: 20}})
+	if err := c.runRound(tow, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	_, tsList, err := readWhisperFile(destBase, "m.wsp", ArchiveIDAll, now.Add(-6*m), now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(tsList[0].Values())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The point at -5m is older than recent steps, so it is not copied in the second round.
+	if want := "[1,null,null,null,20,2]"; string(got) != want {
+		t.Errorf("dest values unmatch, got=%s, want=%s", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	stats.handleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"whispertool_mirror_rounds_total 2\n",
+		"whispertool_mirror_new_files_total 1\n",
+		"whispertool_mirror_errors_total 0\n",
+		"whispertool_mirror_files 1\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics should contain %q, got=%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openMetricsRule is a rule to rewrite a dotted item path to a metric
+// name and labels. The rule is written as "<regexp> <template>" where
+// the template is "name" or `name{label="value",...}`, and $1 or ${name}
+// in the name and values are replaced with submatches of the regexp.
+type openMetricsRule struct {
+	pattern *regexp.Regexp
+	name    string
+	labels  []openMetricsLabel
+}
+
+// openMetricsLabel is a label of a metric. The value is a template
+// in openMetricsRule and an expanded value in openMetricsSeries.
+type openMetricsLabel struct {
+	name  string
+	value string
+}
+
+// openMetricsSeries is the metric name and labels of a whisper file.
+type openMetricsSeries struct {
+	name   string
+	labels []openMetricsLabel
+}
+
+type openMetricsRules []openMetricsRule
+
+var openMetricsLabelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func parseOpenMetricsRule(s string) (openMetricsRule, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return openMetricsRule{}, fmt.Errorf("rule must be \"<regexp> <template>\": %s", s)
+	}
+	pattern, err := regexp.Compile(fields[0])
+	if err != nil {
+		return openMetricsRule{}, fmt.Errorf("invalid pattern in rule: %s", err)
+	}
+	r := openMetricsRule{pattern: pattern}
+	tmpl := fields[1]
+	i := labelsStartIndex(tmpl)
+	if i == -1 {
+		r.name = tmpl
+		return r, nil
+	}
+	r.name = tmpl[:i]
+	if r.name == "" {
+		return openMetricsRule{}, fmt.Errorf("metric name is empty in rule: %s", s)
+	}
+	r.labels, err = parseOpenMetricsLabelTemplates(tmpl[i:])
+	if err != nil {
+		return openMetricsRule{}, fmt.Errorf("%s in rule: %s", err, s)
+	}
+	return r, nil
+}
+
+// labelsStartIndex returns the index of "{" which starts labels in
+// the template, or -1 if not found. "{" in "${name}" is not counted.
+func labelsStartIndex(tmpl string) int {
+	for i := 0; i < len(tmpl); i++ {
+		if tmpl[i] == '{' && (i == 0 || tmpl[i-1] != '$') {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseOpenMetricsLabelTemplates parses `{label="value",...}`.
+func parseOpenMetricsLabelTemplates(s string) ([]openMetricsLabel, error) {
+	if !strings.HasSuffix(s, "}") {
+		return nil, errors.New("labels must end with }")
+	}
+	s = s[1 : len(s)-1]
+	var labels []openMetricsLabel
+	for s != "" {
+		i := strings.IndexByte(s, '=')
+		if i == -1 || i+1 >= len(s) || s[i+1] != '"' {
+			return nil, errors.New(`label must be name="value"`)
+		}
+		name := s[:i]
+		if !openMetricsLabelNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		s = s[i+1:]
+		end := closingQuoteIndex(s)
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated value of label %q", name)
+		}
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of label %q", name)
+		}
+		labels = append(labels, openMetricsLabel{name: name, value: value})
+		s = s[end+1:]
+		if s != "" {
+			if s[0] != ',' {
+				return nil, errors.New("labels must be separated with ,")
+			}
+			s = s[1:]
+		}
+	}
+	return labels, nil
+}
+
+// closingQuoteIndex returns the index of the closing double quote
+// of the quoted string at the start of s, or -1 if not found.
+func closingQuoteIndex(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// series returns the metric name and labels for the item by the first
+// matching rule. If no rule matches, the item is used as the name
+// without labels. Invalid characters in the name are replaced with "_".
+func (rr openMetricsRules) series(item string) openMetricsSeries {
+	for _, r := range rr {
+		m := r.pattern.FindStringSubmatchIndex(item)
+		if m == nil {
+			continue
+		}
+		s := openMetricsSeries{
+			name:   sanitizeOpenMetricsName(string(r.pattern.ExpandString(nil, r.name, item, m))),
+			labels: make([]openMetricsLabel, len(r.labels)),
+		}
+		for i, l := range r.labels {
+			s.labels[i] = openMetricsLabel{
+				name:  l.name,
+				value: string(r.pattern.ExpandString(nil, l.value, item, m)),
+			}
+		}
+		sort.Slice(s.labels, func(i, j int) bool { return s.labels[i].name < s.labels[j].name })
+		return s
+	}
+	return openMetricsSeries{name: sanitizeOpenMetricsName(item)}
+}
+
+func sanitizeOpenMetricsName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' ||
+			(i > 0 && c >= '0' && c <= '9')) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// String returns the series in the exposition format, that is
+// `name{label="value",...}`.
+func (s openMetricsSeries) String() string {
+	var b strings.Builder
+	b.WriteString(s.name)
+	if len(s.labels) == 0 {
+		return b.String()
+	}
+	b.WriteByte('{')
+	for i, l := range s.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.name)
+		b.WriteString(`="`)
+		b.WriteString(escapeOpenMetricsLabelValue(l.value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var openMetricsLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeOpenMetricsLabelValue(v string) string {
+	return openMetricsLabelValueReplacer.Replace(v)
+}
+
+type openMetricsRulesValue struct {
+	rr *openMetricsRules
+}
+
+func (v openMetricsRulesValue) String() string {
+	if v.rr == nil {
+		return ""
+	}
+	var ss []string
+	for _, r := range *v.rr {
+		ss = append(ss, r.pattern.String())
+	}
+	return strings.Join(ss, ",")
+}
+
+func (v openMetricsRulesValue) Set(s string) error {
+	r, err := parseOpenMetricsRule(s)
+	if err != nil {
+		return err
+	}
+	*v.rr = append(*v.rr, r)
+	return nil
+}
@@ -39,6 +39,12 @@ func (pl PointsList) Counts() []int {
 }
 
 func (pl PointsList) Diff(ql PointsList) (PointsList, PointsList) {
+	return pl.DiffWithTolerance(ql, whispertool.Tolerance{})
+}
+
+// DiffWithTolerance returns the different points between pl and ql
+// with values compared within tol.
+func (pl PointsList) DiffWithTolerance(ql PointsList, tol whispertool.Tolerance) (PointsList, PointsList) {
 	if len(pl) != len(ql) {
 		return pl, ql
 	}
@@ -46,7 +52,7 @@ func (pl PointsList) Diff(ql PointsList) (PointsList, PointsList) {
 	pl2 := make([]whispertool.Points, len(pl))
 	ql2 := make([]whispertool.Points, len(ql))
 	for i, pp := range pl {
-		pl2[i], ql2[i] = pp.Diff(ql[i])
+		pl2[i], ql2[i] = pp.DiffWithTolerance(ql[i], tol)
 	}
 	return pl2, ql2
 }
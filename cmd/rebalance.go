@@ -0,0 +1,383 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+	"golang.org/x/sync/errgroup"
+)
+
+const rebalanceNodeUsage = `carbon destination and its base directory or URL of "whispertool server" ` +
+	`in the format of server:port[:instance]=base. specify this option for each node in the order of relay config.`
+
+// RebalanceCommand moves whisper files between carbon storage nodes when
+// the nodes of carbon relays are changed. For each metric, it computes
+// nodes before and after the change with the hash ring of relays and
+// merges the file from the first old node which has it into new nodes.
+// Optionally the files on nodes which are not used any more are deleted
+// after verifying that new nodes contain all of their points.
+type RebalanceCommand struct {
+	OldNodes   []string
+	NewNodes   []string
+	Hash       string
+	Replicas   int
+	SrcRelPath string
+	Now        whispertool.Timestamp
+	TextOut    string
+	Format     string
+	TimeFormat TimeFormat
+	Workers    int
+	DryRun     bool
+	Delete     bool
+}
+
+func (c *RebalanceCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.Var(&stringsValue{&c.OldNodes}, "old-node", "node before the change. "+rebalanceNodeUsage)
+	fs.Var(&stringsValue{&c.NewNodes}, "new-node", "node after the change. "+rebalanceNodeUsage)
+	fs.StringVar(&c.Hash, "hash", carbonHashCarbonCH, carbonHashTypeUsage)
+	fs.IntVar(&c.Replicas, "replicas", 1, "replication factor of relays.")
+	fs.StringVar(&c.SrcRelPath, "src", "", "whisper file glob pattern relative to base of old nodes (ex. dir/*.wsp).")
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of moves. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.IntVar(&c.Workers, "workers", 1, workersUsage)
+	fs.BoolVar(&c.DryRun, "dry-run", false, "only show moves without copying or deleting files.")
+	fs.BoolVar(&c.Delete, "delete", false, "delete files on old nodes which are not used any more after verifying new nodes have all of their points.")
+	fs.Parse(args)
+
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
+	if len(c.OldNodes) == 0 {
+		return newRequiredOptionError(fs, "old-node")
+	}
+	if len(c.NewNodes) == 0 {
+		return newRequiredOptionError(fs, "new-node")
+	}
+	if c.SrcRelPath == "" {
+		return newRequiredOptionError(fs, "src")
+	}
+	if c.Replicas <= 0 {
+		return errors.New("replicas must be positive")
+	}
+	if _, err := c.newPlan(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *RebalanceCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *RebalanceCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
+	plan, err := c.newPlan()
+	if err != nil {
+		return err
+	}
+
+	t0 := time.Now()
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now))
+	var totalFileCount int
+	diffFound := false
+	defer func() {
+		t1 := time.Now()
+		tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+			textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalFileCount", totalFileCount},
+			textOutField{"diffFound", diffFound})
+	}()
+
+	relPaths, err := plan.globOldNodes(c.SrcRelPath)
+	if err != nil {
+		return err
+	}
+	totalFileCount = len(relPaths)
+	err = runOrderedTasks(tow, len(relPaths), c.Workers, func(i int, tow *textOutWriter) error {
+		return c.rebalanceOneFile(plan, relPaths[i], now, tow)
+	}, func(err error) error {
+		if errors.Is(err, ErrDiffFound) {
+			diffFound = true
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if diffFound {
+		return ErrDiffFound
+	}
+	return nil
+}
+
+// rebalanceNode is a carbon destination and the base directory or URL
+// of its whisper files.
+type rebalanceNode struct {
+	carbonNode
+	base string
+}
+
+func parseRebalanceNode(s string) (rebalanceNode, error) {
+	i := strings.IndexByte(s, '=')
+	if i == -1 || i == len(s)-1 {
+		return rebalanceNode{}, fmt.Errorf("invalid node %q, must be server:port[:instance]=base", s)
+	}
+	n, err := parseCarbonNode(s[:i])
+	if err != nil {
+		return rebalanceNode{}, err
+	}
+	return rebalanceNode{carbonNode: n, base: s[i+1:]}, nil
+}
+
+// rebalancePlan has nodes and rings before and after the change.
+type rebalancePlan struct {
+	oldNodes []rebalanceNode
+	newNodes []rebalanceNode
+	oldRing  carbonRing
+	newRing  carbonRing
+	replicas int
+}
+
+func (c *RebalanceCommand) newPlan() (*rebalancePlan, error) {
+	p := &rebalancePlan{replicas: c.Replicas}
+	var err error
+	if p.oldNodes, p.oldRing, err = newRebalanceRing(c.Hash, c.OldNodes); err != nil {
+		return nil, fmt.Errorf("old-node: %w", err)
+	}
+	if p.newNodes, p.newRing, err = newRebalanceRing(c.Hash, c.NewNodes); err != nil {
+		return nil, fmt.Errorf("new-node: %w", err)
+	}
+	return p, nil
+}
+
+func newRebalanceRing(hashType string, specs []string) ([]rebalanceNode, carbonRing, error) {
+	nodes := make([]rebalanceNode, len(specs))
+	carbonNodes := make([]carbonNode, len(specs))
+	for i, spec := range specs {
+		n, err := parseRebalanceNode(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		nodes[i] = n
+		carbonNodes[i] = n.carbonNode
+	}
+	ring, err := newCarbonRing(hashType, carbonNodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nodes, ring, nil
+}
+
+// bases returns bases of nodes for the metric before and after the change.
+func (p *rebalancePlan) bases(metric string) (oldBases, newBases []string) {
+	for _, i := range p.oldRing.getNodes(metric, p.replicas) {
+		oldBases = append(oldBases, p.oldNodes[i].base)
+	}
+	for _, i := range p.newRing.getNodes(metric, p.replicas) {
+		newBases = append(newBases, p.newNodes[i].base)
+	}
+	return oldBases, newBases
+}
+
+// globOldNodes returns sorted relative paths of files matched to pattern
+// in any of old nodes.
+func (p *rebalancePlan) globOldNodes(pattern string) ([]string, error) {
+	seenBases := make(map[string]bool)
+	seenPaths := make(map[string]bool)
+	var relPaths []string
+	for _, n := range p.oldNodes {
+		if seenBases[n.base] {
+			continue
+		}
+		seenBases[n.base] = true
+
+		filenames, err := globFiles(n.base, pattern)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, WrapFileNotExistError(Source, err)
+		}
+		for _, filename := range filenames {
+			if !seenPaths[filename] {
+				seenPaths[filename] = true
+				relPaths = append(relPaths, filename)
+			}
+		}
+	}
+	sort.Strings(relPaths)
+	return relPaths, nil
+}
+
+// rebalanceOneFile copies the file to new nodes of the metric and deletes
+// it from old nodes which are not used any more if c.Delete is true.
+// It returns ErrDiffFound if some files are not deleted since new nodes
+// do not have all of their points.
+func (c *RebalanceCommand) rebalanceOneFile(plan *rebalancePlan, relPath string, now whispertool.Timestamp, tow *textOutWriter) error {
+	metric := relDirToItem(strings.TrimSuffix(relPath, ".wsp"))
+	oldBases, newBases := plan.bases(metric)
+	copyDests := basesNotIn(newBases, oldBases)
+	var deleteBases []string
+	if c.Delete {
+		deleteBases = basesNotIn(oldBases, newBases)
+	}
+	if len(copyDests) == 0 && len(deleteBases) == 0 {
+		return nil
+	}
+
+	tow.writeContext(tow.timestampField("now", now), textOutField{"srcRel", relPath}, textOutField{"metric", metric})
+
+	var srcBase string
+	var srcHeader *whispertool.Header
+	for _, base := range oldBases {
+		h, _, err := readWhisperFile(base, relPath, ArchiveIDAll, 0, now, now)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		srcBase, srcHeader = base, h
+		break
+	}
+	if srcHeader == nil {
+		tow.writeLog(textOutField{"msg", "not found on old nodes"})
+		return nil
+	}
+
+	writeMove := func(action, from, to, result string) error {
+		return tow.writeData(textOutField{"action", action}, textOutField{"from", from},
+			textOutField{"to", to}, textOutField{"result", result})
+	}
+
+	for _, dest := range copyDests {
+		result := "planned"
+		switch {
+		case isBaseURL(dest):
+			result = "skipped"
+		case !c.DryRun:
+			cc := &CopyCommand{
+				SrcBase:           srcBase,
+				DestBase:          dest,
+				AggregationMethod: srcHeader.AggregationMethod(),
+				XFilesFactor:      srcHeader.XFilesFactor(),
+				ArchiveInfoList:   srcHeader.ArchiveInfoList(),
+				Until:             now,
+				ArchiveID:         ArchiveIDAll,
+			}
+			if err := cc.copyOneFile(relPath, relPath, now, &textOutWriter{Writer: ioutil.Discard}); err != nil {
+				return fmt.Errorf("copy to %s: %w", dest, err)
+			}
+			result = "copied"
+		}
+		if err := writeMove("copy", srcBase, dest, result); err != nil {
+			return err
+		}
+	}
+
+	diffFound := false
+	for _, base := range deleteBases {
+		result := "planned"
+		switch {
+		case isBaseURL(base):
+			result = "skipped"
+		case !c.DryRun:
+			ok, err := c.verifyContained(base, newBases, relPath, now)
+			if err != nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+				continue
+			}
+			if ok {
+				if err := os.Remove(filepath.Join(base, relPath)); err != nil {
+					return err
+				}
+				result = "deleted"
+			} else {
+				diffFound = true
+				result = "unverified"
+			}
+		}
+		if err := writeMove("delete", base, "", result); err != nil {
+			return err
+		}
+	}
+	if diffFound {
+		return ErrDiffFound
+	}
+	return nil
+}
+
+// verifyContained returns whether or not all non-NaN points of the file
+// in srcBase are the same in each of destBases. It returns an error
+// satisfying errors.Is(err, os.ErrNotExist) if the file does not exist in
+// srcBase, and false if it does not exist in any of destBases.
+func (c *RebalanceCommand) verifyContained(srcBase string, destBases []string, relPath string, now whispertool.Timestamp) (bool, error) {
+	if _, _, err := readWhisperFile(srcBase, relPath, ArchiveIDAll, 0, now, now); err != nil {
+		return false, err
+	}
+	for _, dest := range destBases {
+		var srcHeader, destHeader *whispertool.Header
+		var srcTsList, destTsList TimeSeriesList
+		var eg errgroup.Group
+		eg.Go(func() error {
+			var err error
+			srcHeader, srcTsList, err = readWhisperFile(srcBase, relPath, ArchiveIDAll, 0, now, now)
+			return err
+		})
+		eg.Go(func() error {
+			var err error
+			destHeader, destTsList, err = readWhisperFile(dest, relPath, ArchiveIDAll, 0, now, now)
+			return err
+		})
+		if err := eg.Wait(); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return false, nil
+			}
+			return false, err
+		}
+		if !srcHeader.ArchiveInfoList().Equal(destHeader.ArchiveInfoList()) {
+			return false, nil
+		}
+		srcTsList, destTsList, ok := srcTsList.alignTimeRanges(destTsList)
+		if !ok {
+			return false, errTimeRangeUnalike
+		}
+		srcPlDif, _ := srcTsList.DiffExcludeSrcNaN(destTsList)
+		if !srcPlDif.AllEmpty() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// basesNotIn returns bases in ss which are not in ts.
+func basesNotIn(ss, ts []string) []string {
+	var bases []string
+	for _, s := range ss {
+		found := false
+		for _, t := range ts {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			bases = append(bases, s)
+		}
+	}
+	return bases
+}
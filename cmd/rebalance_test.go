@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestRebalanceCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := whispertool.NewHeader(whispertool.Sum, 0, archiveInfoList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := whispertool.Minute
+	writeFile := func(filename string, pts whispertool.Points) {
+		db, err := createUpdateDestFile(filename, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdatePointsForArchive(pts, 0, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	baseA := filepath.Join(dir, "a")
+	baseB := filepath.Join(dir, "b")
+	// With nodes a and b, foo.m0 stays at a and foo.m1 moves to b.
+	writeFile(filepath.Join(baseA, "foo", "m0.wsp"), whispertool.Points{{Time: now.Add(-m), Value: 1}})
+	writeFile(filepath.Join(baseA, "foo", "m1.wsp"), whispertool.Points{{Time: now.Add(-m), Value: 2}})
+	writeFile(filepath.Join(baseB, "foo", "m1.wsp"), whispertool.Points{{Time: now.Add(-2 * m), Value: 3}})
+
+	c := &RebalanceCommand{
+		OldNodes:   []string{"127.0.0.1:2004:a=" + baseA},
+		NewNodes:   []string{"127.0.0.1:2004:a=" + baseA, "127.0.0.1:2104:b=" + baseB},
+		Hash:       carbonHashCarbonCH,
+		Replicas:   1,
+		SrcRelPath: "foo/*.wsp",
+		Now:        now,
+		Delete:     true,
+	}
+	var b bytes.Buffer
+	tow := &textOutWriter{Writer: &b, format: textOutFormatCSV}
+	if err := c.execute(tow); err != nil {
+		t.Fatal(err)
+	}
+	if err := tow.flush(); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "now,srcRel,metric,action,from,to,result\n" +
+		"2020-06-20T12:00:00Z,foo/m1.wsp,foo.m1,copy," + baseA + "," + baseB + ",copied\n" +
+		"2020-06-20T12:00:00Z,foo/m1.wsp,foo.m1,delete," + baseA + ",,deleted\n"
+	if got := b.String(); got != wantCSV {
+		t.Errorf("output unmatch, got=%s, want=%s", got, wantCSV)
+	}
+
+	if _, err := os.Stat(filepath.Join(baseA, "foo", "m0.wsp")); err != nil {
+		t.Errorf("foo.m0 should stay at node a, err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(baseA, "foo", "m1.wsp")); !os.IsNotExist(err) {
+		t.Errorf("foo.m1 should be deleted from node a, err=%v", err)
+	}
+	_, tsList, err := readWhisperFile(baseB, "foo/m1.wsp", ArchiveIDAll, now.Add(-3*m), now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(tsList[0].Values())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[3,2,null]"; string(got) != want {
+		t.Errorf("merged values unmatch, got=%s, want=%s", got, want)
+	}
+}
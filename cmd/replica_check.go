@@ -0,0 +1,357 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+	"golang.org/x/sync/errgroup"
+)
+
+// ReplicaRepairPolicy is how disagreeing points of replicas are repaired.
+// The zero value is the same as ReplicaRepairNone.
+type ReplicaRepairPolicy string
+
+const (
+	// ReplicaRepairNone only reports disagreeing points.
+	ReplicaRepairNone ReplicaRepairPolicy = "none"
+	// ReplicaRepairMajority repairs minority replicas with the value of
+	// more than half of replicas.
+	ReplicaRepairMajority ReplicaRepairPolicy = "majority"
+	// ReplicaRepairNonNaN repairs replicas with the value of more than half
+	// of replicas whose values are not NaN, so that NaN values are filled.
+	ReplicaRepairNonNaN ReplicaRepairPolicy = "non-nan"
+)
+
+const replicaRepairPolicyUsage = `how disagreeing points are repaired. "none" only reports them, ` +
+	`"majority" writes the value of more than half of replicas to the others and ` +
+	`"non-nan" does the same ignoring NaN values. a voted NaN value is not written ` +
+	`over non-NaN values unless -repair-with-nan is specified`
+
+var errInvalidReplicaRepairPolicy = errors.New(`repair must be one of "none", "majority" or "non-nan"`)
+
+// ParseReplicaRepairPolicy parses s as ReplicaRepairPolicy.
+func ParseReplicaRepairPolicy(s string) (ReplicaRepairPolicy, error) {
+	switch p := ReplicaRepairPolicy(s); p {
+	case ReplicaRepairNone, ReplicaRepairMajority, ReplicaRepairNonNaN:
+		return p, nil
+	default:
+		return "", errInvalidReplicaRepairPolicy
+	}
+}
+
+func (p ReplicaRepairPolicy) String() string {
+	if p == "" {
+		return string(ReplicaRepairNone)
+	}
+	return string(p)
+}
+
+type replicaRepairPolicyValue struct {
+	p *ReplicaRepairPolicy
+}
+
+func (v replicaRepairPolicyValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return v.p.String()
+}
+
+func (v replicaRepairPolicyValue) Set(s string) error {
+	p, err := ParseReplicaRepairPolicy(s)
+	if err != nil {
+		return err
+	}
+	*v.p = p
+	return nil
+}
+
+// ReplicaCheckCommand compares the same whisper files in replicas and
+// reports points where replicas disagree. It optionally repairs
+// minority replicas with the voted value.
+type ReplicaCheckCommand struct {
+	SrcBases   []string
+	SrcRelPath string
+	From       whispertool.Timestamp
+	Until      whispertool.Timestamp
+	Now        whispertool.Timestamp
+	ArchiveID  int
+	TextOut    string
+	Format     string
+	TimeFormat TimeFormat
+	Workers    int
+	Tolerance  whispertool.Tolerance
+	Repair     ReplicaRepairPolicy
+
+	// RepairWithNaN is whether or not a voted NaN value is written over
+	// non-NaN values of minority replicas.
+	RepairWithNaN bool
+}
+
+func (c *ReplicaCheckCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.Var(&stringsValue{&c.SrcBases}, "src-base", "base directory or URL of \"whispertool server\" of a replica. specify this option for each replica.")
+	fs.StringVar(&c.SrcRelPath, "src", "", "whisper file relative path to src bases")
+	fs.IntVar(&c.ArchiveID, "archive", ArchiveIDAll, "archive ID (-1 is all).")
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of disagreeing points. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.IntVar(&c.Workers, "workers", 1, workersUsage)
+	setToleranceFlags(fs, &c.Tolerance)
+	fs.Var(&replicaRepairPolicyValue{&c.Repair}, "repair", replicaRepairPolicyUsage)
+	fs.BoolVar(&c.RepairWithNaN, "repair-with-nan", false,
+		"whether or not write the voted NaN value over non-NaN values of minority replicas with -repair majority. this loses data of them.")
+
+	fs.Var(&timestampValue{t: &c.From}, "from", "range start time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Until}, "until", "range end time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
+	fs.Parse(args)
+
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
+	if len(c.SrcBases) == 0 {
+		return newRequiredOptionError(fs, "src-base")
+	}
+	if len(c.SrcBases) < 2 {
+		return errors.New("src-base must be specified for two or more replicas")
+	}
+	if c.SrcRelPath == "" {
+		return newRequiredOptionError(fs, "src")
+	}
+	if c.Repair.String() != string(ReplicaRepairNone) {
+		for _, base := range c.SrcBases {
+			if isBaseURL(base) {
+				return errors.New("src-base must be local directory to repair replicas")
+			}
+		}
+	}
+	if c.Until != 0 && c.From > c.Until {
+		return errFromIsAfterUntil
+	}
+	if err := validateTolerance(c.Tolerance); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *ReplicaCheckCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *ReplicaCheckCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
+	if !hasMeta(c.SrcRelPath) {
+		return c.checkOneFile(c.SrcRelPath, now, tow)
+	}
+
+	t0 := time.Now()
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now))
+	var totalFileCount int
+	diffFound := false
+	defer func() {
+		t1 := time.Now()
+		tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+			textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalFileCount", totalFileCount},
+			textOutField{"diffFound", diffFound})
+	}()
+
+	filenames, err := globFiles(c.SrcBases[0], c.SrcRelPath)
+	if err != nil {
+		return WrapFileNotExistError(Source, err)
+	}
+	totalFileCount = len(filenames)
+	err = runOrderedTasks(tow, len(filenames), c.Workers, func(i int, tow *textOutWriter) error {
+		return c.checkOneFile(filenames[i], now, tow)
+	}, func(err error) error {
+		if errors.Is(err, ErrDiffFound) {
+			diffFound = true
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if diffFound {
+		return ErrDiffFound
+	}
+	return nil
+}
+
+// checkOneFile returns ErrDiffFound if replicas of the file disagree.
+func (c *ReplicaCheckCommand) checkOneFile(relPath string, now whispertool.Timestamp, tow *textOutWriter) error {
+	var until whispertool.Timestamp
+	if c.Until == 0 {
+		until = now
+	} else {
+		until = c.Until
+	}
+
+	tow.writeContext(tow.timestampField("now", now), textOutField{"srcRel", relPath})
+
+	headers := make([]*whispertool.Header, len(c.SrcBases))
+	tsLists := make([]TimeSeriesList, len(c.SrcBases))
+	var eg errgroup.Group
+	for i, base := range c.SrcBases {
+		i, base := i, base
+		eg.Go(func() error {
+			var err error
+			headers[i], tsLists[i], err = readWhisperFile(base, relPath, c.ArchiveID, c.From, until, now)
+			if err != nil {
+				return fmt.Errorf("replica %d: %w", i, err)
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			tow.writeLog(textOutField{"err", err.Error()})
+			return ErrDiffFound
+		}
+		return err
+	}
+	for i, h := range headers[1:] {
+		if !headers[0].ArchiveInfoList().Equal(h.ArchiveInfoList()) {
+			return fmt.Errorf("retentions unmatch between replica 0 and %d", i+1)
+		}
+	}
+
+	tsLists, ok := alignTimeSeriesLists(tsLists)
+	if !ok {
+		return errTimeRangeUnalike
+	}
+	allEqual := true
+	for _, tl := range tsLists[1:] {
+		pl, ql := tsLists[0].DiffWithTolerance(tl, c.Tolerance)
+		if !pl.AllEmpty() || !ql.AllEmpty() {
+			allEqual = false
+			break
+		}
+	}
+	if allEqual {
+		return nil
+	}
+
+	repairs := make([]PointsList, len(c.SrcBases))
+	for i := range repairs {
+		repairs[i] = make(PointsList, len(headers[0].ArchiveInfoList()))
+	}
+	if err := c.printDisagreements(tow, tsLists, repairs); err != nil {
+		return err
+	}
+
+	if c.Repair.String() != string(ReplicaRepairNone) {
+		for i, base := range c.SrcBases {
+			if repairs[i].AllEmpty() {
+				continue
+			}
+			if err := repairReplica(filepath.Join(base, relPath), repairs[i], now); err != nil {
+				return fmt.Errorf("replica %d: %w", i, err)
+			}
+			tow.writeLog(textOutField{"msg", "repaired"}, textOutField{"replica", i},
+				textOutField{"srcBase", base}, textOutField{"pointCount", repairs[i].Counts()})
+		}
+	}
+	return ErrDiffFound
+}
+
+// printDisagreements writes points where replicas disagree with the voted
+// value and appends the points to repair to repairs for each replica.
+// A voted NaN value is not repaired unless c.RepairWithNaN is true.
+func (c *ReplicaCheckCommand) printDisagreements(w *textOutWriter, tsLists []TimeSeriesList, repairs []PointsList) error {
+	values := make([]whispertool.Value, len(tsLists))
+	for archiveID, ts := range tsLists[0] {
+		if ts == nil {
+			continue
+		}
+		for j, p := range ts.Points() {
+			agree := true
+			for k, tl := range tsLists {
+				values[k] = tl[archiveID].Values()[j]
+				if !values[k].EqualWithTolerance(values[0], c.Tolerance) {
+					agree = false
+				}
+			}
+			if agree {
+				continue
+			}
+
+			voted, ok := voteReplicaValue(values, c.Repair, c.Tolerance)
+			fields := []textOutField{{"archive", archiveID}, w.timestampField("t", p.Time)}
+			for k, v := range values {
+				fields = append(fields, textOutField{fmt.Sprintf("val%d", k), v})
+			}
+			fields = append(fields, textOutField{"votedVal", voted}, textOutField{"voted", ok})
+			if err := w.writeData(fields...); err != nil {
+				return err
+			}
+			if !ok || (voted.IsNaN() && !c.RepairWithNaN) {
+				continue
+			}
+			for k, v := range values {
+				if !v.EqualWithTolerance(voted, c.Tolerance) {
+					repairs[k][archiveID] = append(repairs[k][archiveID], whispertool.Point{Time: p.Time, Value: voted})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// voteReplicaValue returns the value of more than half of values, or of
+// more than half of non-NaN values for ReplicaRepairNonNaN. Values within
+// tol are regarded as the same and the first one of them is returned.
+// It returns false if there is no such value.
+func voteReplicaValue(values []whispertool.Value, policy ReplicaRepairPolicy, tol whispertool.Tolerance) (whispertool.Value, bool) {
+	tol.IgnoreOneSideNaN = false
+	var candidates []whispertool.Value
+	var counts []int
+	total := 0
+	for _, v := range values {
+		if policy == ReplicaRepairNonNaN && v.IsNaN() {
+			continue
+		}
+		total++
+		found := false
+		for i, c := range candidates {
+			if v.EqualWithTolerance(c, tol) {
+				counts[i]++
+				found = true
+				break
+			}
+		}
+		if !found {
+			candidates = append(candidates, v)
+			counts = append(counts, 1)
+		}
+	}
+	for i, c := range candidates {
+		if counts[i]*2 > total {
+			return c, true
+		}
+	}
+	var nan whispertool.Value
+	nan.SetNaN()
+	return nan, false
+}
+
+func repairReplica(filename string, pointsList PointsList, now whispertool.Timestamp) error {
+	db, err := whispertool.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := updateFileDataWithPointsList(db, pointsList, now); err != nil {
+		return err
+	}
+	return db.Sync()
+}
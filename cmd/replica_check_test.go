@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestVoteReplicaValue(t *testing.T) {
+	nan := whispertool.Value(math.NaN())
+	testCases := []struct {
+		values []whispertool.Value
+		policy ReplicaRepairPolicy
+		want   string
+		wantOK bool
+	}{
+		{values: []whispertool.Value{1, 1, 2}, policy: ReplicaRepairMajority, want: "1", wantOK: true},
+		{values: []whispertool.Value{1, 2, 3}, policy: ReplicaRepairMajority, want: "NaN", wantOK: false},
+		{values: []whispertool.Value{1, nan}, policy: ReplicaRepairMajority, want: "NaN", wantOK: false},
+		{values: []whispertool.Value{1, nan}, policy: ReplicaRepairNonNaN, want: "1", wantOK: true},
+		{values: []whispertool.Value{nan, nan, 1}, policy: ReplicaRepairMajority, want: "NaN", wantOK: true},
+		{values: []whispertool.Value{nan, nan, 1}, policy: ReplicaRepairNonNaN, want: "1", wantOK: true},
+		{values: []whispertool.Value{1, 2, nan}, policy: ReplicaRepairNonNaN, want: "NaN", wantOK: false},
+	}
+	for _, tc := range testCases {
+		got, gotOK := voteReplicaValue(tc.values, tc.policy, whispertool.Tolerance{})
+		if got.String() != tc.want || gotOK != tc.wantOK {
+			t.Errorf("result unmatch for values=%v, policy=%s, got=%s,%v, want=%s,%v",
+				tc.values, tc.policy, got, gotOK, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestReplicaCheckCommand_printDisagreements(t *testing.T) {
+	nan := whispertool.Value(math.NaN())
+	from := whispertool.Timestamp(1592654400)
+	until := from.Add(2 * whispertool.Minute)
+	var tsLists []TimeSeriesList
+	for _, values := range [][]whispertool.Value{{nan, 2}, {nan, 2}, {1, 3}} {
+		tsLists = append(tsLists, TimeSeriesList{whispertool.NewTimeSeries(from, until, whispertool.Minute, values)})
+	}
+
+	testCases := []struct {
+		repairWithNaN bool
+		want          string
+	}{
+		{repairWithNaN: false, want: "[Points{},Points{},Points{{2020-06-20T12:01:00Z 2}}]"},
+		{repairWithNaN: true, want: "[Points{},Points{},Points{{2020-06-20T12:00:00Z NaN} {2020-06-20T12:01:00Z 2}}]"},
+	}
+	for _, tc := range testCases {
+		c := &ReplicaCheckCommand{Repair: ReplicaRepairMajority, RepairWithNaN: tc.repairWithNaN}
+		repairs := make([]PointsList, len(tsLists))
+		for i := range repairs {
+			repairs[i] = make(PointsList, 1)
+		}
+		if err := c.printDisagreements(&textOutWriter{Writer: ioutil.Discard}, tsLists, repairs); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pl := range repairs {
+			got = append(got, pl[0].String())
+		}
+		if got := "[" + strings.Join(got, ",") + "]"; got != tc.want {
+			t.Errorf("repairs unmatch for repairWithNaN=%v, got=%s, want=%s", tc.repairWithNaN, got, tc.want)
+		}
+	}
+}
+
+func TestReplicaCheckCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := whispertool.NewHeader(whispertool.Sum, 0, archiveInfoList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nan := whispertool.Value(math.NaN())
+	from := now.Add(-3 * whispertool.Minute)
+	replicaValues := [][]whispertool.Value{
+		{1, 2, 3},
+		{1, 5, nan},
+		{1, 2, nan},
+	}
+	var srcBases []string
+	for i, values := range replicaValues {
+		base := filepath.Join(dir, string(rune('a'+i)))
+		srcBases = append(srcBases, base)
+		db, err := createUpdateDestFile(filepath.Join(base, "m.wsp"), h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pts whispertool.Points
+		for j, v := range values {
+			if !v.IsNaN() {
+				pts = append(pts, whispertool.Point{Time: from.Add(whispertool.Duration(j+1) * whispertool.Minute), Value: v})
+			}
+		}
+		if err := db.UpdatePointsForArchive(pts, 0, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &ReplicaCheckCommand{
+		SrcBases:   srcBases,
+		SrcRelPath: "m.wsp",
+		From:       from,
+		Until:      now,
+		Now:        now,
+		ArchiveID:  ArchiveIDAll,
+		Repair:     ReplicaRepairNonNaN,
+	}
+	var b bytes.Buffer
+	tow := &textOutWriter{Writer: &b, format: textOutFormatCSV}
+	if err := c.execute(tow); !errors.Is(err, ErrDiffFound) {
+		t.Fatalf("error unmatch, got=%v, want=%v", err, ErrDiffFound)
+	}
+	if err := tow.flush(); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "now,srcRel,archive,t,val0,val1,val2,votedVal,voted\n" +
+		"2020-06-20T12:00:00Z,m.wsp,0,2020-06-20T11:59:00Z,2,5,2,2,true\n" +
+		"2020-06-20T12:00:00Z,m.wsp,0,2020-06-20T12:00:00Z,3,NaN,NaN,3,true\n"
+	if got := b.String(); got != wantCSV {
+		t.Errorf("output unmatch, got=%s, want=%s", got, wantCSV)
+	}
+
+	for i, base := range srcBases {
+		_, tsList, err := readWhisperFile(base, "m.wsp", ArchiveIDAll, from, now, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(tsList[0].Values())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "[1,2,3]"; string(got) != want {
+			t.Errorf("repaired values unmatch for replica %d, got=%s, want=%s", i, got, want)
+		}
+	}
+
+	b.Reset()
+	if err := c.execute(&textOutWriter{Writer: &b, format: textOutFormatCSV}); err != nil {
+		t.Errorf("should get no diff after repair, got=%v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/hnakamur/whispertool"
+)
+
+type RestoreCommand struct {
+	In          string
+	DestBase    string
+	DestRelPath string
+}
+
+func (c *RestoreCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.In, "in", "-", "dump input file written by dump subcommand. - means stdin.")
+	fs.StringVar(&c.DestBase, "dest-base", "", "dest base directory")
+	fs.StringVar(&c.DestRelPath, "dest", "", "whisper file relative path to dest base. the file must not exist.")
+	fs.Parse(args)
+
+	if c.DestBase == "" {
+		return newRequiredOptionError(fs, "dest-base")
+	}
+	if c.DestRelPath == "" {
+		return newRequiredOptionError(fs, "dest")
+	}
+	return nil
+}
+
+func (c *RestoreCommand) Execute() error {
+	var r io.Reader
+	if c.In == "-" {
+		r = os.Stdin
+	} else {
+		file, err := os.Open(c.In)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	d, err := readDump(r)
+	if err != nil {
+		return fmt.Errorf("%s: %s", c.In, err)
+	}
+
+	destFullPath := filepath.Join(c.DestBase, c.DestRelPath)
+	dir := filepath.Dir(destFullPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("mkdirAll: dir=%s: err=%s", dir, err)
+	}
+	return restoreWhisperFile(destFullPath, d)
+}
+
+// restoreWhisperFile creates a whisper file and writes all raw points in d.
+func restoreWhisperFile(filename string, d *dumpData) (err error) {
+	db, err := whispertool.Create(filename, d.archiveInfoList, d.aggregationMethod, d.xFilesFactor)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err2 := db.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for i := range db.ArchiveInfoList() {
+		r := &db.ArchiveInfoList()[i]
+		if r.Offset() != d.offsets[i] {
+			return fmt.Errorf("offset unmatch for archive %d, got=%d, want=%d. "+
+				"cannot restore the same file", i, r.Offset(), d.offsets[i])
+		}
+		if err := db.PutAllRawUnsortedPoints(i, d.ptsList[i]); err != nil {
+			return err
+		}
+	}
+	return db.Sync()
+}
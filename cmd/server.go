@@ -18,12 +18,14 @@ const RespHeaderNameXOp = "X-Op"
 const RespHeaderNameXPath = "X-Path"
 
 type ServerCommand struct {
-	Addr    string
-	BaseDir string
+	Addr                 string
+	BaseDir              string
+	AggregateReadWorkers int
 }
 
 type app struct {
-	baseDir string
+	baseDir              string
+	aggregateReadWorkers int
 }
 
 type httpError struct {
@@ -35,6 +37,8 @@ type httpError struct {
 func (c *ServerCommand) Parse(fs *flag.FlagSet, args []string) error {
 	fs.StringVar(&c.Addr, "addr", ":8080", "listen address")
 	fs.StringVar(&c.BaseDir, "base", ".", "base directory")
+	fs.IntVar(&c.AggregateReadWorkers, "aggregate-read-workers", defaultAggregateReadWorkers,
+		"maximum number of whisper files of an item read concurrently for sum and aggregate query.")
 	fs.Parse(args)
 
 	return nil
@@ -42,11 +46,13 @@ func (c *ServerCommand) Parse(fs *flag.FlagSet, args []string) error {
 
 func (c *ServerCommand) Execute() error {
 	a := &app{
-		baseDir: c.BaseDir,
+		baseDir:              c.BaseDir,
+		aggregateReadWorkers: c.AggregateReadWorkers,
 	}
 	http.HandleFunc("/view", wrapHandler(a.handleView))
 	http.HandleFunc("/view-raw", wrapHandler(a.handleViewRaw))
-	http.HandleFunc("/sum", wrapHandler(a.handleSum))
+	http.HandleFunc("/sum", wrapHandler(a.handleAggregate))
+	http.HandleFunc("/aggregate", wrapHandler(a.handleAggregate))
 	http.HandleFunc("/items", wrapHandler(a.handleItems))
 	http.HandleFunc("/files", wrapHandler(a.handleFiles))
 	s := &http.Server{
@@ -117,17 +123,9 @@ func (a *app) handleView(w http.ResponseWriter, r *http.Request) error {
 	if fileParam == "" {
 		return newHTTPError(http.StatusBadRequest, errors.New("\"file\" parameter must not be empty"))
 	}
-	from, err := whispertool.ParseTimestamp(r.Form.Get("from"))
+	from, until, now, err := getFormTimeRange(r)
 	if err != nil {
-		return newHTTPError(http.StatusBadRequest, errors.New("cannot parse \"from\" parameter"))
-	}
-	until, err := whispertool.ParseTimestamp(r.Form.Get("until"))
-	if err != nil {
-		return newHTTPError(http.StatusBadRequest, errors.New("cannot parse \"until\" parameter"))
-	}
-	now, err := whispertool.ParseTimestamp(r.Form.Get("now"))
-	if err != nil {
-		return newHTTPError(http.StatusBadRequest, errors.New("cannot parse \"now\" parameter"))
+		return err
 	}
 
 	filename := filepath.Join(a.baseDir, fileParam)
@@ -163,7 +161,10 @@ func setRespForNotExistErr(w http.ResponseWriter, err error) error {
 	return nil
 }
 
-func (a *app) handleSum(w http.ResponseWriter, r *http.Request) error {
+// handleAggregate handles /aggregate and /sum. The "func" parameter
+// defaults to "sum". If the "counts" parameter is "1", the number of
+// contributors is appended to the response after aggregated time series.
+func (a *app) handleAggregate(w http.ResponseWriter, r *http.Request) error {
 	if err := r.ParseForm(); err != nil {
 		return newHTTPError(http.StatusBadRequest, errors.New("cannot parse form"))
 	}
@@ -179,32 +180,39 @@ func (a *app) handleSum(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	from, err := whispertool.ParseTimestamp(r.Form.Get("from"))
+	opts, err := parseAggregateOptionsQuery(r.Form)
 	if err != nil {
-		return newHTTPError(http.StatusBadRequest, errors.New("cannot parse \"from\" parameter"))
-	}
-	until, err := whispertool.ParseTimestamp(r.Form.Get("until"))
-	if err != nil {
-		return newHTTPError(http.StatusBadRequest, errors.New("cannot parse \"until\" parameter"))
+		return newHTTPError(http.StatusBadRequest, err)
 	}
-	now, err := whispertool.ParseTimestamp(r.Form.Get("now"))
+	opts.ReadWorkers = a.aggregateReadWorkers
+	withCounts := r.Form.Get("counts") == "1"
+	from, until, now, err := getFormTimeRange(r)
 	if err != nil {
-		return newHTTPError(http.StatusBadRequest, errors.New("cannot parse \"now\" parameter"))
+		return err
 	}
 
-	h, tsList, err := sumWhisperFileLocal(a.baseDir, item, pattern, retID, from, until, now)
+	res, err := aggregateWhisperFileLocal(a.baseDir, item, pattern, opts, retID, from, until, now)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return setRespForNotExistErr(w, err)
 		}
 		return err
 	}
+	for _, fe := range res.fileErrors {
+		log.Printf("skipped file in aggregation: %v", fe.err)
+	}
+	h, tsList, countTsList := res.header, res.tsList, res.countTsList
 
 	var buf []byte
 	buf = h.AppendTo(buf)
 	for i := range h.ArchiveInfoList() {
 		buf = tsList[i].AppendTo(buf)
 	}
+	if withCounts {
+		for i := range h.ArchiveInfoList() {
+			buf = countTsList[i].AppendTo(buf)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/octet-stream")
 	_, err = w.Write(buf)
@@ -268,6 +276,26 @@ func (a *app) handleFiles(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// getFormTimeRange parses "from", "until" and "now" parameters.
+// "now" is relative to the current time and "from" and "until" are
+// relative to "now" if they are relative time expressions.
+func getFormTimeRange(r *http.Request) (from, until, now whispertool.Timestamp, err error) {
+	now, err = whispertool.ParseTimestampRelativeTo(r.Form.Get("now"),
+		whispertool.TimestampFromStdTime(time.Now()))
+	if err != nil {
+		return 0, 0, 0, newHTTPError(http.StatusBadRequest, errors.New("cannot parse \"now\" parameter"))
+	}
+	from, err = whispertool.ParseTimestampRelativeTo(r.Form.Get("from"), now)
+	if err != nil {
+		return 0, 0, 0, newHTTPError(http.StatusBadRequest, errors.New("cannot parse \"from\" parameter"))
+	}
+	until, err = whispertool.ParseTimestampRelativeTo(r.Form.Get("until"), now)
+	if err != nil {
+		return 0, 0, 0, newHTTPError(http.StatusBadRequest, errors.New("cannot parse \"until\" parameter"))
+	}
+	return from, until, now, nil
+}
+
 func getFormInt(r *http.Request, paramName string) (int, error) {
 	strValue := r.Form.Get(paramName)
 	if strValue == "" {
@@ -2,16 +2,319 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+)
+
+// Names of formats for the -format option.
+const (
+	textOutFormatLTSV   = "ltsv"
+	textOutFormatJSON   = "json"
+	textOutFormatNDJSON = "ndjson"
+	textOutFormatCSV    = "csv"
+)
+
+const textOutFormatUsage = `format of text output. "ltsv", "json" (an array of records), ` +
+	`"ndjson" (a record per line) or "csv" (data rows with a header row, and log records in LTSV to stderr). default is "ltsv"`
+
+// textOutField is a labeled value in a record of text output.
+type textOutField struct {
+	label string
+	value interface{}
+}
+
+// textOutWriter is the writer for -text-out which also holds
+// the format of records and time in the output.
+//
+// There are three kinds of records. Log records are messages like
+// start and finish of a command. Context records tell which file or item
+// the following data records belong to. Data records are points or diffs.
+// In CSV format, headers are omitted, log records are written to logWriter
+// in LTSV so that errors are not lost, and the fields of the last context
+// record are prepended to each data record.
+type textOutWriter struct {
+	io.Writer
+	timeFormat TimeFormat
+	format     string
+
+	// logWriter is the destination of log records in CSV format.
+	// nil means log records are discarded.
+	logWriter io.Writer
+
+	context    []textOutField
+	csvWriter  *csv.Writer
+	csvColumns int
+	jsonCount  int
+
+	// buffered is true for a writer made by newBuffered. It keeps
+	// records in records instead of writing them.
+	buffered bool
+	records  []textOutRecord
+}
+
+type textOutRecordKind int
+
+const (
+	textOutRecordLog textOutRecordKind = iota
+	textOutRecordContext
+	textOutRecordHeader
+	textOutRecordData
 )
 
+// textOutRecord is a record kept in a buffered textOutWriter.
+type textOutRecord struct {
+	kind   textOutRecordKind
+	fields []textOutField
+	header *whispertool.Header
+}
+
+// newBuffered returns a textOutWriter with the same formats as w which
+// keeps records until they are written to w with replayTo. It is used to
+// write outputs of files or items processed concurrently without
+// interleaving them.
+func (w *textOutWriter) newBuffered() *textOutWriter {
+	return &textOutWriter{timeFormat: w.timeFormat, format: w.format, buffered: true}
+}
+
+// replayTo writes records kept in the buffered writer w to dst.
+func (w *textOutWriter) replayTo(dst *textOutWriter) error {
+	for _, r := range w.records {
+		var err error
+		switch r.kind {
+		case textOutRecordLog:
+			err = dst.writeLog(r.fields...)
+		case textOutRecordContext:
+			err = dst.writeContext(r.fields...)
+		case textOutRecordHeader:
+			err = dst.writeHeader(r.header)
+		case textOutRecordData:
+			err = dst.writeData(r.fields...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	w.records = nil
+	return nil
+}
+
+// timestampField returns a field of t formatted in w.timeFormat.
+// In JSON formats, Unix seconds are written as a number.
+func (w *textOutWriter) timestampField(label string, t whispertool.Timestamp) textOutField {
+	return w.timeField(label, t.ToStdTime())
+}
+
+func (w *textOutWriter) timeField(label string, t time.Time) textOutField {
+	s := w.timeFormat.Format(t)
+	if w.timeFormat.Name == timeFormatUnix {
+		return textOutField{label, json.Number(s)}
+	}
+	return textOutField{label, s}
+}
+
+// writeLog writes a log record.
+func (w *textOutWriter) writeLog(fields ...textOutField) error {
+	if w.buffered {
+		w.records = append(w.records, textOutRecord{kind: textOutRecordLog, fields: fields})
+		return nil
+	}
+	if w.format == textOutFormatCSV {
+		if w.logWriter == nil {
+			return nil
+		}
+		return writeLTSVRecord(w.logWriter, fields)
+	}
+	return w.writeRecord(fields)
+}
+
+// writeContext writes a context record.
+func (w *textOutWriter) writeContext(fields ...textOutField) error {
+	if w.buffered {
+		w.records = append(w.records, textOutRecord{kind: textOutRecordContext, fields: fields})
+		return nil
+	}
+	if w.format == textOutFormatCSV {
+		w.context = fields
+		return nil
+	}
+	return w.writeRecord(fields)
+}
+
+// writeHeader writes h as a record with the "header" label,
+// or in the format of whispertool.Header.String for LTSV.
+func (w *textOutWriter) writeHeader(h *whispertool.Header) error {
+	if w.buffered {
+		w.records = append(w.records, textOutRecord{kind: textOutRecordHeader, header: h})
+		return nil
+	}
+	switch w.format {
+	case textOutFormatCSV:
+		return nil
+	case textOutFormatJSON, textOutFormatNDJSON:
+		return w.writeRecord([]textOutField{{"header", h}})
+	default:
+		_, err := fmt.Fprint(w.Writer, h.String())
+		return err
+	}
+}
+
+// writeData writes a data record.
+func (w *textOutWriter) writeData(fields ...textOutField) error {
+	if w.buffered {
+		w.records = append(w.records, textOutRecord{kind: textOutRecordData, fields: fields})
+		return nil
+	}
+	if w.format != textOutFormatCSV {
+		return w.writeRecord(fields)
+	}
+
+	if w.csvWriter == nil {
+		w.csvWriter = csv.NewWriter(w.Writer)
+	}
+	columns := len(w.context) + len(fields)
+	if w.csvColumns == 0 {
+		w.csvColumns = columns
+		if err := w.csvWriter.Write(textOutCSVRow(w.context, fields, true)); err != nil {
+			return err
+		}
+	} else if columns != w.csvColumns {
+		return errors.New("cannot write records with different columns in csv format")
+	}
+	return w.csvWriter.Write(textOutCSVRow(w.context, fields, false))
+}
+
+func textOutCSVRow(context, fields []textOutField, header bool) []string {
+	row := make([]string, 0, len(context)+len(fields))
+	for _, fs := range [][]textOutField{context, fields} {
+		for _, f := range fs {
+			if header {
+				row = append(row, f.label)
+			} else {
+				row = append(row, fmt.Sprint(f.value))
+			}
+		}
+	}
+	return row
+}
+
+func (w *textOutWriter) writeRecord(fields []textOutField) error {
+	switch w.format {
+	case textOutFormatJSON:
+		b, err := marshalTextOutFields(fields)
+		if err != nil {
+			return err
+		}
+		sep := ",\n"
+		if w.jsonCount == 0 {
+			sep = "[\n"
+		}
+		w.jsonCount++
+		_, err = fmt.Fprintf(w.Writer, "%s%s", sep, b)
+		return err
+	case textOutFormatNDJSON:
+		b, err := marshalTextOutFields(fields)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w.Writer, "%s\n", b)
+		return err
+	default:
+		return writeLTSVRecord(w.Writer, fields)
+	}
+}
+
+func writeLTSVRecord(dst io.Writer, fields []textOutField) error {
+	var b bytes.Buffer
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte('\t')
+		}
+		fmt.Fprintf(&b, "%s:%v", f.label, f.value)
+	}
+	b.WriteByte('\n')
+	_, err := dst.Write(b.Bytes())
+	return err
+}
+
+// marshalTextOutFields returns a JSON object of fields in the same order.
+func marshalTextOutFields(fields []textOutField) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		label, err := json.Marshal(f.label)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(label)
+		b.WriteByte(':')
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// flush writes the closing bracket of JSON array and
+// buffered CSV rows.
+func (w *textOutWriter) flush() error {
+	switch w.format {
+	case textOutFormatJSON:
+		end := "\n]\n"
+		if w.jsonCount == 0 {
+			end = "[]\n"
+		}
+		_, err := io.WriteString(w.Writer, end)
+		return err
+	case textOutFormatCSV:
+		if w.csvWriter == nil {
+			return nil
+		}
+		w.csvWriter.Flush()
+		return w.csvWriter.Error()
+	}
+	return nil
+}
+
+type textOutFormatValue struct {
+	s *string
+}
+
+func (v textOutFormatValue) String() string {
+	if v.s == nil {
+		return ""
+	}
+	return *v.s
+}
+
+func (v textOutFormatValue) Set(s string) error {
+	switch s {
+	case textOutFormatLTSV, textOutFormatJSON, textOutFormatNDJSON, textOutFormatCSV:
+		*v.s = s
+		return nil
+	default:
+		return errors.New(`format must be one of "ltsv", "json", "ndjson" or "csv"`)
+	}
+}
+
 func nopFinish() error { return nil }
 
-func withTextOutWriter(textOut string, f func(io.Writer) error) (err error) {
-	tow, finish, err := newTextOutWriter(textOut)
+func withTextOutWriter(textOut, format string, timeFormat TimeFormat, f func(*textOutWriter) error) (err error) {
+	w, finish, err := newTextOutWriter(textOut)
 	if err != nil {
 		return nil
 	}
@@ -20,6 +323,15 @@ func withTextOutWriter(textOut string, f func(io.Writer) error) (err error) {
 			err = err2
 		}
 	}()
+	tow := &textOutWriter{Writer: w, format: format, timeFormat: timeFormat}
+	if textOut != "" {
+		tow.logWriter = os.Stderr
+	}
+	defer func() {
+		if err2 := tow.flush(); err2 != nil && err == nil {
+			err = err2
+		}
+	}()
 	return f(tow)
 }
 
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestTextOutWriter(t *testing.T) {
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:2m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := whispertool.NewHeader(whispertool.Sum, 0, archiveInfoList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptsList := PointsList{{
+		{Time: now.Add(-whispertool.Minute), Value: 1.5},
+		{Time: now, Value: whispertool.Value(math.NaN())},
+	}}
+
+	testCases := []struct {
+		format     string
+		timeFormat TimeFormat
+		want       string
+	}{
+		{
+			format: textOutFormatLTSV,
+			want: "now:2020-06-20T12:00:00Z\tsrcRel:a.wsp\n" +
+				"aggMethod:sum\taggMethodNum:2\tmaxRetention:2m\txFileFactor:0\tarchiveCount:1\n" +
+				"archiveInfo:0\tdurationPerPoint:1m\tnumberOfPoints:2\toffset:28\n" +
+				"archive:0\tt:2020-06-20T11:59:00Z\tval:1.5\n" +
+				"archive:0\tt:2020-06-20T12:00:00Z\tval:NaN\n",
+		},
+		{
+			format:     textOutFormatNDJSON,
+			timeFormat: TimeFormat{Name: timeFormatUnix},
+			want: `{"now":1592654400,"srcRel":"a.wsp"}` + "\n" +
+				`{"header":{"aggMethod":"sum","aggMethodNum":2,"maxRetention":120,"xFilesFactor":0,"archiveCount":1,` +
+				`"archiveInfoList":[{"secondsPerPoint":60,"numberOfPoints":2,"offset":28,"retention":"1m:2m"}]}}` + "\n" +
+				`{"archive":0,"t":1592654340,"val":1.5}` + "\n" +
+				`{"archive":0,"t":1592654400,"val":null}` + "\n",
+		},
+		{
+			format: textOutFormatJSON,
+			want: "[\n" + `{"now":"2020-06-20T12:00:00Z","srcRel":"a.wsp"}` + ",\n" +
+				`{"header":{"aggMethod":"sum","aggMethodNum":2,"maxRetention":120,"xFilesFactor":0,"archiveCount":1,` +
+				`"archiveInfoList":[{"secondsPerPoint":60,"numberOfPoints":2,"offset":28,"retention":"1m:2m"}]}}` + ",\n" +
+				`{"archive":0,"t":"2020-06-20T11:59:00Z","val":1.5}` + ",\n" +
+				`{"archive":0,"t":"2020-06-20T12:00:00Z","val":null}` + "\n]\n",
+		},
+		{
+			format: textOutFormatCSV,
+			want: "now,srcRel,archive,t,val\n" +
+				"2020-06-20T12:00:00Z,a.wsp,0,2020-06-20T11:59:00Z,1.5\n" +
+				"2020-06-20T12:00:00Z,a.wsp,0,2020-06-20T12:00:00Z,NaN\n",
+		},
+	}
+	for _, tc := range testCases {
+		var b bytes.Buffer
+		err := withTextOutWriter("", tc.format, tc.timeFormat, func(tow *textOutWriter) error {
+			tow.Writer = &b
+			if err := tow.writeContext(tow.timestampField("now", now), textOutField{"srcRel", "a.wsp"}); err != nil {
+				return err
+			}
+			return printFileData(tow, h, ptsList, true)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := b.String(), tc.want; got != want {
+			t.Errorf("output unmatch for format %s, got=\n%s\nwant=\n%s", tc.format, got, want)
+		}
+	}
+}
+
+func TestTextOutWriter_csvLog(t *testing.T) {
+	var b, logBuf bytes.Buffer
+	err := withTextOutWriter("", textOutFormatCSV, TimeFormat{}, func(tow *textOutWriter) error {
+		tow.Writer = &b
+		tow.logWriter = &logBuf
+		if err := tow.writeLog(textOutField{"msg", "copy failed"}, textOutField{"err", "file not found"}); err != nil {
+			return err
+		}
+		return tow.writeData(textOutField{"archive", 0}, textOutField{"val", 1.5})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "archive,val\n0,1.5\n"; got != want {
+		t.Errorf("output unmatch, got=%q, want=%q", got, want)
+	}
+	if got, want := logBuf.String(), "msg:copy failed\terr:file not found\n"; got != want {
+		t.Errorf("log output unmatch, got=%q, want=%q", got, want)
+	}
+}
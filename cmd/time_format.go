@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+)
+
+// Names of time formats for the -time-format option.
+const (
+	timeFormatUTC     = "utc"
+	timeFormatRFC3339 = "rfc3339"
+	timeFormatUnix    = "unix"
+)
+
+const timeFormatUsage = `format of time in text output. "utc" (2006-01-02T15:04:05Z), ` +
+	`"rfc3339" (2006-01-02T15:04:05+09:00 in -tz) or "unix" (Unix seconds). ` +
+	`default is "utc", or "rfc3339" if -tz is specified.`
+
+const timeZoneUsage = `time zone for -time-format=rfc3339 (ex. Asia/Tokyo, Local). default is Local.`
+
+// TimeFormat is the format of time in text output.
+// The zero value formats time in UTCTimeLayout.
+type TimeFormat struct {
+	Name     string
+	Location *time.Location
+}
+
+// FormatTimestamp returns the string representation of t in f.
+func (f *TimeFormat) FormatTimestamp(t whispertool.Timestamp) string {
+	return f.Format(t.ToStdTime())
+}
+
+// Format returns the string representation of t in f.
+func (f *TimeFormat) Format(t time.Time) string {
+	name := f.Name
+	if name == "" {
+		if f.Location == nil {
+			name = timeFormatUTC
+		} else {
+			name = timeFormatRFC3339
+		}
+	}
+
+	switch name {
+	case timeFormatRFC3339:
+		loc := f.Location
+		if loc == nil {
+			loc = time.Local
+		}
+		return t.In(loc).Format(time.RFC3339)
+	case timeFormatUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	default:
+		return t.UTC().Format(whispertool.UTCTimeLayout)
+	}
+}
+
+type timeFormatValue struct {
+	f *TimeFormat
+}
+
+func (v timeFormatValue) String() string {
+	if v.f == nil {
+		return ""
+	}
+	return v.f.Name
+}
+
+func (v timeFormatValue) Set(s string) error {
+	switch s {
+	case timeFormatUTC, timeFormatRFC3339, timeFormatUnix:
+		v.f.Name = s
+		return nil
+	default:
+		return errors.New(`time format must be one of "utc", "rfc3339" or "unix"`)
+	}
+}
+
+type timeZoneValue struct {
+	f *TimeFormat
+}
+
+func (v timeZoneValue) String() string {
+	if v.f == nil || v.f.Location == nil {
+		return ""
+	}
+	return v.f.Location.String()
+}
+
+func (v timeZoneValue) Set(s string) error {
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return err
+	}
+	v.f.Location = loc
+	return nil
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestTimeFormat_FormatTimestamp(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	ts, err := whispertool.ParseTimestamp("2020-06-20T12:34:56Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		f    TimeFormat
+		want string
+	}{
+		{f: TimeFormat{}, want: "2020-06-20T12:34:56Z"},
+		{f: TimeFormat{Name: timeFormatUTC, Location: tokyo}, want: "2020-06-20T12:34:56Z"},
+		{f: TimeFormat{Location: tokyo}, want: "2020-06-20T21:34:56+09:00"},
+		{f: TimeFormat{Name: timeFormatRFC3339, Location: time.UTC}, want: "2020-06-20T12:34:56Z"},
+		{f: TimeFormat{Name: timeFormatUnix, Location: tokyo}, want: "1592656496"},
+	}
+	for _, tc := range testCases {
+		if got, want := tc.f.FormatTimestamp(ts), tc.want; got != want {
+			t.Errorf("result unmatch for format %+v, got=%s, want=%s", tc.f, got, want)
+		}
+	}
+}
@@ -78,6 +78,12 @@ func (tl TimeSeriesList) Equal(tl2 TimeSeriesList) bool {
 }
 
 func (tl TimeSeriesList) Diff(ul TimeSeriesList) (PointsList, PointsList) {
+	return tl.DiffWithTolerance(ul, whispertool.Tolerance{})
+}
+
+// DiffWithTolerance returns the different points between tl and ul
+// with values compared within tol.
+func (tl TimeSeriesList) DiffWithTolerance(ul TimeSeriesList, tol whispertool.Tolerance) (PointsList, PointsList) {
 	if len(tl) != len(ul) {
 		return tl.PointsList(), ul.PointsList()
 	}
@@ -85,7 +91,11 @@ func (tl TimeSeriesList) Diff(ul TimeSeriesList) (PointsList, PointsList) {
 	pl2 := make(PointsList, len(tl))
 	ql2 := make(PointsList, len(ul))
 	for i, ts := range tl {
-		pl2[i], ql2[i] = ts.DiffPoints(ul[i])
+		if ts == nil || ul[i] == nil {
+			pl2[i], ql2[i] = ts.Points(), ul[i].Points()
+			continue
+		}
+		pl2[i], ql2[i] = ts.DiffPointsWithTolerance(ul[i], tol)
 	}
 	return pl2, ql2
 }
@@ -98,6 +108,10 @@ func (tl TimeSeriesList) DiffExcludeSrcNaN(ul TimeSeriesList) (PointsList, Point
 	pl2 := make(PointsList, len(tl))
 	ql2 := make(PointsList, len(ul))
 	for i, ts := range tl {
+		if ts == nil || ul[i] == nil {
+			pl2[i], ql2[i] = ts.Points(), ul[i].Points()
+			continue
+		}
 		pl2[i], ql2[i] = ts.DiffPointsExcludeSrcNaN(ul[i])
 	}
 	return pl2, ql2
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+)
+
+// UndoCommand restores dest whisper files with the previous values of
+// points recorded in an undo log by copy or sum-copy.
+type UndoCommand struct {
+	In         string
+	InFormat   string
+	DestBase   string
+	Now        whispertool.Timestamp
+	DryRun     bool
+	TextOut    string
+	Format     string
+	TimeFormat TimeFormat
+}
+
+func (c *UndoCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.In, "in", "-", "undo log file written with -undo-log option of copy or sum-copy. - means stdin.")
+	fs.StringVar(&c.InFormat, "in-format", undoLogFormatBinary, undoLogFormatUsage)
+	fs.StringVar(&c.DestBase, "dest-base", "", "dest base directory which was the dest base of copy or sum-copy")
+
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
+	fs.BoolVar(&c.DryRun, "dry-run", false, "show what would be restored without writing files")
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of restoring data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.Parse(args)
+
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
+	if c.DestBase == "" {
+		return newRequiredOptionError(fs, "dest-base")
+	}
+	if isBaseURL(c.DestBase) {
+		return errors.New("dest-base must be local directory")
+	}
+	if err := validateUndoLogFormat(c.InFormat); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *UndoCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *UndoCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
+	t0 := time.Now()
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now),
+		textOutField{"dryRun", c.DryRun})
+	var totalFileCount, totalUpdated, totalSkipped int
+	defer func() {
+		t1 := time.Now()
+		tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+			textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalFileCount", totalFileCount},
+			textOutField{"totalUpdated", totalUpdated}, textOutField{"totalSkipped", totalSkipped},
+			textOutField{"dryRun", c.DryRun})
+	}()
+
+	rows, err := c.readRows()
+	if err != nil {
+		return err
+	}
+
+	u := &UpdateCommand{
+		DestBase: c.DestBase,
+		DryRun:   c.DryRun,
+	}
+	totalFileCount, totalUpdated, totalSkipped, err = u.updateFiles(tow, oldestUndoRows(rows), now)
+	return err
+}
+
+func (c *UndoCommand) readRows() ([]updateRow, error) {
+	if c.In == "-" {
+		return readUndoLog(os.Stdin, c.InFormat)
+	}
+
+	file, err := os.Open(c.In)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := readUndoLog(file, c.InFormat)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", c.In, err)
+	}
+	return rows, nil
+}
+
+// oldestUndoRows returns rows without later rows of the same point.
+// When a point is overwritten more than once, the undo log has records
+// for each of them and the first one has the value before all of them.
+func oldestUndoRows(rows []updateRow) []updateRow {
+	type pointKey struct {
+		relPath   string
+		archiveID int
+		t         whispertool.Timestamp
+	}
+	seen := make(map[pointKey]bool)
+	var rows2 []updateRow
+	for _, row := range rows {
+		k := pointKey{relPath: row.relPath, archiveID: row.archiveID, t: row.point.Time}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		rows2 = append(rows2, row)
+	}
+	return rows2
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/hnakamur/whispertool"
+)
+
+// Names of formats of undo logs.
+const (
+	undoLogFormatBinary = "binary"
+	undoLogFormatText   = "text"
+)
+
+const undoLogFormatUsage = `format of undo log. "binary" (records of file and Points binary encoding ` +
+	`for each archive) or "text" (LTSV lines of file, archive, t and val)`
+
+var (
+	errInvalidUndoLogFormat = errors.New(`undo log format must be "binary" or "text"`)
+	errTruncatedUndoLog     = errors.New("truncated undo log record")
+)
+
+const undoLogUint64Size = 8
+
+// UndoLogOptions is options to record previous values of dest points
+// which are overwritten, so that they can be restored with the undo
+// subcommand.
+type UndoLogOptions struct {
+	// Filename is the undo log file which records are appended to.
+	// Empty means no undo log.
+	Filename string
+
+	// Format is undoLogFormatBinary or undoLogFormatText.
+	Format string
+}
+
+func (o *UndoLogOptions) setFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Filename, "undo-log", "",
+		"file to append previous values of overwritten dest points to, for the undo subcommand. empty means no undo log.")
+	fs.StringVar(&o.Format, "undo-log-format", undoLogFormatBinary, undoLogFormatUsage)
+}
+
+func validateUndoLogFormat(format string) error {
+	switch format {
+	case undoLogFormatBinary, undoLogFormatText:
+		return nil
+	default:
+		return errInvalidUndoLogFormat
+	}
+}
+
+// undoLogWriter appends records of previous dest points to an undo log.
+// It is safe for concurrent use and a nil writer writes nothing.
+type undoLogWriter struct {
+	mu     sync.Mutex
+	file   *os.File
+	format string
+	buf    []byte
+}
+
+// openUndoLog opens the undo log for appending. It returns nil if
+// o.Filename is empty.
+func openUndoLog(o UndoLogOptions) (*undoLogWriter, error) {
+	if o.Filename == "" {
+		return nil, nil
+	}
+	format := o.Format
+	if format == "" {
+		format = undoLogFormatBinary
+	}
+	if err := validateUndoLogFormat(format); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(o.Filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &undoLogWriter{file: file, format: format}, nil
+}
+
+// write appends the previous points of the file at relPath to dest base
+// and syncs the log, so that the record is kept before dest points are
+// overwritten.
+func (w *undoLogWriter) write(relPath string, pointsList PointsList) error {
+	if w == nil || pointsList.AllEmpty() {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = w.buf[:0]
+	if w.format == undoLogFormatText {
+		for archiveID, pts := range pointsList {
+			for _, p := range pts {
+				w.buf = append(w.buf, fmt.Sprintf("file:%s\tarchive:%d\tt:%s\tval:%s\n",
+					relPath, archiveID, p.Time, p.Value)...)
+			}
+		}
+	} else {
+		w.buf = appendUndoRecord(w.buf, relPath, pointsList)
+	}
+	if _, err := w.file.Write(w.buf); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *undoLogWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	return w.file.Close()
+}
+
+// appendUndoRecord appends a binary record of the undo log to dst. The
+// record consists of the length of relPath in uint64, relPath, the number
+// of archives in uint64 and Points binary encoding for each archive.
+func appendUndoRecord(dst []byte, relPath string, pointsList PointsList) []byte {
+	var b [undoLogUint64Size]byte
+	binary.BigEndian.PutUint64(b[:], uint64(len(relPath)))
+	dst = append(dst, b[:]...)
+	dst = append(dst, relPath...)
+	binary.BigEndian.PutUint64(b[:], uint64(len(pointsList)))
+	dst = append(dst, b[:]...)
+	for i := range pointsList {
+		dst = pointsList[i].AppendTo(dst)
+	}
+	return dst
+}
+
+// readUndoLog reads points in the undo log in the order of records.
+func readUndoLog(r io.Reader, format string) ([]updateRow, error) {
+	switch format {
+	case undoLogFormatText:
+		return readUpdateRowsLTSV(r, updateRowDefaults{})
+	case undoLogFormatBinary:
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		var rows []updateRow
+		for len(data) > 0 {
+			if data, err = takeUndoRecord(data, &rows); err != nil {
+				return nil, err
+			}
+		}
+		return rows, nil
+	default:
+		return nil, errInvalidUndoLogFormat
+	}
+}
+
+// takeUndoRecord takes a binary record from data and appends its points
+// to rows. It returns the rest of data.
+func takeUndoRecord(data []byte, rows *[]updateRow) ([]byte, error) {
+	if len(data) < undoLogUint64Size {
+		return nil, errTruncatedUndoLog
+	}
+	n := binary.BigEndian.Uint64(data)
+	data = data[undoLogUint64Size:]
+	if len(data) < undoLogUint64Size || n > uint64(len(data)-undoLogUint64Size) {
+		return nil, errTruncatedUndoLog
+	}
+	relPath, err := cleanRelPath(string(data[:n]))
+	if err != nil {
+		return nil, err
+	}
+	data = data[n:]
+	archiveCount := int(binary.BigEndian.Uint64(data))
+	data = data[undoLogUint64Size:]
+	for archiveID := 0; archiveID < archiveCount; archiveID++ {
+		var pts whispertool.Points
+		if data, err = pts.TakeFrom(data); err != nil {
+			return nil, errTruncatedUndoLog
+		}
+		for _, p := range pts {
+			*rows = append(*rows, updateRow{relPath: relPath, archiveID: archiveID, point: p})
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestUndoCommand(t *testing.T) {
+	for _, format := range []string{undoLogFormatBinary, undoLogFormatText} {
+		format := format
+		t.Run(format, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "whispertool-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+			if err != nil {
+				t.Fatal(err)
+			}
+			archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:5m")
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, err := whispertool.NewHeader(whispertool.Sum, 0, archiveInfoList)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := whispertool.Minute
+			writeFile := func(filename string, pts whispertool.Points) {
+				db, err := whispertool.Open(filename)
+				if os.IsNotExist(err) {
+					db, err = createUpdateDestFile(filename, h)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := db.UpdatePointsForArchive(pts, 0, now); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Sync(); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			readValues := func(base string) string {
+				_, tsList, err := readWhisperFile(base, "m.wsp", ArchiveIDAll, now.Add(-3*m), now, now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := json.Marshal(tsList[0].Values())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return string(got)
+			}
+
+			srcBase := filepath.Join(dir, "src")
+			destBase := filepath.Join(dir, "dest")
+			undoLog := filepath.Join(dir, "undo.log")
+			writeFile(filepath.Join(destBase, "m.wsp"), whispertool.Points{{Time: now.Add(-2 * m), Value: 1}, {Time: now.Add(-m), Value: 2}})
+			want := readValues(destBase)
+
+			// The second copy overwrites points which the first copy overwrote,
+			// and undo must restore values before the first copy.
+			for _, v := range []whispertool.Value{10, 20} {
+				writeFile(filepath.Join(srcBase, "m.wsp"), whispertool.Points{{Time: now.Add(-m), Value: v}, {Time: now, Value: v}})
+				c := &CopyCommand{
+					SrcBase:           srcBase,
+					SrcRelPath:        "m.wsp",
+					DestBase:          destBase,
+					AggregationMethod: whispertool.Sum,
+					ArchiveInfoList:   archiveInfoList,
+					Now:               now,
+					ArchiveID:         ArchiveIDAll,
+					UndoLog:           UndoLogOptions{Filename: undoLog, Format: format},
+				}
+				if err := c.execute(&textOutWriter{Writer: ioutil.Discard}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got, wantCopied := readValues(destBase), "[1,20,20]"; got != wantCopied {
+				t.Fatalf("copied values unmatch, got=%s, want=%s", got, wantCopied)
+			}
+
+			u := &UndoCommand{
+				In:       undoLog,
+				InFormat: format,
+				DestBase: destBase,
+				Now:      now,
+			}
+			if err := u.execute(&textOutWriter{Writer: ioutil.Discard}); err != nil {
+				t.Fatal(err)
+			}
+			if got := readValues(destBase); got != want {
+				t.Errorf("restored values unmatch, got=%s, want=%s", got, want)
+			}
+		})
+	}
+}
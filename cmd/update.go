@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/hnakamur/whispertool"
+)
+
+type UpdateCommand struct {
+	DestBase          string
+	DestRelPath       string
+	In                string
+	InFormat          string
+	AggregationMethod whispertool.AggregationMethod
+	XFilesFactor      float32
+	ArchiveInfoList   whispertool.ArchiveInfoList
+	Now               whispertool.Timestamp
+	ArchiveID         int
+	DryRun            bool
+	TextOut           string
+	Format            string
+	TimeFormat        TimeFormat
+}
+
+// updateFileResult is the result of updating a whisper file.
+type updateFileResult struct {
+	created        bool
+	updatedCounts  map[int]int
+	skippedCounts  map[int]int
+	totalUpdated   int
+	totalSkipped   int
+	archiveIDOrder []int
+}
+
+func (c *UpdateCommand) Parse(fs *flag.FlagSet, args []string) error {
+	fs.StringVar(&c.DestBase, "dest-base", "", "dest base directory")
+	fs.StringVar(&c.DestRelPath, "dest", "", "whisper file relative path to dest base. used for input rows without file or metric.")
+	fs.StringVar(&c.In, "in", "-", "input file. - means stdin.")
+	fs.StringVar(&c.InFormat, "in-format", updateInFormatPlaintext,
+		`format of input. "plaintext" (carbon plaintext protocol), "csv" (with a header row) or "ltsv" (text output of whispertool)`)
+
+	fs.Var(&aggregationMethodValue{&c.AggregationMethod}, "agg-method", "aggregation method for creating missing files")
+	fs.Var(&xFilesFactorValue{&c.XFilesFactor}, "x-files-factor", "xFilesFactor for creating missing files")
+	fs.Var(&archiveInfoListValue{&c.ArchiveInfoList}, "retentions", "retentions definitions for creating missing files. empty means missing files are errors.")
+
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
+	fs.IntVar(&c.ArchiveID, "archive", whispertool.ArchiveIDBest, "archive ID for input rows without archive (-1 is the best archive for each point).")
+	fs.BoolVar(&c.DryRun, "dry-run", false, "show what would be updated without writing files")
+	fs.StringVar(&c.TextOut, "text-out", "-", "text output of updating data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
+	fs.Parse(args)
+
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
+	if c.DestBase == "" {
+		return newRequiredOptionError(fs, "dest-base")
+	}
+	if isBaseURL(c.DestBase) {
+		return errors.New("dest-base must be local directory")
+	}
+	switch c.InFormat {
+	case updateInFormatPlaintext, updateInFormatCSV, updateInFormatLTSV:
+	default:
+		return errors.New(`in-format must be one of "plaintext", "csv" or "ltsv"`)
+	}
+	if c.ArchiveInfoList != nil && c.AggregationMethod == 0 {
+		return newRequiredOptionError(fs, "agg-method")
+	}
+	return nil
+}
+
+func (c *UpdateCommand) Execute() error {
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
+}
+
+func (c *UpdateCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
+	t0 := time.Now()
+	tow.writeLog(tow.timeField("time", t0), textOutField{"msg", "start"}, tow.timestampField("now", now),
+		textOutField{"dryRun", c.DryRun})
+	var totalFileCount, totalUpdated, totalSkipped int
+	defer func() {
+		t1 := time.Now()
+		tow.writeLog(tow.timeField("time", t1), textOutField{"msg", "finish"}, tow.timestampField("now", now),
+			textOutField{"duration", t1.Sub(t0).String()}, textOutField{"totalFileCount", totalFileCount},
+			textOutField{"totalUpdated", totalUpdated}, textOutField{"totalSkipped", totalSkipped},
+			textOutField{"dryRun", c.DryRun})
+	}()
+
+	var destRelPath string
+	if c.DestRelPath != "" {
+		destRelPath, err = cleanRelPath(c.DestRelPath)
+		if err != nil {
+			return err
+		}
+	}
+	rows, err := c.readRows(updateRowDefaults{
+		relPath:   destRelPath,
+		archiveID: c.ArchiveID,
+		now:       now,
+	})
+	if err != nil {
+		return err
+	}
+
+	totalFileCount, totalUpdated, totalSkipped, err = c.updateFiles(tow, rows, now)
+	return err
+}
+
+// updateFiles updates files with rows and writes the result of each file.
+// It is also used by other commands which read rows in other formats.
+func (c *UpdateCommand) updateFiles(tow *textOutWriter, rows []updateRow, now whispertool.Timestamp) (fileCount, updated, skipped int, err error) {
+	groups := groupUpdateRows(rows)
+	relPaths := make([]string, 0, len(groups))
+	for relPath := range groups {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+	fileCount = len(relPaths)
+
+	for _, relPath := range relPaths {
+		res, err := c.updateOneFile(relPath, groups[relPath], now)
+		if err != nil {
+			return fileCount, updated, skipped, fmt.Errorf("%s: %s", relPath, err)
+		}
+		updated += res.totalUpdated
+		skipped += res.totalSkipped
+		if err := printUpdateFileResult(tow, relPath, res); err != nil {
+			return fileCount, updated, skipped, err
+		}
+	}
+	return fileCount, updated, skipped, nil
+}
+
+func (c *UpdateCommand) readRows(defaults updateRowDefaults) ([]updateRow, error) {
+	if c.In == "-" {
+		return readUpdateRows(os.Stdin, c.InFormat, defaults)
+	}
+
+	file, err := os.Open(c.In)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := readUpdateRows(file, c.InFormat, defaults)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", c.In, err)
+	}
+	return rows, nil
+}
+
+// groupUpdateRows groups points per file and archive.
+func groupUpdateRows(rows []updateRow) map[string]map[int]whispertool.Points {
+	groups := make(map[string]map[int]whispertool.Points)
+	for _, row := range rows {
+		g := groups[row.relPath]
+		if g == nil {
+			g = make(map[int]whispertool.Points)
+			groups[row.relPath] = g
+		}
+		g[row.archiveID] = append(g[row.archiveID], row.point)
+	}
+	return groups
+}
+
+func (c *UpdateCommand) updateOneFile(relPath string, ptsMap map[int]whispertool.Points, now whispertool.Timestamp) (res updateFileResult, err error) {
+	res.updatedCounts = make(map[int]int)
+	res.skippedCounts = make(map[int]int)
+
+	var db *whispertool.Whisper
+	var h *whispertool.Header
+	fullPath := filepath.Join(c.DestBase, relPath)
+	if c.DryRun {
+		db, err = whispertool.Open(fullPath, whispertool.WithOpenFileFlag(os.O_RDONLY))
+	} else {
+		db, err = whispertool.Open(fullPath)
+	}
+	if err == nil {
+		defer db.Close()
+		h = db.Header()
+	} else {
+		if !os.IsNotExist(err) || c.ArchiveInfoList == nil {
+			return res, err
+		}
+		h, err = whispertool.NewHeader(c.AggregationMethod, c.XFilesFactor, c.ArchiveInfoList)
+		if err != nil {
+			return res, err
+		}
+		res.created = true
+	}
+
+	for archiveID := range ptsMap {
+		if archiveID != whispertool.ArchiveIDBest && (archiveID < 0 || archiveID >= len(h.ArchiveInfoList())) {
+			return res, whispertool.ErrArchiveIDOutOfRange
+		}
+		res.archiveIDOrder = append(res.archiveIDOrder, archiveID)
+	}
+	sort.Ints(res.archiveIDOrder)
+
+	pointsList := make(map[int]whispertool.Points, len(ptsMap))
+	for _, archiveID := range res.archiveIDOrder {
+		var maxRetention whispertool.Duration
+		if archiveID == whispertool.ArchiveIDBest {
+			maxRetention = h.MaxRetention()
+		} else {
+			maxRetention = h.ArchiveInfoList()[archiveID].MaxRetention()
+		}
+		var pts whispertool.Points
+		for _, p := range ptsMap[archiveID] {
+			if p.Time <= now.Add(-maxRetention) || now < p.Time {
+				res.skippedCounts[archiveID]++
+				continue
+			}
+			pts = append(pts, p)
+		}
+		pointsList[archiveID] = pts
+		res.updatedCounts[archiveID] = len(pts)
+		res.totalUpdated += len(pts)
+		res.totalSkipped += res.skippedCounts[archiveID]
+	}
+
+	if c.DryRun {
+		return res, nil
+	}
+
+	if res.created {
+		db, err = createUpdateDestFile(fullPath, h)
+		if err != nil {
+			return res, err
+		}
+		defer db.Close()
+	}
+	for _, archiveID := range res.archiveIDOrder {
+		if len(pointsList[archiveID]) == 0 {
+			continue
+		}
+		if err := db.UpdatePointsForArchive(pointsList[archiveID], archiveID, now); err != nil {
+			return res, err
+		}
+	}
+	if err := db.Sync(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func createUpdateDestFile(filename string, h *whispertool.Header) (*whispertool.Whisper, error) {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("mkdirAll: dir=%s: err=%s", dir, err)
+	}
+	return whispertool.Create(filename, h.ArchiveInfoList(), h.AggregationMethod(), h.XFilesFactor())
+}
+
+func printUpdateFileResult(w *textOutWriter, relPath string, res updateFileResult) error {
+	if err := w.writeContext(textOutField{"file", relPath}, textOutField{"created", res.created}); err != nil {
+		return err
+	}
+	for _, archiveID := range res.archiveIDOrder {
+		err := w.writeData(textOutField{"archive", archiveID},
+			textOutField{"updated", res.updatedCounts[archiveID]},
+			textOutField{"skipped", res.skippedCounts[archiveID]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
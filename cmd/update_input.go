@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hnakamur/whispertool"
+)
+
+// Names of formats for the -in-format option of the update subcommand.
+const (
+	updateInFormatPlaintext = "plaintext"
+	updateInFormatCSV       = "csv"
+	updateInFormatLTSV      = "ltsv"
+)
+
+// updateRow is a point to update read from input.
+type updateRow struct {
+	relPath   string
+	archiveID int
+	point     whispertool.Point
+}
+
+// updateRowDefaults is the default values for fields missing in input.
+type updateRowDefaults struct {
+	relPath   string
+	archiveID int
+	now       whispertool.Timestamp
+}
+
+// readUpdateRows reads rows in the specified format.
+func readUpdateRows(r io.Reader, format string, defaults updateRowDefaults) ([]updateRow, error) {
+	switch format {
+	case updateInFormatPlaintext:
+		return readUpdateRowsPlaintext(r, defaults)
+	case updateInFormatCSV:
+		return readUpdateRowsCSV(r, defaults)
+	case updateInFormatLTSV:
+		return readUpdateRowsLTSV(r, defaults)
+	default:
+		return nil, fmt.Errorf("unsupported input format: %s", format)
+	}
+}
+
+// readUpdateRowsPlaintext reads rows in carbon's plaintext protocol,
+// that is "<metric path> <value> <timestamp>" per line.
+// Like carbon, the timestamp may have a fraction and -1 means now.
+func readUpdateRowsPlaintext(r io.Reader, defaults updateRowDefaults) ([]updateRow, error) {
+	var rows []updateRow
+	s := bufio.NewScanner(r)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: invalid plaintext line: %s", lineNo, line)
+		}
+		relPath, err := metricToRelPath(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value: %s", lineNo, fields[1])
+		}
+		f, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || (f < 0 && f != -1) || f > math.MaxUint32 {
+			return nil, fmt.Errorf("line %d: invalid timestamp: %s", lineNo, fields[2])
+		}
+		t := whispertool.Timestamp(f)
+		if f == -1 {
+			t = defaults.now
+		}
+		rows = append(rows, updateRow{
+			relPath:   relPath,
+			archiveID: defaults.archiveID,
+			point:     whispertool.Point{Time: t, Value: whispertool.Value(v)},
+		})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// readUpdateRowsCSV reads rows in CSV with a header row.
+// See updateRowFromFields for column names.
+func readUpdateRowsCSV(r io.Reader, defaults updateRowDefaults) ([]updateRow, error) {
+	cr := csv.NewReader(r)
+	columns, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var rows []updateRow
+	fields := make(map[string]string, len(columns))
+	for lineNo := 2; ; lineNo++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, c := range columns {
+			fields[c] = record[i]
+		}
+		row, err := updateRowFromFields(fields, defaults)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readUpdateRowsLTSV reads rows in LTSV which whispertool writes
+// to text output. Lines without "t" label like headers and logs are
+// skipped, but a file in them is used for following lines like
+// a context record written by copy.
+func readUpdateRowsLTSV(r io.Reader, defaults updateRowDefaults) ([]updateRow, error) {
+	var rows []updateRow
+	s := bufio.NewScanner(r)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		fields := parseLTSVLine(line)
+		if _, ok := fields["t"]; !ok {
+			if relPath, ok, err := relPathFromFields(fields); err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNo, err)
+			} else if ok {
+				defaults.relPath = relPath
+			}
+			continue
+		}
+		row, err := updateRowFromFields(fields, defaults)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		rows = append(rows, row)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// updateRowFromFields makes a row from labeled fields.
+// The time is taken from "t" and the value from "val" or "value".
+// The file is taken from "file", "metric", "destRel" or "srcRel"
+// in this order of precedence and "archive" is optional.
+func updateRowFromFields(fields map[string]string, defaults updateRowDefaults) (updateRow, error) {
+	row := updateRow{relPath: defaults.relPath, archiveID: defaults.archiveID}
+	if relPath, ok, err := relPathFromFields(fields); err != nil {
+		return updateRow{}, err
+	} else if ok {
+		row.relPath = relPath
+	}
+	if row.relPath == "" {
+		return updateRow{}, errors.New("file not found in input and -dest is not specified")
+	}
+
+	if s, ok := fields["archive"]; ok && s != "" {
+		archiveID, err := strconv.Atoi(s)
+		if err != nil {
+			return updateRow{}, fmt.Errorf("invalid archive: %s", s)
+		}
+		row.archiveID = archiveID
+	}
+
+	t, err := whispertool.ParseTimestamp(fields["t"])
+	if err != nil {
+		return updateRow{}, err
+	}
+	row.point.Time = t
+
+	s, ok := fields["val"]
+	if !ok {
+		s, ok = fields["value"]
+	}
+	if !ok {
+		return updateRow{}, errors.New("val not found in input")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return updateRow{}, fmt.Errorf("invalid value: %s", s)
+	}
+	row.point.Value = whispertool.Value(v)
+	return row, nil
+}
+
+func relPathFromFields(fields map[string]string) (relPath string, ok bool, err error) {
+	if s := fields["file"]; s != "" {
+		relPath, err = cleanRelPath(s)
+		return relPath, err == nil, err
+	}
+	if s := fields["metric"]; s != "" {
+		relPath, err = metricToRelPath(s)
+		return relPath, err == nil, err
+	}
+	for _, label := range []string{"destRel", "srcRel"} {
+		if s := fields[label]; s != "" {
+			relPath, err = cleanRelPath(s)
+			return relPath, err == nil, err
+		}
+	}
+	return "", false, nil
+}
+
+func metricToRelPath(metric string) (string, error) {
+	return cleanRelPath(itemToRelDir(metric) + ".wsp")
+}
+
+// cleanRelPath returns the cleaned relPath. It returns an error
+// if relPath is absolute or goes out of the base directory.
+func cleanRelPath(relPath string) (string, error) {
+	p := filepath.Clean(relPath)
+	if filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file must be a relative path in the base directory: %s", relPath)
+	}
+	return p, nil
+}
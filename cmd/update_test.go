@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hnakamur/whispertool"
+)
+
+func TestReadUpdateRows(t *testing.T) {
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := updateRowDefaults{relPath: "default.wsp", archiveID: whispertool.ArchiveIDBest, now: now}
+
+	testCases := []struct {
+		format string
+		input  string
+		want   []updateRow
+	}{
+		{
+			format: updateInFormatPlaintext,
+			input:  "app.web.requests 1.5 1592654340\napp.db.requests 2 -1\n",
+			want: []updateRow{
+				{relPath: "app/web/requests.wsp", archiveID: -1, point: whispertool.Point{Time: now - 60, Value: 1.5}},
+				{relPath: "app/db/requests.wsp", archiveID: -1, point: whispertool.Point{Time: now, Value: 2}},
+			},
+		},
+		{
+			format: updateInFormatCSV,
+			input:  "now,srcRel,archive,t,val\n2020-06-20T12:00:00Z,a.wsp,1,2020-06-20T11:00:00Z,3\n,,,1592654340,4\n",
+			want: []updateRow{
+				{relPath: "a.wsp", archiveID: 1, point: whispertool.Point{Time: now - 3600, Value: 3}},
+				{relPath: "default.wsp", archiveID: -1, point: whispertool.Point{Time: now - 60, Value: 4}},
+			},
+		},
+		{
+			format: updateInFormatLTSV,
+			input: "archive:0\tt:2020-06-20T11:59:00Z\tval:5\n" +
+				"now:2020-06-20T12:00:00Z\tsrcRel:b.wsp\tdestRel:c.wsp\n" +
+				"aggMethod:sum\taggMethodNum:2\tmaxRetention:2m\txFileFactor:0\tarchiveCount:1\n" +
+				"archive:0\tt:2020-06-20T12:00:00+09:00\tval:6\n",
+			want: []updateRow{
+				{relPath: "default.wsp", archiveID: 0, point: whispertool.Point{Time: now - 60, Value: 5}},
+				{relPath: "c.wsp", archiveID: 0, point: whispertool.Point{Time: now - 9*3600, Value: 6}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		got, err := readUpdateRows(strings.NewReader(tc.input), tc.format, defaults)
+		if err != nil {
+			t.Fatalf("error for format %s: %s", tc.format, err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("row count unmatch for format %s, got=%d, want=%d", tc.format, len(got), len(tc.want))
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("row unmatch for format %s, i=%d, got=%+v, want=%+v", tc.format, i, got[i], tc.want[i])
+			}
+		}
+	}
+
+	invalidInputs := []struct {
+		format string
+		input  string
+	}{
+		{format: updateInFormatPlaintext, input: "a.b 1\n"},
+		{format: updateInFormatPlaintext, input: "..foo 1 1592654340\n"},
+		{format: updateInFormatCSV, input: "file,t,val\n../a.wsp,1592654340,1\n"},
+		{format: updateInFormatLTSV, input: "t:1592654340\n"},
+	}
+	for _, tc := range invalidInputs {
+		if _, err := readUpdateRows(strings.NewReader(tc.input), tc.format, defaults); err == nil {
+			t.Errorf("should get error for format %s, input %q", tc.format, tc.input)
+		}
+	}
+}
+
+func TestUpdateCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whispertool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.txt")
+	if err := ioutil.WriteFile(input, []byte("a.b 1 1592654340\na.b 2 1592654400\na.b 3 1500000000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now, err := whispertool.ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveInfoList, err := whispertool.ParseArchiveInfoList("1m:1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &UpdateCommand{
+		DestBase:          dir,
+		In:                input,
+		InFormat:          updateInFormatPlaintext,
+		AggregationMethod: whispertool.Sum,
+		ArchiveInfoList:   archiveInfoList,
+		Now:               now,
+		ArchiveID:         whispertool.ArchiveIDBest,
+		DryRun:            true,
+	}
+	if err := c.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	destFilename := filepath.Join(dir, "a", "b.wsp")
+	if _, err := os.Stat(destFilename); !os.IsNotExist(err) {
+		t.Fatalf("file should not be created in dry run, err=%v", err)
+	}
+
+	c.DryRun = false
+	if err := c.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	_, tsList, err := readWhisperFileLocal(destFilename, 0, now.Add(-2*whispertool.Minute), now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tsList[0].Values(), []whispertool.Value{1, 2}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("values unmatch, got=%v, want=%v", got, want)
+	}
+}
@@ -3,13 +3,11 @@ package cmd
 import (
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/hnakamur/whispertool"
 )
@@ -23,28 +21,39 @@ type ViewCommand struct {
 	SrcRelPath string
 	From       whispertool.Timestamp
 	Until      whispertool.Timestamp
+	Now        whispertool.Timestamp
 	ArchiveID  int
 	ShowHeader bool
 	TextOut    string
+	Format     string
+	TimeFormat TimeFormat
 }
 
 func (c *ViewCommand) Parse(fs *flag.FlagSet, args []string) error {
 	fs.StringVar(&c.SrcBase, "src-base", "", "src base directory or URL of \"whispertool server\"")
-	fs.StringVar(&c.SrcRelPath, "src", "", "whisper file relative path to src base")
-	fs.Var(&timestampValue{t: &c.From}, "from", "range start UTC time in 2006-01-02T15:04:05Z format")
-	fs.Var(&timestampValue{t: &c.Until}, "until", "range end UTC time in 2006-01-02T15:04:05Z format")
+	fs.StringVar(&c.SrcRelPath, "src", "", "whisper file or Ceres node directory relative path to src base")
+	fs.Var(&timestampValue{t: &c.From}, "from", "range start time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Until}, "until", "range end time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
 	fs.IntVar(&c.ArchiveID, "archive", ArchiveIDAll, "archive ID (-1 is all).")
 	fs.StringVar(&c.TextOut, "text-out", "-", "text output of copying data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
 	fs.BoolVar(&c.ShowHeader, "header", true, "whether or not to show header (metadata and reteions)")
 	fs.Parse(args)
 
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
 	if c.SrcBase == "" {
 		return newRequiredOptionError(fs, "src-base")
 	}
 	if c.SrcRelPath == "" {
 		return newRequiredOptionError(fs, "src")
 	}
-	if c.From > c.Until {
+	if c.Until != 0 && c.From > c.Until {
 		return errFromIsAfterUntil
 	}
 
@@ -52,11 +61,11 @@ func (c *ViewCommand) Parse(fs *flag.FlagSet, args []string) error {
 }
 
 func (c *ViewCommand) Execute() error {
-	return withTextOutWriter(c.TextOut, c.execute)
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
 }
 
-func (c *ViewCommand) execute(tow io.Writer) (err error) {
-	now := whispertool.TimestampFromStdTime(time.Now())
+func (c *ViewCommand) execute(tow *textOutWriter) (err error) {
+	now := nowOrCurrent(c.Now)
 	var until whispertool.Timestamp
 	if c.Until == 0 {
 		until = now
@@ -101,6 +110,20 @@ func readWhisperFileRemote(srcURL, fileRelPath string, archiveID int, from, unti
 }
 
 func getFileDataFromRemote(reqURL string) (*whispertool.Header, TimeSeriesList, error) {
+	h, data, err := getHeaderFromRemote(reqURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	tsList, _, err := takeTimeSeriesList(data, len(h.ArchiveInfoList()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, tsList, nil
+}
+
+// getHeaderFromRemote gets the response of reqURL and returns the header
+// at the start of the response body and the rest of the body.
+func getHeaderFromRemote(reqURL string) (*whispertool.Header, []byte, error) {
 	resp, err := http.Get(reqURL)
 	if err != nil {
 		return nil, nil, err
@@ -120,15 +143,21 @@ func getFileDataFromRemote(reqURL string) (*whispertool.Header, TimeSeriesList,
 	if data, err = h.TakeFrom(data); err != nil {
 		return nil, nil, err
 	}
+	return h, data, nil
+}
 
-	tsList := make(TimeSeriesList, len(h.ArchiveInfoList()))
-	for i := range h.ArchiveInfoList() {
+// takeTimeSeriesList takes archiveCount time series from data and returns
+// them and the rest of data.
+func takeTimeSeriesList(data []byte, archiveCount int) (TimeSeriesList, []byte, error) {
+	tsList := make(TimeSeriesList, archiveCount)
+	var err error
+	for i := range tsList {
 		tsList[i] = &whispertool.TimeSeries{}
 		if data, err = tsList[i].TakeFrom(data); err != nil {
 			return nil, nil, err
 		}
 	}
-	return h, tsList, nil
+	return tsList, data, nil
 }
 
 func convertRemoteErrNotExist(resp *http.Response) error {
@@ -140,6 +169,10 @@ func convertRemoteErrNotExist(resp *http.Response) error {
 }
 
 func readWhisperFileLocal(filename string, archiveID int, from, until, now whispertool.Timestamp) (*whispertool.Header, TimeSeriesList, error) {
+	if whispertool.IsCeresNode(filename) {
+		return readCeresNodeLocal(filename, archiveID, from, until)
+	}
+
 	db, err := whispertool.Open(filename)
 	if err != nil {
 		return nil, nil, err
@@ -175,14 +208,20 @@ func fetchTimeSeriesList(db *whispertool.Whisper, archiveID int, from, until, no
 	return tsList, nil
 }
 
-func printFileData(w io.Writer, h *whispertool.Header, ptsList PointsList, showHeader bool) error {
+func printFileData(w *textOutWriter, h *whispertool.Header, ptsList PointsList, showHeader bool) error {
 	if showHeader {
-		if _, err := fmt.Fprint(w, h.String()); err != nil {
+		if err := w.writeHeader(h); err != nil {
 			return err
 		}
 	}
-	if err := ptsList.Print(w); err != nil {
-		return err
+	for i, points := range ptsList {
+		for _, p := range points {
+			err := w.writeData(textOutField{"archive", i}, w.timestampField("t", p.Time),
+				textOutField{"val", p.Value})
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
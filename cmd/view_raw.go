@@ -3,13 +3,11 @@ package cmd
 import (
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path/filepath"
 	"sort"
-	"time"
 
 	"github.com/hnakamur/whispertool"
 )
@@ -19,30 +17,41 @@ type ViewRawCommand struct {
 	SrcRelPath  string
 	From        whispertool.Timestamp
 	Until       whispertool.Timestamp
+	Now         whispertool.Timestamp
 	ArchiveID   int
 	ShowHeader  bool
 	SortsByTime bool
 	TextOut     string
+	Format      string
+	TimeFormat  TimeFormat
 }
 
 func (c *ViewRawCommand) Parse(fs *flag.FlagSet, args []string) error {
 	fs.StringVar(&c.SrcBase, "src-base", "", "src base directory or URL of \"whispertool server\"")
 	fs.StringVar(&c.SrcRelPath, "src", "", "whisper file relative path to src base")
-	fs.Var(&timestampValue{t: &c.From}, "from", "range start UTC time in 2006-01-02T15:04:05Z format")
-	fs.Var(&timestampValue{t: &c.Until}, "until", "range end UTC time in 2006-01-02T15:04:05Z format")
+	fs.Var(&timestampValue{t: &c.From}, "from", "range start time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Until}, "until", "range end time "+timeExprHelp)
+	fs.Var(&timestampValue{t: &c.Now}, "now", nowUsage)
 	fs.IntVar(&c.ArchiveID, "archive", ArchiveIDAll, "archive ID (-1 is all).")
 	fs.BoolVar(&c.ShowHeader, "header", true, "whether or not to show header (metadata and reteions)")
 	fs.BoolVar(&c.SortsByTime, "sort", false, "whether or not to sorts points by time")
 	fs.StringVar(&c.TextOut, "text-out", "-", "text output of copying data. empty means no output, - means stdout, other means output file.")
+	fs.Var(&textOutFormatValue{&c.Format}, "format", textOutFormatUsage)
+	fs.Var(&timeFormatValue{&c.TimeFormat}, "time-format", timeFormatUsage)
+	fs.Var(&timeZoneValue{&c.TimeFormat}, "tz", timeZoneUsage)
 	fs.Parse(args)
 
+	if err := resolveNow(fs, &c.Now); err != nil {
+		return err
+	}
+
 	if c.SrcBase == "" {
 		return newRequiredOptionError(fs, "src-base")
 	}
 	if c.SrcRelPath == "" {
 		return newRequiredOptionError(fs, "src")
 	}
-	if c.From > c.Until {
+	if c.Until != 0 && c.From > c.Until {
 		return errFromIsAfterUntil
 	}
 
@@ -50,13 +59,13 @@ func (c *ViewRawCommand) Parse(fs *flag.FlagSet, args []string) error {
 }
 
 func (c *ViewRawCommand) Execute() error {
-	return withTextOutWriter(c.TextOut, c.execute)
+	return withTextOutWriter(c.TextOut, c.Format, c.TimeFormat, c.execute)
 }
 
-func (c *ViewRawCommand) execute(tow io.Writer) (err error) {
+func (c *ViewRawCommand) execute(tow *textOutWriter) (err error) {
 	var until whispertool.Timestamp
 	if c.Until == 0 {
-		until = whispertool.TimestampFromStdTime(time.Now())
+		until = nowOrCurrent(c.Now)
 	} else {
 		until = c.Until
 	}
@@ -14,14 +14,30 @@ import (
 const globalUsage = `Usage: %s <subcommand> [options]
 
 subcommands:
+  aggregate           Aggregate values of whisper files with sum, avg, min, max, count, median or percentile.
+  aggregate-copy      Copy aggregate of points from src to dest whisper file.
+  aggregate-diff      Aggregate values of whisper files and compare to another whisper file.
+  audit               Report whisper files whose header disagrees with carbon config.
+  convert             Convert Graphite Ceres node to whisper file.
   copy                Copy points from src to dest whisper file.
   diff                Show diff from src to dest whisper files.
+  dump                Dump header and all raw points of whisper file as text.
+  export-openmetrics  Export points of whisper files as OpenMetrics text for TSDB backfill.
   hole                Copy whisper file and make some holes (empty points) in dest file.
   generate            Generate random whisper file.
-  server              Run web server to respond view and sum query.
-  sum                 Sum value of whisper files.
-  sum-copy            Copy sum of points from src to dest whisper file.
-  sum-diff            Sum value of whisper files and compare to another whisper file.
+  import-influx       Import InfluxDB line protocol into whisper files.
+  import-render-json  Merge JSON of Graphite render API into whisper files.
+  import-rrd          Import RRDtool files into whisper files.
+  mirror              Copy recent points from src to dest whisper files periodically.
+  rebalance           Move whisper files between carbon nodes after changing relay destinations.
+  replica-check       Compare whisper files of replicas and repair minority replicas.
+  restore             Restore whisper file from output of dump.
+  server              Run web server to respond view, sum and aggregate query.
+  sum                 Sum value of whisper files (alias of aggregate).
+  sum-copy            Copy sum of points from src to dest whisper file (alias of aggregate-copy).
+  sum-diff            Sum value of whisper files and compare to another whisper file (alias of aggregate-diff).
+  undo                Restore dest whisper files with undo log of copy or sum-copy.
+  update              Update points in whisper files from CSV, LTSV or carbon plaintext.
   view                View content of whisper file.
   view-raw            View raw content of whisper file.
   version             Show version
@@ -37,6 +53,31 @@ var (
 	date    string
 )
 
+const aggregateCmdUsage = `Usage: {{command}} aggregate [options]
+
+options:
+`
+
+const aggregateCopyCmdUsage = `Usage: {{command}} aggregate-copy [options]
+
+options:
+`
+
+const aggregateDiffCmdUsage = `Usage: {{command}} aggregate-diff [options]
+
+options:
+`
+
+const auditCmdUsage = `Usage: {{command}} audit [options]
+
+options:
+`
+
+const convertCmdUsage = `Usage: {{command}} convert [options]
+
+options:
+`
+
 const copyCmdUsage = `Usage: {{command}} copy [options] src.wsp dest.wsp
 
 options:
@@ -77,6 +118,61 @@ const diffCmdUsage = `Usage: {{command}} diff [options]
 options:
 `
 
+const dumpCmdUsage = `Usage: {{command}} dump [options]
+
+options:
+`
+
+const exportOpenMetricsCmdUsage = `Usage: {{command}} export-openmetrics [options]
+
+options:
+`
+
+const importInfluxCmdUsage = `Usage: {{command}} import-influx [options]
+
+options:
+`
+
+const importRenderJSONCmdUsage = `Usage: {{command}} import-render-json [options]
+
+options:
+`
+
+const importRRDCmdUsage = `Usage: {{command}} import-rrd [options]
+
+options:
+`
+
+const mirrorCmdUsage = `Usage: {{command}} mirror [options]
+
+options:
+`
+
+const rebalanceCmdUsage = `Usage: {{command}} rebalance [options]
+
+options:
+`
+
+const replicaCheckCmdUsage = `Usage: {{command}} replica-check [options]
+
+options:
+`
+
+const restoreCmdUsage = `Usage: {{command}} restore [options]
+
+options:
+`
+
+const undoCmdUsage = `Usage: {{command}} undo [options]
+
+options:
+`
+
+const updateCmdUsage = `Usage: {{command}} update [options]
+
+options:
+`
+
 const generateCmdUsage = `Usage: {{command}} generate [options]
 
 options:
@@ -101,12 +197,40 @@ func run() int {
 
 	var err error
 	switch args[0] {
+	case "aggregate":
+		err = runSubcommand(args, &cmd.AggregateCommand{}, aggregateCmdUsage)
+	case "aggregate-copy":
+		err = runSubcommand(args, &cmd.AggregateCopyCommand{}, aggregateCopyCmdUsage)
+	case "aggregate-diff":
+		err = runSubcommand(args, &cmd.AggregateDiffCommand{}, aggregateDiffCmdUsage)
+	case "audit":
+		err = runSubcommand(args, &cmd.AuditCommand{}, auditCmdUsage)
+	case "convert":
+		err = runSubcommand(args, &cmd.ConvertCommand{}, convertCmdUsage)
 	case "copy":
 		err = runSubcommand(args, &cmd.CopyCommand{}, copyCmdUsage)
 	case "diff":
 		err = runSubcommand(args, &cmd.DiffCommand{}, diffCmdUsage)
+	case "dump":
+		err = runSubcommand(args, &cmd.DumpCommand{}, dumpCmdUsage)
+	case "export-openmetrics":
+		err = runSubcommand(args, &cmd.ExportOpenMetricsCommand{}, exportOpenMetricsCmdUsage)
 	case "generate":
 		err = runSubcommand(args, &cmd.GenerateCommand{}, generateCmdUsage)
+	case "import-influx":
+		err = runSubcommand(args, &cmd.ImportInfluxCommand{}, importInfluxCmdUsage)
+	case "import-render-json":
+		err = runSubcommand(args, &cmd.ImportRenderJSONCommand{}, importRenderJSONCmdUsage)
+	case "import-rrd":
+		err = runSubcommand(args, &cmd.ImportRRDCommand{}, importRRDCmdUsage)
+	case "mirror":
+		err = runSubcommand(args, &cmd.MirrorCommand{}, mirrorCmdUsage)
+	case "rebalance":
+		err = runSubcommand(args, &cmd.RebalanceCommand{}, rebalanceCmdUsage)
+	case "replica-check":
+		err = runSubcommand(args, &cmd.ReplicaCheckCommand{}, replicaCheckCmdUsage)
+	case "restore":
+		err = runSubcommand(args, &cmd.RestoreCommand{}, restoreCmdUsage)
 	case "server":
 		err = runSubcommand(args, &cmd.ServerCommand{}, serverCmdUsage)
 	case "sum":
@@ -115,6 +239,10 @@ func run() int {
 		err = runSubcommand(args, &cmd.SumCopyCommand{}, sumCopyCmdUsage)
 	case "sum-diff":
 		err = runSubcommand(args, &cmd.SumDiffCommand{}, sumDiffCmdUsage)
+	case "undo":
+		err = runSubcommand(args, &cmd.UndoCommand{}, undoCmdUsage)
+	case "update":
+		err = runSubcommand(args, &cmd.UpdateCommand{}, updateCmdUsage)
 	case "view":
 		err = runSubcommand(args, &cmd.ViewCommand{}, viewCmdUsage)
 	case "view-raw":
@@ -0,0 +1,76 @@
+package cmd
+
+import "sync"
+
+const workersUsage = "number of files or items processed concurrently. " +
+	"outputs are written in the order of files or items."
+
+// runOrderedTasks runs task for i in [0, n) with at most workers
+// goroutines. Each task writes to its own buffered textOutWriter and the
+// buffered records are written to tow in the order of i, so outputs of
+// tasks do not interleave. handle is called with the error returned from
+// each task in the order of i on the calling goroutine, so it can update
+// counters without locks. If handle returns a non-nil error, no more tasks
+// are started and the error is returned after running tasks finish.
+//
+// If workers is 1 or less, tasks run sequentially writing to tow directly.
+func runOrderedTasks(tow *textOutWriter, n, workers int, task func(i int, tow *textOutWriter) error, handle func(err error) error) error {
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := handle(task(i, tow)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	type taskResult struct {
+		tow *textOutWriter
+		err error
+	}
+	pending := make(chan chan taskResult, workers)
+	sem := make(chan struct{}, workers)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	go func() {
+		defer close(pending)
+		for i := 0; i < n; i++ {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			}
+			ch := make(chan taskResult, 1)
+			select {
+			case pending <- ch:
+			case <-done:
+				<-sem
+				return
+			}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				btow := tow.newBuffered()
+				err := task(i, btow)
+				ch <- taskResult{tow: btow, err: err}
+			}(i)
+		}
+	}()
+
+	var err error
+	for ch := range pending {
+		r := <-ch
+		if err = r.tow.replayTo(tow); err != nil {
+			break
+		}
+		if err = handle(r.err); err != nil {
+			break
+		}
+	}
+	close(done)
+	for range pending {
+	}
+	wg.Wait()
+	return err
+}
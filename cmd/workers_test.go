@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRunOrderedTasks(t *testing.T) {
+	const n = 20
+	errOdd := errors.New("odd")
+	for _, workers := range []int{1, 4, 100} {
+		var b bytes.Buffer
+		tow := &textOutWriter{Writer: &b, format: textOutFormatLTSV}
+		var oddCount int
+		err := runOrderedTasks(tow, n, workers, func(i int, tow *textOutWriter) error {
+			// Make later tasks finish earlier to check outputs are ordered.
+			time.Sleep(time.Duration(n-i) * time.Millisecond)
+			tow.writeContext(textOutField{"i", i})
+			tow.writeData(textOutField{"v", i * 10})
+			if i%2 == 1 {
+				return errOdd
+			}
+			return nil
+		}, func(err error) error {
+			if errors.Is(err, errOdd) {
+				oddCount++
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want bytes.Buffer
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&want, "i:%d\nv:%d\n", i, i*10)
+		}
+		if got := b.String(); got != want.String() {
+			t.Errorf("output unmatch for workers %d, got=%s, want=%s", workers, got, want.String())
+		}
+		if got, want := oddCount, n/2; got != want {
+			t.Errorf("oddCount unmatch for workers %d, got=%d, want=%d", workers, got, want)
+		}
+	}
+
+	errStop := errors.New("stop")
+	for _, workers := range []int{1, 4} {
+		var b bytes.Buffer
+		tow := &textOutWriter{Writer: &b, format: textOutFormatLTSV}
+		err := runOrderedTasks(tow, n, workers, func(i int, tow *textOutWriter) error {
+			tow.writeData(textOutField{"i", i})
+			if i == 2 {
+				return errStop
+			}
+			return nil
+		}, func(err error) error {
+			return err
+		})
+		if !errors.Is(err, errStop) {
+			t.Errorf("error unmatch for workers %d, got=%v, want=%v", workers, err, errStop)
+		}
+		if got, want := b.String(), "i:0\ni:1\ni:2\n"; got != want {
+			t.Errorf("output unmatch for workers %d, got=%s, want=%s", workers, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package whispertool
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
@@ -103,6 +104,26 @@ func (h *Header) String() string {
 	return b.String()
 }
 
+// MarshalJSON returns the JSON representation of h.
+// The maxRetention is in seconds.
+func (h *Header) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		AggMethod    string          `json:"aggMethod"`
+		AggMethodNum int             `json:"aggMethodNum"`
+		MaxRetention int32           `json:"maxRetention"`
+		XFilesFactor float32         `json:"xFilesFactor"`
+		ArchiveCount uint32          `json:"archiveCount"`
+		ArchiveInfos ArchiveInfoList `json:"archiveInfoList"`
+	}{
+		AggMethod:    h.aggregationMethod.String(),
+		AggMethodNum: int(h.aggregationMethod),
+		MaxRetention: int32(h.maxRetention),
+		XFilesFactor: h.xFilesFactor,
+		ArchiveCount: h.archiveCount,
+		ArchiveInfos: h.archiveInfoList,
+	})
+}
+
 // AppendTo appends encoded bytes of h to dst
 // and returns the extended buffer.
 //
@@ -2,6 +2,7 @@ package whispertool
 
 import (
 	"bytes"
+	"encoding/json"
 	"testing"
 )
 
@@ -40,3 +41,24 @@ func TestHeaderTakeFromAppendTo(t *testing.T) {
 		t.Errorf("encoded bytes unmatch")
 	}
 }
+
+func TestHeader_MarshalJSON(t *testing.T) {
+	archiveInfoList, err := ParseArchiveInfoList("1m:1h,1h:1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHeader(Sum, 0.5, archiveInfoList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"aggMethod":"sum","aggMethodNum":2,"maxRetention":86400,"xFilesFactor":0.5,"archiveCount":2,` +
+		`"archiveInfoList":[{"secondsPerPoint":60,"numberOfPoints":60,"offset":40,"retention":"1m:1h"},` +
+		`{"secondsPerPoint":3600,"numberOfPoints":24,"offset":760,"retention":"1h:1d"}]}`
+	if string(got) != want {
+		t.Errorf("json unmatch, got=%s, want=%s", got, want)
+	}
+}
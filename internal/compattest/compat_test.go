@@ -8,10 +8,9 @@ import (
 	"github.com/hnakamur/whispertool"
 )
 
-var clock = &fixedClock{}
+var clock = &whispertool.FixedClock{}
 
 func TestMain(m *testing.M) {
-	whispertool.Now = clock.Now
 	whisper.Now = clock.Now
 	os.Exit(m.Run())
 }
@@ -1,29 +0,0 @@
-package compattest
-
-import (
-	"sync"
-	"time"
-)
-
-type fixedClock struct {
-	now time.Time
-	mu  sync.Mutex
-}
-
-func (c *fixedClock) Set(t time.Time) {
-	c.mu.Lock()
-	c.now = t
-	c.mu.Unlock()
-}
-
-func (c *fixedClock) Sleep(d time.Duration) {
-	c.mu.Lock()
-	c.now = c.now.Add(d)
-	c.mu.Unlock()
-}
-
-func (c *fixedClock) Now() time.Time {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.now
-}
@@ -21,7 +21,7 @@ func CreateWhispertoolDB(filename string, retentionDefs string, aggregationMetho
 		return nil, err
 	}
 
-	db, err := whispertool.Create(filename, archiveInfoList, aggMethod, xFilesFactor)
+	db, err := whispertool.Create(filename, archiveInfoList, aggMethod, xFilesFactor, whispertool.WithClock(clock))
 	if err != nil {
 		return nil, err
 	}
@@ -29,7 +29,7 @@ func CreateWhispertoolDB(filename string, retentionDefs string, aggregationMetho
 }
 
 func OpenWhispertoolDB(filename string) (*WhispertoolDB, error) {
-	db, err := whispertool.Open(filename)
+	db, err := whispertool.Open(filename, whispertool.WithClock(clock))
 	if err != nil {
 		return nil, err
 	}
@@ -62,7 +62,7 @@ func (db *WhispertoolDB) Fetch(from, until whispertool.Timestamp) (*whispertool.
 
 func (db *WhispertoolDB) fetchAllArchives() (cmd.TimeSeriesList, error) {
 	tl := make(cmd.TimeSeriesList, len(db.ArciveInfoList()))
-	now := whispertool.TimestampFromStdTime(whispertool.Now())
+	now := whispertool.TimestampFromStdTime(clock.Now())
 	var eg errgroup.Group
 	for archiveID, archiveInfo := range db.ArciveInfoList() {
 		archiveID := archiveID
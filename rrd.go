@@ -0,0 +1,326 @@
+package whispertool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+)
+
+// rrdFloatCookie is the value which RRDtool writes in the header to
+// detect the byte order and the alignment of the file.
+const rrdFloatCookie = 8.642135e130
+
+// Sizes of fixed length strings and parameter arrays in RRD files.
+const (
+	rrdCookieSize    = 4
+	rrdVersionSize   = 5
+	rrdNameSize      = 20
+	rrdLastDSSize    = 30
+	rrdUnivalSize    = 8
+	rrdMaxParamCount = 10
+)
+
+// RRD is the content of a RRDtool file.
+//
+// Only files written by RRDtool on platforms with the LP64 data model
+// (e.g. x86_64 and arm64) or i386 are supported in either byte order.
+type RRD struct {
+	Version     string
+	Step        Duration
+	LastUpdate  Timestamp
+	DataSources []RRDDataSource
+	RRAs        []RRDArchive
+}
+
+// RRDDataSource is a data source and its PDP preparation in a RRD file.
+type RRDDataSource struct {
+	Name      string
+	Type      string
+	Heartbeat uint64
+	Min       float64
+	Max       float64
+
+	// LastDS is the last value given to the data source.
+	LastDS string
+	// PDPValue is the accumulated value of the current primary data point.
+	PDPValue float64
+	// UnknownSeconds is the unknown seconds of the current primary data point.
+	UnknownSeconds uint64
+}
+
+// RRDArchive is a round robin archive (RRA) in a RRD file.
+type RRDArchive struct {
+	CF           string
+	RowCount     uint64
+	PDPCount     uint64
+	XFilesFactor float64
+
+	// CDPPreps is the consolidation in progress for each data source.
+	CDPPreps []RRDCDPPrep
+	// CurRow is the index of the row which was written most recently.
+	CurRow uint64
+
+	// values is rows of values for data sources in the ring order.
+	values []float64
+}
+
+// RRDCDPPrep is the consolidated data point in progress for a data source in a RRA.
+type RRDCDPPrep struct {
+	Value           float64
+	UnknownPDPCount uint64
+}
+
+// ReadRRDFile reads a RRDtool file.
+func ReadRRDFile(filename string) (*RRD, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	rrd, err := ParseRRD(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return rrd, nil
+}
+
+// ParseRRD parses the content of a RRDtool file.
+func ParseRRD(data []byte) (*RRD, error) {
+	r, err := newRRDReader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	rrd := &RRD{}
+	r.pos = rrdCookieSize
+	rrd.Version = r.str(rrdVersionSize)
+	// NOTE: Microseconds of the last update were added in version 0003.
+	hasLastUpdateUsec := true
+	switch rrd.Version {
+	case "0001", "0002":
+		hasLastUpdateUsec = false
+	case "0003", "0004", "0005":
+	default:
+		return nil, fmt.Errorf("unsupported RRD version: %q", rrd.Version)
+	}
+	r.double() // float cookie
+	dsCount := r.ulong()
+	rraCount := r.ulong()
+	step := r.ulong()
+	r.params()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if step == 0 || step > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid step in RRD: %d", step)
+	}
+	if dsCount == 0 || rraCount == 0 || dsCount > uint64(len(data)) || rraCount > uint64(len(data)) {
+		return nil, errors.New("invalid data source or RRA count in RRD")
+	}
+	rrd.Step = Duration(step)
+
+	rrd.DataSources = make([]RRDDataSource, dsCount)
+	for i := range rrd.DataSources {
+		ds := &rrd.DataSources[i]
+		ds.Name = r.str(rrdNameSize)
+		ds.Type = r.str(rrdNameSize)
+		par := r.params()
+		ds.Heartbeat = par[0].ulong
+		ds.Min = par[1].double
+		ds.Max = par[2].double
+	}
+
+	rrd.RRAs = make([]RRDArchive, rraCount)
+	for i := range rrd.RRAs {
+		rra := &rrd.RRAs[i]
+		rra.CF = r.str(rrdNameSize)
+		rra.RowCount = r.ulong()
+		rra.PDPCount = r.ulong()
+		par := r.params()
+		rra.XFilesFactor = par[0].double
+		if r.err == nil && (rra.RowCount == 0 || rra.PDPCount == 0 || rra.RowCount > uint64(len(data))) {
+			return nil, fmt.Errorf("invalid row count or PDP count of RRA %d", i)
+		}
+	}
+
+	lastUpdate := r.ulong()
+	if hasLastUpdateUsec {
+		r.ulong()
+	}
+	if lastUpdate > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid last update in RRD: %d", lastUpdate)
+	}
+	rrd.LastUpdate = Timestamp(lastUpdate)
+
+	for i := range rrd.DataSources {
+		ds := &rrd.DataSources[i]
+		ds.LastDS = r.str(rrdLastDSSize)
+		scratch := r.params()
+		ds.UnknownSeconds = scratch[0].ulong
+		ds.PDPValue = scratch[1].double
+	}
+	for i := range rrd.RRAs {
+		rra := &rrd.RRAs[i]
+		rra.CDPPreps = make([]RRDCDPPrep, dsCount)
+		for j := range rra.CDPPreps {
+			scratch := r.params()
+			rra.CDPPreps[j] = RRDCDPPrep{Value: scratch[0].double, UnknownPDPCount: scratch[1].ulong}
+		}
+	}
+	for i := range rrd.RRAs {
+		rra := &rrd.RRAs[i]
+		rra.CurRow = r.ulong()
+		if r.err == nil && rra.CurRow >= rra.RowCount {
+			return nil, fmt.Errorf("invalid current row of RRA %d", i)
+		}
+	}
+
+	for i := range rrd.RRAs {
+		rra := &rrd.RRAs[i]
+		n := rra.RowCount * dsCount
+		if r.err == nil && n > uint64(len(data)-r.pos)/float64Size {
+			return nil, errors.New("RRD file is truncated")
+		}
+		rra.values = make([]float64, n)
+		for j := range rra.values {
+			rra.values[j] = r.double()
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return rrd, nil
+}
+
+// RRAStep returns the duration of a row of the RRA.
+func (rrd *RRD) RRAStep(rraIndex int) Duration {
+	return rrd.Step * Duration(rrd.RRAs[rraIndex].PDPCount)
+}
+
+// TimeSeries returns values of the data source in the RRA in the order
+// of time. RRDtool labels a row with the end time of the interval, but
+// times in the returned TimeSeries are the start times as whisper does.
+func (rrd *RRD) TimeSeries(rraIndex, dsIndex int) *TimeSeries {
+	rra := &rrd.RRAs[rraIndex]
+	step := rrd.RRAStep(rraIndex)
+	dsCount := uint64(len(rrd.DataSources))
+
+	lastEnd := rrd.LastUpdate - rrd.LastUpdate%Timestamp(step)
+	untilTime := lastEnd
+	fromTime := untilTime.Add(-Duration(rra.RowCount) * step)
+	values := make([]Value, rra.RowCount)
+	for i := range values {
+		row := (rra.CurRow + 1 + uint64(i)) % rra.RowCount
+		values[i] = Value(rra.values[row*dsCount+uint64(dsIndex)])
+	}
+	return NewTimeSeries(fromTime, untilTime, step, values)
+}
+
+type rrdUnival struct {
+	ulong  uint64
+	double float64
+}
+
+// rrdReader reads values of C structs written by RRDtool with
+// the byte order, the size of long and the alignment of the platform.
+type rrdReader struct {
+	data     []byte
+	pos      int
+	order    binary.ByteOrder
+	longSize int
+	maxAlign int
+	err      error
+}
+
+func newRRDReader(data []byte) (*rrdReader, error) {
+	if len(data) < rrdCookieSize || !bytes.Equal(data[:rrdCookieSize], []byte("RRD\x00")) {
+		return nil, errors.New("not a RRD file")
+	}
+	candidates := []struct {
+		cookieOffset int
+		longSize     int
+		maxAlign     int
+	}{
+		{cookieOffset: 16, longSize: 8, maxAlign: 8}, // LP64
+		{cookieOffset: 12, longSize: 4, maxAlign: 4}, // i386
+	}
+	for _, c := range candidates {
+		if len(data) < c.cookieOffset+float64Size {
+			continue
+		}
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			b := data[c.cookieOffset : c.cookieOffset+float64Size]
+			if math.Float64frombits(order.Uint64(b)) == rrdFloatCookie {
+				return &rrdReader{
+					data:     data,
+					order:    order,
+					longSize: c.longSize,
+					maxAlign: c.maxAlign,
+				}, nil
+			}
+		}
+	}
+	return nil, errors.New("unsupported byte order or alignment of RRD file")
+}
+
+func (r *rrdReader) align(size int) {
+	if size > r.maxAlign {
+		size = r.maxAlign
+	}
+	r.pos = (r.pos + size - 1) / size * size
+}
+
+func (r *rrdReader) bytes(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	if r.pos+n > len(r.data) {
+		r.err = errors.New("RRD file is truncated")
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *rrdReader) str(n int) string {
+	s := string(r.bytes(n))
+	if i := strings.IndexByte(s, 0); i != -1 {
+		s = s[:i]
+	}
+	return s
+}
+
+func (r *rrdReader) ulong() uint64 {
+	r.align(r.longSize)
+	b := r.bytes(r.longSize)
+	if r.longSize == 4 {
+		return uint64(r.order.Uint32(b))
+	}
+	return r.order.Uint64(b)
+}
+
+func (r *rrdReader) double() float64 {
+	r.align(float64Size)
+	return math.Float64frombits(r.order.Uint64(r.bytes(float64Size)))
+}
+
+// params reads an array of unival, which is a union of unsigned long
+// and double, used for parameters and scratch areas.
+func (r *rrdReader) params() [rrdMaxParamCount]rrdUnival {
+	var par [rrdMaxParamCount]rrdUnival
+	r.align(rrdUnivalSize)
+	for i := range par {
+		b := r.bytes(rrdUnivalSize)
+		par[i].double = math.Float64frombits(r.order.Uint64(b))
+		if r.longSize == 4 {
+			par[i].ulong = uint64(r.order.Uint32(b))
+		} else {
+			par[i].ulong = r.order.Uint64(b)
+		}
+	}
+	return par
+}
@@ -0,0 +1,185 @@
+package whispertool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// rrdTestWriter writes C structs of RRD files for tests in the same
+// layout as rrdReader reads.
+type rrdTestWriter struct {
+	buf      []byte
+	order    binary.ByteOrder
+	longSize int
+	maxAlign int
+}
+
+func (w *rrdTestWriter) align(size int) {
+	if size > w.maxAlign {
+		size = w.maxAlign
+	}
+	for len(w.buf)%size != 0 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *rrdTestWriter) str(s string, n int) {
+	b := make([]byte, n)
+	copy(b, s)
+	w.buf = append(w.buf, b...)
+}
+
+func (w *rrdTestWriter) ulong(v uint64) {
+	w.align(w.longSize)
+	b := make([]byte, w.longSize)
+	if w.longSize == 4 {
+		w.order.PutUint32(b, uint32(v))
+	} else {
+		w.order.PutUint64(b, v)
+	}
+	w.buf = append(w.buf, b...)
+}
+
+func (w *rrdTestWriter) double(v float64) {
+	w.align(float64Size)
+	b := make([]byte, float64Size)
+	w.order.PutUint64(b, math.Float64bits(v))
+	w.buf = append(w.buf, b...)
+}
+
+// params writes univals. Values of type uint64 are written as unsigned long.
+func (w *rrdTestWriter) params(values ...interface{}) {
+	w.align(rrdUnivalSize)
+	for i := 0; i < rrdMaxParamCount; i++ {
+		b := make([]byte, rrdUnivalSize)
+		if i < len(values) {
+			switch v := values[i].(type) {
+			case uint64:
+				if w.longSize == 4 {
+					w.order.PutUint32(b, uint32(v))
+				} else {
+					w.order.PutUint64(b, v)
+				}
+			case float64:
+				w.order.PutUint64(b, math.Float64bits(v))
+			}
+		}
+		w.buf = append(w.buf, b...)
+	}
+}
+
+func buildTestRRD(order binary.ByteOrder, longSize, maxAlign int) []byte {
+	nan := math.NaN()
+	w := &rrdTestWriter{order: order, longSize: longSize, maxAlign: maxAlign}
+	w.str("RRD", rrdCookieSize)
+	w.str("0003", rrdVersionSize)
+	w.double(rrdFloatCookie)
+	w.ulong(2)  // ds_cnt
+	w.ulong(2)  // rra_cnt
+	w.ulong(60) // pdp_step
+	w.params()
+
+	w.str("in", rrdNameSize)
+	w.str("COUNTER", rrdNameSize)
+	w.params(uint64(120), 0.0, nan)
+	w.str("out", rrdNameSize)
+	w.str("GAUGE", rrdNameSize)
+	w.params(uint64(120), nan, 100.0)
+
+	w.str("AVERAGE", rrdNameSize)
+	w.ulong(4) // row_cnt
+	w.ulong(1) // pdp_cnt
+	w.params(0.5)
+	w.str("MAX", rrdNameSize)
+	w.ulong(3)
+	w.ulong(5)
+	w.params(0.5)
+
+	w.ulong(1592654430) // last_up, 2020-06-20T12:00:30Z
+	w.ulong(0)          // last_up_usec
+
+	w.str("123", rrdLastDSSize)
+	w.params(uint64(30), 1.5)
+	w.str("U", rrdLastDSSize)
+	w.params(uint64(0), 0.0)
+
+	for i := 0; i < 4; i++ {
+		w.params(2.5, uint64(1))
+	}
+
+	w.ulong(1) // cur_row of RRA 0
+	w.ulong(2) // cur_row of RRA 1
+
+	// RRA 0 rows in the ring order, the latest row is at index 1.
+	for _, v := range []float64{3, 4, nan, 2} {
+		w.double(v)
+		w.double(v * 10)
+	}
+	// RRA 1 rows, the latest row is at index 2.
+	for _, v := range []float64{5, 6, 7} {
+		w.double(v)
+		w.double(v * 10)
+	}
+	return w.buf
+}
+
+func TestParseRRD(t *testing.T) {
+	layouts := []struct {
+		name     string
+		order    binary.ByteOrder
+		longSize int
+		maxAlign int
+	}{
+		{name: "lp64-le", order: binary.LittleEndian, longSize: 8, maxAlign: 8},
+		{name: "lp64-be", order: binary.BigEndian, longSize: 8, maxAlign: 8},
+		{name: "i386", order: binary.LittleEndian, longSize: 4, maxAlign: 4},
+	}
+	for _, l := range layouts {
+		rrd, err := ParseRRD(buildTestRRD(l.order, l.longSize, l.maxAlign))
+		if err != nil {
+			t.Fatalf("error for layout %s: %s", l.name, err)
+		}
+		if rrd.Version != "0003" || rrd.Step != Minute || rrd.LastUpdate != 1592654430 {
+			t.Errorf("header unmatch for layout %s, version=%s, step=%s, lastUpdate=%s",
+				l.name, rrd.Version, rrd.Step, rrd.LastUpdate)
+		}
+		if len(rrd.DataSources) != 2 || rrd.DataSources[0].Name != "in" || rrd.DataSources[0].Type != "COUNTER" ||
+			rrd.DataSources[0].Heartbeat != 120 || rrd.DataSources[1].Max != 100 ||
+			rrd.DataSources[0].LastDS != "123" || rrd.DataSources[0].PDPValue != 1.5 || rrd.DataSources[0].UnknownSeconds != 30 {
+			t.Errorf("data sources unmatch for layout %s, got=%+v", l.name, rrd.DataSources)
+		}
+		if len(rrd.RRAs) != 2 || rrd.RRAs[1].CF != "MAX" || rrd.RRAs[1].RowCount != 3 || rrd.RRAs[1].PDPCount != 5 ||
+			rrd.RRAs[1].XFilesFactor != 0.5 || rrd.RRAs[1].CurRow != 2 ||
+			rrd.RRAs[0].CDPPreps[1] != (RRDCDPPrep{Value: 2.5, UnknownPDPCount: 1}) {
+			t.Errorf("RRAs unmatch for layout %s, got=%+v", l.name, rrd.RRAs)
+		}
+
+		testCases := []struct {
+			rra, ds int
+			want    string
+		}{
+			{rra: 0, ds: 0, want: `{"fromTime":"2020-06-20T11:56:00Z","untilTime":"2020-06-20T12:00:00Z","step":60,"values":[null,2,3,4]}`},
+			{rra: 0, ds: 1, want: `{"fromTime":"2020-06-20T11:56:00Z","untilTime":"2020-06-20T12:00:00Z","step":60,"values":[null,20,30,40]}`},
+			{rra: 1, ds: 0, want: `{"fromTime":"2020-06-20T11:45:00Z","untilTime":"2020-06-20T12:00:00Z","step":300,"values":[5,6,7]}`},
+		}
+		for _, tc := range testCases {
+			got, err := json.Marshal(rrd.TimeSeries(tc.rra, tc.ds))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("timeseries unmatch for layout %s, rra=%d, ds=%d, got=%s, want=%s", l.name, tc.rra, tc.ds, got, tc.want)
+			}
+		}
+	}
+
+	data := buildTestRRD(binary.LittleEndian, 8, 8)
+	if _, err := ParseRRD(data[:len(data)-1]); err == nil {
+		t.Errorf("should get error for truncated data")
+	}
+	if _, err := ParseRRD([]byte("WSP\x00")); err == nil {
+		t.Errorf("should get error for non RRD data")
+	}
+}
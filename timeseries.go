@@ -2,6 +2,7 @@ package whispertool
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
@@ -93,6 +94,12 @@ func (ts *TimeSeries) valuesEqual(ts2 *TimeSeries) bool {
 
 // DiffPoints returns the different points between ts and us.
 func (ts *TimeSeries) DiffPoints(ts2 *TimeSeries) (Points, Points) {
+	return ts.DiffPointsWithTolerance(ts2, Tolerance{})
+}
+
+// DiffPointsWithTolerance returns the different points between ts and us
+// with values compared using Value.EqualWithTolerance.
+func (ts *TimeSeries) DiffPointsWithTolerance(ts2 *TimeSeries, tol Tolerance) (Points, Points) {
 	if len(ts.Values()) != len(ts2.Values()) {
 		return ts.Points(), ts2.Points()
 	}
@@ -102,7 +109,7 @@ func (ts *TimeSeries) DiffPoints(ts2 *TimeSeries) (Points, Points) {
 		t := ts.FromTime().Add(Duration(i) * ts.Step())
 		t2 := ts2.FromTime().Add(Duration(i) * ts.Step())
 		v2 := ts2.Values()[i]
-		if t != t2 || !v.Equal(v2) {
+		if t != t2 || !v.EqualWithTolerance(v2, tol) {
 			pts = append(pts, Point{Time: t, Value: v})
 			pts2 = append(pts2, Point{Time: t2, Value: v2})
 		}
@@ -130,6 +137,45 @@ func (ts *TimeSeries) DiffPointsExcludeSrcNaN(ts2 *TimeSeries) (Points, Points)
 	return pts, pts2
 }
 
+// Aggregate returns a new TimeSeries whose values are aggregated with
+// the method to the step in the same way as whisper propagates points
+// to lower precision archives. Intervals are aligned to the step, and
+// the value is NaN if the ratio of non-NaN values in the interval is
+// less than xFilesFactor. The step must be a multiple of the step of ts.
+func (ts *TimeSeries) Aggregate(step Duration, method AggregationMethod, xFilesFactor float32) (*TimeSeries, error) {
+	if step <= 0 || step%ts.step != 0 {
+		return nil, fmt.Errorf("step %s is not a multiple of step %s", step, ts.step)
+	}
+	if err := validateAggregationMethod(method); err != nil {
+		return nil, err
+	}
+	fromTime := ts.fromTime - ts.fromTime%Timestamp(step)
+	untilTime := ts.untilTime
+	if rem := untilTime % Timestamp(step); rem != 0 {
+		untilTime += Timestamp(step) - rem
+	}
+
+	pointsPerInterval := int(step / ts.step)
+	values := make([]Value, untilTime.Sub(fromTime)/step)
+	known := make([][]Value, len(values))
+	for i, v := range ts.values {
+		if v.IsNaN() {
+			continue
+		}
+		t := ts.fromTime.Add(Duration(i) * ts.step)
+		j := t.Sub(fromTime) / step
+		known[j] = append(known[j], v)
+	}
+	for i := range values {
+		if len(known[i]) == 0 || float32(len(known[i]))/float32(pointsPerInterval) < xFilesFactor {
+			values[i].SetNaN()
+			continue
+		}
+		values[i] = aggregate(method, known[i])
+	}
+	return NewTimeSeries(fromTime, untilTime, step, values), nil
+}
+
 // Values returns the values in ts.
 func (ts *TimeSeries) Values() []Value { return ts.values }
 
@@ -142,6 +188,23 @@ func (ts *TimeSeries) String() string {
 		ts.fromTime, ts.untilTime, ts.step, ts.values)
 }
 
+// MarshalJSON returns the JSON representation of ts.
+// Times are formatted in UTCTimeLayout, the step is in seconds,
+// and NaN values are encoded as null.
+func (ts *TimeSeries) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		FromTime  string  `json:"fromTime"`
+		UntilTime string  `json:"untilTime"`
+		Step      int32   `json:"step"`
+		Values    []Value `json:"values"`
+	}{
+		FromTime:  ts.fromTime.String(),
+		UntilTime: ts.untilTime.String(),
+		Step:      int32(ts.step),
+		Values:    ts.values,
+	})
+}
+
 // AppendTo appends encoded bytes of ts to dst
 // and returns the extended buffer.
 //
@@ -233,6 +296,12 @@ func (pp Points) Equal(qq Points) bool {
 
 // Diff returns the different points in comparison of pp and qq.
 func (pp Points) Diff(qq Points) (Points, Points) {
+	return pp.DiffWithTolerance(qq, Tolerance{})
+}
+
+// DiffWithTolerance returns the different points in comparison of pp and qq
+// with values compared using Value.EqualWithTolerance.
+func (pp Points) DiffWithTolerance(qq Points, tol Tolerance) (Points, Points) {
 	if len(pp) != len(qq) {
 		return pp, qq
 	}
@@ -240,7 +309,7 @@ func (pp Points) Diff(qq Points) (Points, Points) {
 	var pp2, qq2 []Point
 	for i, p := range pp {
 		q := qq[i]
-		if !p.Equal(q) {
+		if p.Time != q.Time || !p.Value.EqualWithTolerance(q.Value, tol) {
 			pp2 = append(pp2, p)
 			qq2 = append(qq2, q)
 		}
@@ -319,6 +388,18 @@ func (p Point) String() string {
 	return "{" + p.Time.String() + " " + p.Value.String() + "}"
 }
 
+// MarshalJSON returns the JSON representation of p.
+// The time is formatted in UTCTimeLayout and NaN value is encoded as null.
+func (p Point) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time  string `json:"time"`
+		Value Value  `json:"value"`
+	}{
+		Time:  p.Time.String(),
+		Value: p.Value,
+	})
+}
+
 // Equals returns whether or not p equals to q.
 // It returns true if time and value of p equals to q.
 // For comparison of value, Value's Equals method is used.
@@ -371,6 +452,20 @@ func (v Value) String() string {
 	return strconv.FormatFloat(float64(v), 'f', -1, 64)
 }
 
+// MarshalJSON returns the JSON representation of v.
+// Since JSON has no representation for NaN and infinities,
+// NaN is encoded as null and infinities are encoded as strings
+// "+Inf" and "-Inf" so that they can be told from NaN.
+func (v Value) MarshalJSON() ([]byte, error) {
+	if v.IsNaN() {
+		return []byte("null"), nil
+	}
+	if math.IsInf(float64(v), 0) {
+		return []byte(`"` + v.String() + `"`), nil
+	}
+	return []byte(v.String()), nil
+}
+
 // Add returns the sum (v + u) if both v and u is not NaN.
 // It returns u if v is NaN, v if u is NaN.
 func (v Value) Add(u Value) Value {
@@ -401,6 +496,70 @@ func (v Value) Equal(u Value) bool {
 	return (pIsNaN && qIsNaN) || (!pIsNaN && !qIsNaN && v == u)
 }
 
+// Tolerance is the tolerance in comparison of values.
+// The zero value means the exact comparison same as Value.Equal.
+type Tolerance struct {
+	// Abs is the maximum absolute difference of equal values.
+	Abs float64
+
+	// Rel is the maximum difference of equal values relative to
+	// the larger magnitude of them.
+	Rel float64
+
+	// ULP is the maximum number of representable float64 values
+	// between equal values.
+	ULP uint64
+
+	// IgnoreOneSideNaN makes values equal if only one of them is NaN.
+	IgnoreOneSideNaN bool
+}
+
+// EqualWithTolerance returns whether or not v equals to u within tol.
+// Values are equal if they are within any of Abs, Rel and ULP of tol.
+// Infinities equal only to the same infinity.
+func (v Value) EqualWithTolerance(u Value, tol Tolerance) bool {
+	vIsNaN := v.IsNaN()
+	uIsNaN := u.IsNaN()
+	if vIsNaN || uIsNaN {
+		return (vIsNaN && uIsNaN) || tol.IgnoreOneSideNaN
+	}
+	if v == u {
+		return true
+	}
+	x, y := float64(v), float64(u)
+	if math.IsInf(x, 0) || math.IsInf(y, 0) {
+		return false
+	}
+	d := math.Abs(x - y)
+	if d <= tol.Abs {
+		return true
+	}
+	if d <= tol.Rel*math.Max(math.Abs(x), math.Abs(y)) {
+		return true
+	}
+	return tol.ULP != 0 && ulpDistance(x, y) <= tol.ULP
+}
+
+// ulpDistance returns the number of representable float64 values
+// between x and y, which must not be NaN.
+func ulpDistance(x, y float64) uint64 {
+	a, b := orderedFloat64Bits(x), orderedFloat64Bits(y)
+	if a < b {
+		a, b = b, a
+	}
+	return uint64(a) - uint64(b)
+}
+
+// orderedFloat64Bits returns an integer whose order is the same as x.
+// Both of 0 and -0 are mapped to 0.
+func orderedFloat64Bits(x float64) int64 {
+	b := int64(math.Float64bits(x))
+	if b < 0 {
+		b = math.MinInt64 - b
+	}
+	return b
+}
+
 // AppendTo appends encoded bytes of v to dst
 // and returns the extended buffer.
 //
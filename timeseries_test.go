@@ -0,0 +1,99 @@
+package whispertool
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestTimeSeries_MarshalJSON(t *testing.T) {
+	from, err := ParseTimestamp("2020-06-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nan := Value(math.NaN())
+	ts := NewTimeSeries(from, from.Add(3*Minute), Minute, []Value{1.5, nan, Value(math.Inf(1))})
+	got, err := json.Marshal(ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"fromTime":"2020-06-20T12:00:00Z","untilTime":"2020-06-20T12:03:00Z","step":60,"values":[1.5,null,"+Inf"]}`
+	if string(got) != want {
+		t.Errorf("json unmatch, got=%s, want=%s", got, want)
+	}
+
+	got, err = json.Marshal(Points{{Time: from, Value: 2}, {Time: from.Add(Minute), Value: nan}, {Time: from.Add(2 * Minute), Value: Value(math.Inf(-1))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `[{"time":"2020-06-20T12:00:00Z","value":2},{"time":"2020-06-20T12:01:00Z","value":null},{"time":"2020-06-20T12:02:00Z","value":"-Inf"}]`
+	if string(got) != want {
+		t.Errorf("json unmatch, got=%s, want=%s", got, want)
+	}
+}
+
+func TestTimeSeries_Aggregate(t *testing.T) {
+	from, err := ParseTimestamp("2020-06-20T12:01:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nan := Value(math.NaN())
+	ts := NewTimeSeries(from, from.Add(5*Minute), Minute, []Value{1, nan, 3, nan, 5})
+
+	testCases := []struct {
+		method       AggregationMethod
+		xFilesFactor float32
+		want         string
+	}{
+		{method: Sum, xFilesFactor: 0, want: `{"fromTime":"2020-06-20T12:00:00Z","untilTime":"2020-06-20T12:06:00Z","step":180,"values":[1,8]}`},
+		{method: Average, xFilesFactor: 0.5, want: `{"fromTime":"2020-06-20T12:00:00Z","untilTime":"2020-06-20T12:06:00Z","step":180,"values":[null,4]}`},
+		{method: Max, xFilesFactor: 0.7, want: `{"fromTime":"2020-06-20T12:00:00Z","untilTime":"2020-06-20T12:06:00Z","step":180,"values":[null,null]}`},
+	}
+	for _, tc := range testCases {
+		got, err := ts.Aggregate(3*Minute, tc.method, tc.xFilesFactor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.want {
+			t.Errorf("aggregate unmatch for method=%s, xFilesFactor=%g, got=%s, want=%s", tc.method, tc.xFilesFactor, b, tc.want)
+		}
+	}
+
+	if _, err := ts.Aggregate(90*Second, Sum, 0); err == nil {
+		t.Errorf("should get error for step which is not a multiple")
+	}
+}
+
+func TestValue_EqualWithTolerance(t *testing.T) {
+	nan := Value(math.NaN())
+	inf := Value(math.Inf(1))
+	sum := Value(0.1) + Value(0.2)
+	testCases := []struct {
+		v, u Value
+		tol  Tolerance
+		want bool
+	}{
+		{v: sum, u: 0.3, tol: Tolerance{}, want: false},
+		{v: sum, u: 0.3, tol: Tolerance{Abs: 1e-9}, want: true},
+		{v: sum, u: 0.3, tol: Tolerance{Rel: 1e-9}, want: true},
+		{v: sum, u: 0.3, tol: Tolerance{ULP: 1}, want: true},
+		{v: 1, u: 1.5, tol: Tolerance{Abs: 0.4, Rel: 0.1, ULP: 4}, want: false},
+		{v: 100, u: 101, tol: Tolerance{Rel: 0.01}, want: true},
+		{v: -1, u: 1, tol: Tolerance{ULP: 4}, want: false},
+		{v: 0, u: Value(math.Copysign(0, -1)), tol: Tolerance{}, want: true},
+		{v: nan, u: nan, tol: Tolerance{}, want: true},
+		{v: nan, u: 1, tol: Tolerance{Abs: 1e9}, want: false},
+		{v: 1, u: nan, tol: Tolerance{IgnoreOneSideNaN: true}, want: true},
+		{v: inf, u: inf, tol: Tolerance{}, want: true},
+		{v: inf, u: 1, tol: Tolerance{Rel: 1}, want: false},
+	}
+	for _, tc := range testCases {
+		if got := tc.v.EqualWithTolerance(tc.u, tc.tol); got != tc.want {
+			t.Errorf("result unmatch for v=%s, u=%s, tol=%+v, got=%v, want=%v", tc.v, tc.u, tc.tol, got, tc.want)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -26,19 +28,104 @@ const (
 	Hour            = 60 * Minute
 	Day             = 24 * Hour
 	Week            = 7 * Day
+	Month           = 30 * Day
 	Year            = 365 * Day
 )
 
-// ParseTimestamp parses timestamp in "2006-01-02T15:04:05Z" format.
-// Note only "Z" is allowed for timezone.
+// ParseTimestamp parses an absolute timestamp.
+//
+// The following formats are accepted:
+//
+//   - "2006-01-02T15:04:05Z" (UTCTimeLayout)
+//   - RFC3339 with an offset like "2006-01-02T15:04:05+09:00"
+//   - a local time followed by a time zone name like
+//     "2006-01-02T15:04:05 Asia/Tokyo" or "2006-01-02 15:04:05 Local"
+//   - Unix epoch seconds like "1136214245"
+//
+// Unix epoch seconds "0" is rejected since the zero Timestamp means
+// an unset time, which is often treated as now.
 func ParseTimestamp(s string) (Timestamp, error) {
-	t, err := time.Parse(UTCTimeLayout, s)
+	if isDigits(s) {
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp: %s", err)
+		}
+		if v == 0 {
+			return 0, errors.New("invalid timestamp: 0 is reserved for unset time")
+		}
+		return Timestamp(v), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
 	if err != nil {
-		return 0, fmt.Errorf("invalid timestamp: %s", err)
+		i := strings.LastIndexByte(s, ' ')
+		if i == -1 {
+			return 0, fmt.Errorf("invalid timestamp: %s", err)
+		}
+		loc, err2 := time.LoadLocation(s[i+1:])
+		if err2 != nil {
+			return 0, fmt.Errorf("invalid timestamp: %s", err2)
+		}
+		t, err2 = parseLocalTime(s[:i], loc)
+		if err2 != nil {
+			return 0, fmt.Errorf("invalid timestamp: %s", err2)
+		}
+	}
+	if t.Unix() < 0 || t.Unix() > math.MaxUint32 {
+		return 0, fmt.Errorf("invalid timestamp: out of range: %s", s)
 	}
 	return TimestampFromStdTime(t), nil
 }
 
+var localTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+func parseLocalTime(s string, loc *time.Location) (t time.Time, err error) {
+	for _, layout := range localTimeLayouts {
+		t, err = time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
+
+// ParseTimestampRelativeTo parses a timestamp which may be relative to now.
+//
+// Besides the formats accepted by ParseTimestamp, Graphite-style
+// relative expressions are accepted, for example "now", "now-2d",
+// "now+1h", "-1h" and "-30min". See ParseDuration for units
+// which can be used in relative expressions.
+func ParseTimestampRelativeTo(s string, now Timestamp) (Timestamp, error) {
+	if s == "" {
+		return 0, errors.New("invalid timestamp: empty string")
+	}
+	rel := strings.TrimPrefix(s, "now")
+	if rel == "" {
+		return now, nil
+	}
+	if rel[0] != '-' && rel[0] != '+' {
+		return ParseTimestamp(s)
+	}
+
+	d, err := ParseDuration(rel[1:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp: %s", err)
+	}
+	if rel[0] == '-' {
+		if Timestamp(d) > now {
+			return 0, fmt.Errorf("invalid timestamp: out of range: %s", s)
+		}
+		return now.Add(-d), nil
+	}
+	if uint64(now)+uint64(d) > math.MaxUint32 {
+		return 0, fmt.Errorf("invalid timestamp: out of range: %s", s)
+	}
+	return now.Add(d), nil
+}
+
 // StdTimeToTimestamp returns t as a Timestamp.
 func TimestampFromStdTime(t time.Time) Timestamp {
 	if t.IsZero() {
@@ -106,9 +193,15 @@ func (t *Timestamp) TakeFrom(src []byte) ([]byte, error) {
 }
 
 // ParseDuration parses a Duration string.
+//
+// A Duration string is a non-negative integer followed by a unit.
+// Like carbon, a unit can be any prefix of "seconds", "minutes", "hours",
+// "days", "weeks" and "years", for example "s", "sec", "min" or "hours".
+// Note "m" means minutes. Like graphite-web, "mon", "month" and "months"
+// can be used for months which are 30 days.
 func ParseDuration(s string) (Duration, error) {
 	x, rem, err := leadingInt(s)
-	if err != nil || len(rem) != 1 {
+	if err != nil || len(rem) == 0 {
 		return 0, fmt.Errorf("invalid Duration: %s", s)
 	}
 	unit, err := unitMultiplier(rem)
@@ -154,26 +247,30 @@ func leadingInt(s string) (x int32, rem string, err error) {
 	return x, s[i:], nil
 }
 
+// durationUnits is the list of units for ParseDuration.
+// The first unit whose name starts with a given string
+// and is at least minLen long is used.
+var durationUnits = []struct {
+	name   string
+	minLen int
+	d      Duration
+}{
+	{name: "seconds", minLen: 1, d: Second},
+	{name: "minutes", minLen: 1, d: Minute},
+	{name: "hours", minLen: 1, d: Hour},
+	{name: "days", minLen: 1, d: Day},
+	{name: "weeks", minLen: 1, d: Week},
+	{name: "years", minLen: 1, d: Year},
+	{name: "months", minLen: 3, d: Month},
+}
+
 func unitMultiplier(s string) (d Duration, err error) {
-	if len(s) == 0 {
-		return 0, fmt.Errorf("invalid unit: %v", s)
-	}
-	switch s[0] {
-	case 's':
-		return Second, nil
-	case 'm':
-		return Minute, nil
-	case 'h':
-		return Hour, nil
-	case 'd':
-		return Day, nil
-	case 'w':
-		return Week, nil
-	case 'y':
-		return Year, nil
-	default:
-		return 0, fmt.Errorf("invalid unit: %v", s)
+	for _, u := range durationUnits {
+		if len(s) >= u.minLen && strings.HasPrefix(u.name, s) {
+			return u.d, nil
+		}
 	}
+	return 0, fmt.Errorf("invalid unit: %v", s)
 }
 
 // String returns the string representation of d.
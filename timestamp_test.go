@@ -78,6 +78,26 @@ func TestParseDuration(t *testing.T) {
 
 		// multiple units
 		{input: "1h1m", wantDur: 0, wantErr: true},
+
+		// multi-letter units
+		{input: "1sec", wantDur: Second, wantErr: false},
+		{input: "2seconds", wantDur: 2 * Second, wantErr: false},
+		{input: "1min", wantDur: Minute, wantErr: false},
+		{input: "5minutes", wantDur: 5 * Minute, wantErr: false},
+		{input: "1hour", wantDur: Hour, wantErr: false},
+		{input: "3hours", wantDur: 3 * Hour, wantErr: false},
+		{input: "1day", wantDur: Day, wantErr: false},
+		{input: "90days", wantDur: 90 * Day, wantErr: false},
+		{input: "2weeks", wantDur: 2 * Week, wantErr: false},
+		{input: "1mon", wantDur: Month, wantErr: false},
+		{input: "6months", wantDur: 6 * Month, wantErr: false},
+		{input: "5years", wantDur: 5 * Year, wantErr: false},
+
+		// invalid multi-letter units
+		{input: "1mo", wantDur: 0, wantErr: true},
+		{input: "1secs", wantDur: 0, wantErr: true},
+		{input: "1minute5", wantDur: 0, wantErr: true},
+		{input: "1hr", wantDur: 0, wantErr: true},
 	}
 	for _, tc := range testCases {
 		d, err := ParseDuration(tc.input)
@@ -131,7 +151,19 @@ func TestParseTimestamp(t *testing.T) {
 		wantErr bool
 	}{
 		{input: "2020-06-20T11:51:23Z", wantTs: 1592653883, wantErr: false},
-		{input: "2020-06-20T11:51:23+00:00", wantTs: 0, wantErr: true},
+		{input: "2020-06-20T11:51:23+00:00", wantTs: 1592653883, wantErr: false},
+		{input: "2020-06-20T20:51:23+09:00", wantTs: 1592653883, wantErr: false},
+		{input: "2020-06-20T20:51:23 Asia/Tokyo", wantTs: 1592653883, wantErr: false},
+		{input: "2020-06-20 20:51:23 Asia/Tokyo", wantTs: 1592653883, wantErr: false},
+		{input: "2020-06-20T11:51:23 UTC", wantTs: 1592653883, wantErr: false},
+		{input: "1592653883", wantTs: 1592653883, wantErr: false},
+		{input: "0", wantTs: 0, wantErr: true},
+		{input: "4294967296", wantTs: 0, wantErr: true},
+		{input: "1969-12-31T23:59:59Z", wantTs: 0, wantErr: true},
+		{input: "2020-06-20T11:51:23", wantTs: 0, wantErr: true},
+		{input: "2020-06-20T11:51:23 No/Such_Zone", wantTs: 0, wantErr: true},
+		{input: "-1h", wantTs: 0, wantErr: true},
+		{input: "", wantTs: 0, wantErr: true},
 	}
 	for _, tc := range testCases {
 		ts, err := ParseTimestamp(tc.input)
@@ -146,6 +178,42 @@ func TestParseTimestamp(t *testing.T) {
 	}
 }
 
+func TestParseTimestampRelativeTo(t *testing.T) {
+	const now = Timestamp(1592653883)
+	testCases := []struct {
+		input   string
+		wantTs  Timestamp
+		wantErr bool
+	}{
+		{input: "now", wantTs: now, wantErr: false},
+		{input: "now-2d", wantTs: now - 2*86400, wantErr: false},
+		{input: "now+1h", wantTs: now + 3600, wantErr: false},
+		{input: "-1h", wantTs: now - 3600, wantErr: false},
+		{input: "-30min", wantTs: now - 30*60, wantErr: false},
+		{input: "+1w", wantTs: now + 7*86400, wantErr: false},
+		{input: "-1mon", wantTs: now - 30*86400, wantErr: false},
+		{input: "2020-06-20T11:51:23Z", wantTs: 1592653883, wantErr: false},
+		{input: "1592650000", wantTs: 1592650000, wantErr: false},
+		{input: "-51y", wantTs: 0, wantErr: true},
+		{input: "now-", wantTs: 0, wantErr: true},
+		{input: "now-1", wantTs: 0, wantErr: true},
+		{input: "now-1h-1m", wantTs: 0, wantErr: true},
+		{input: "nowish", wantTs: 0, wantErr: true},
+		{input: "", wantTs: 0, wantErr: true},
+	}
+	for _, tc := range testCases {
+		ts, err := ParseTimestampRelativeTo(tc.input, now)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("unexpected err for input %q, gotErr=%v, wantErr=%v",
+				tc.input, gotErr, tc.wantErr)
+		}
+		if ts != tc.wantTs {
+			t.Errorf("timestamp unmatch for input %q, got=%v, want=%v",
+				tc.input, ts, tc.wantTs)
+		}
+	}
+}
+
 func TestTimestamp_Truncate(t *testing.T) {
 	testCases := []struct {
 		t    Timestamp
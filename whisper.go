@@ -22,6 +22,7 @@ type Whisper struct {
 	flock        bool
 	perm         os.FileMode
 	pageSize     int64
+	clock        Clock
 }
 
 // Option is the type for options for creating or opening a whisper file.
@@ -54,6 +55,16 @@ func WithPerm(perm os.FileMode) Option {
 	}
 }
 
+// WithClock sets the clock which is used to get the current time
+// when zero is passed as now to methods like FetchFromArchive and
+// UpdatePointsForArchive, and in Fetch, Update and UpdateMany.
+// Without this option, the Now function variable is used.
+func WithClock(clock Clock) Option {
+	return func(w *Whisper) {
+		w.clock = clock
+	}
+}
+
 // Create creates a whisper database file.
 func Create(filename string, archiveInfoList []ArchiveInfo, aggregationMethod AggregationMethod, xFilesFactor float32, opts ...Option) (*Whisper, error) {
 	h, err := NewHeader(aggregationMethod, xFilesFactor, archiveInfoList)
@@ -108,12 +119,14 @@ func Open(filename string, opts ...Option) (*Whisper, error) {
 
 	st, err := w.file.Stat()
 	if err != nil {
+		w.file.Close()
 		return nil, fmt.Errorf("stat: %s: %s", filename, err)
 	}
 
 	w.fileBuf = filebuffer.New(w.file, st.Size(), w.pageSize)
 
 	if err := w.readHeader(); err != nil {
+		w.file.Close()
 		return nil, fmt.Errorf("readHeader: %s: %s", filename, err)
 	}
 	return w, nil
@@ -179,17 +192,28 @@ func (w *Whisper) Fetch(from, until Timestamp) (*TimeSeries, error) {
 }
 
 // Now is a function which returns the current time.
-// You can mock this function in tests.
+// It is used for a Whisper created or opened without WithClock.
+//
+// Deprecated: Mocking this variable affects all Whisper in the process.
+// Use WithClock instead.
 var Now = time.Now
 
+// now returns the current time from the clock of w.
+func (w *Whisper) now() Timestamp {
+	if w.clock != nil {
+		return TimestampFromStdTime(w.clock.Now())
+	}
+	return TimestampFromStdTime(Now())
+}
+
 // FetchFromArchive fetches points in the specified archive and the time range.
 //
 // FetchFromArchive fetches points from archive specified with `arhiveID`.
 // It fetches points in range between `from` (exclusive) and `until` (inclusive).
-// If `now` is zero, the current time is used.
+// If `now` is zero, the current time is used (see WithClock).
 func (w *Whisper) FetchFromArchive(arhiveID int, from, until, now Timestamp) (*TimeSeries, error) {
 	if now == 0 {
-		now = TimestampFromStdTime(Now())
+		now = w.now()
 	}
 	if from > until {
 		return nil, fmt.Errorf("invalid time interval: from time '%d' is after until time '%d'", from, until)
@@ -283,7 +307,7 @@ func (w *Whisper) Update(t Timestamp, v Value) error {
 func (w *Whisper) UpdatePointForArchive(archiveID int, t Timestamp, v Value, now Timestamp) error {
 	// log.Printf("UpdatePointForArchive start, archiveID=%d, t=%s, v=%s, now=%s", archiveID, t, v, now)
 	if now == 0 {
-		now = TimestampFromStdTime(Now())
+		now = w.now()
 	}
 
 	if t <= now.Add(-w.MaxRetention()) || now < t {
@@ -330,7 +354,7 @@ func (w *Whisper) UpdateMany(points []Point) (err error) {
 // github.com/go-graphite/go-whisper.
 func (w *Whisper) UpdatePointsForArchive(points []Point, archiveID int, now Timestamp) error {
 	if now == 0 {
-		now = TimestampFromStdTime(Now())
+		now = w.now()
 	}
 
 	sort.Stable(Points(points))
@@ -386,11 +410,7 @@ func extractPoints(points []Point, now Timestamp, maxRetention Duration) (curren
 	for i := len(points) - 1; i >= 0; i-- {
 		p := points[i]
 		if p.Time <= maxAge {
-			if i > 0 {
-				return points[i+1:], points[:i+1]
-			} else {
-				return Points{}, points
-			}
+			return points[i+1:], points[:i+1]
 		}
 	}
 	return points, remainingPoints
@@ -503,6 +523,29 @@ func (w *Whisper) GetAllRawUnsortedPoints(archiveID int) (Points, error) {
 	return points, nil
 }
 
+// PutAllRawUnsortedPoints writes the raw unsorted points to the archive.
+// points must be in the same order as returned from GetAllRawUnsortedPoints
+// and the length must be equal to the number of points of the archive.
+// This is provided for restoring a file from a dump.
+func (w *Whisper) PutAllRawUnsortedPoints(archiveID int, points Points) error {
+	if archiveID < 0 || archiveID >= len(w.ArchiveInfoList()) {
+		return ErrArchiveIDOutOfRange
+	}
+	r := &w.ArchiveInfoList()[archiveID]
+	if len(points) != int(r.numberOfPoints) {
+		return fmt.Errorf("point count unmatch for archive %d, got=%d, want=%d",
+			archiveID, len(points), r.numberOfPoints)
+	}
+	off := r.offset
+	for i := range points {
+		if err := w.putPointAt(points[i], off); err != nil {
+			return err
+		}
+		off += pointSize
+	}
+	return nil
+}
+
 func (w *Whisper) fetchRawPoints(archiveID int, fromInterval, untilInterval Timestamp) (Points, error) {
 	r := &w.ArchiveInfoList()[archiveID]
 	baseInterval, err := w.baseInterval(r)
@@ -740,6 +740,40 @@ func Test_extractPoints_only_old_points(t *testing.T) {
 	}
 }
 
+func Test_extractPoints_only_oldest_point_is_old(t *testing.T) {
+	now := TimestampFromStdTime(time.Now())
+	points := Points{{Time: now.Add(-100), Value: 1}, {Time: now.Add(-10), Value: 2}, {Time: now, Value: 3}}
+
+	currentPoints, remainingPoints := extractPoints(points, now, 50)
+	if length := len(currentPoints); length != 2 {
+		t.Fatalf("First: %v", length)
+	}
+	if length := len(remainingPoints); length != 1 {
+		t.Fatalf("Second: %v", length)
+	}
+}
+
+func TestUpdatePointsForArchive_mixedAges(t *testing.T) {
+	now := testParseTimestamp(t, "2020-07-03T06:00:38Z")
+	db := testCreateDB(t, "1s:8s,4s:32s", Sum, 0)
+	points := []Point{
+		{Time: now.Add(-20 * Second), Value: 1},
+		{Time: now.Add(-Second), Value: 2},
+		{Time: now, Value: 4},
+	}
+	if err := db.UpdatePointsForArchive(points, ArchiveIDBest, now); err != nil {
+		t.Fatal(err)
+	}
+
+	tsList := testFetchAllPoints(t, db, now)
+	got := timeSeriesListString(tsList)
+	want := "retID:0\tfrom:2020-07-03T06:00:31Z\tuntil:2020-07-03T06:00:39Z\tstep:1s\tvalues:NaN NaN NaN NaN NaN NaN 2 4\n" +
+		"retID:1\tfrom:2020-07-03T06:00:08Z\tuntil:2020-07-03T06:00:40Z\tstep:4s\tvalues:NaN NaN 1 NaN NaN NaN NaN 6"
+	if got != want {
+		t.Errorf("time series unmatch,\n got=%s,\nwant=%s", got, want)
+	}
+}
+
 func Test_aggregateAverage(t *testing.T) {
 	test_aggregate(t, Average, 3.0)
 }